@@ -12,6 +12,8 @@
 package ast
 
 import (
+	"cmp"
+	"slices"
 	"strings"
 
 	"github.com/dr8co/kong/token"
@@ -90,9 +92,10 @@ func (id *Identifier) TokenLiteral() string { return id.Token.Literal }
 // String returns the value (name) of the identifier.
 func (id *Identifier) String() string { return id.Value }
 
-// LetStatement represents a variable binding statement (e.g., "let x = 5;").
+// LetStatement represents a variable binding statement (e.g., "let x = 5;"),
+// or a constant binding statement (e.g., "const x = 5;").
 type LetStatement struct {
-	// The 'let' token.
+	// The 'let' or 'const' token.
 	Token token.Token
 
 	// The identifier being bound.
@@ -104,11 +107,14 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode() {}
 
-// TokenLiteral returns the literal value of the 'let' token.
+// TokenLiteral returns the literal value of the 'let' or 'const' token.
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// IsConst reports whether the statement binds a constant, which cannot be reassigned.
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.Const }
+
 // String returns a string representation of the let statement.
-// Format: "let <identifier> = <expression>;"
+// Format: "let <identifier> = <expression>;", or "const <identifier> = <expression>;"
 func (ls *LetStatement) String() string {
 	var out strings.Builder
 
@@ -182,6 +188,9 @@ type IntegerLiteral struct {
 
 	// The actual integer value.
 	Value int64
+
+	// Base is the base the literal was written in: 16 for "0xff", 8 for "0o17", 2 for "0b101", and 10 otherwise.
+	Base int
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -237,6 +246,9 @@ type InfixExpression struct {
 
 	// The expression to the right of the operator.
 	Right Expression
+
+	// Parenthesized is set by the parser if the expression is written in parentheses, as in "(a < b) < c".
+	Parenthesized bool
 }
 
 func (ie *InfixExpression) expressionNode() {}
@@ -258,6 +270,43 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// TernaryExpression represents a conditional expression in the AST.
+// For example, "x > 0 ? x : -x".
+type TernaryExpression struct {
+	// The '?' token
+	Token token.Token
+
+	// The condition to evaluate.
+	Condition Expression
+
+	// The expression evaluated if the condition is truthy.
+	Consequence Expression
+
+	// The expression evaluated otherwise.
+	Alternative Expression
+}
+
+func (te *TernaryExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the token associated with this expression.
+func (te *TernaryExpression) TokenLiteral() string { return te.Token.Literal }
+
+// String returns a string representation of the conditional expression.
+// Format: "(<condition> ? <consequence> : <alternative>)"
+func (te *TernaryExpression) String() string {
+	var out strings.Builder
+
+	out.WriteString("(")
+	out.WriteString(te.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(te.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(te.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // Boolean represents a boolean literal expression in the AST.
 // For example, "true" or "false".
 type Boolean struct {
@@ -276,6 +325,20 @@ func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 // String returns a string representation of the boolean literal.
 func (b *Boolean) String() string { return b.Token.Literal }
 
+// NullLiteral represents the "null" literal expression in the AST.
+type NullLiteral struct {
+	// The 'null' token.
+	Token token.Token
+}
+
+func (n *NullLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the 'null' token.
+func (n *NullLiteral) TokenLiteral() string { return n.Token.Literal }
+
+// String returns a string representation of the null literal.
+func (n *NullLiteral) String() string { return n.Token.Literal }
+
 // IfExpression represents an if-else expression in the AST.
 // For example, "if (x > y) { x } else { y }".
 type IfExpression struct {
@@ -288,7 +351,8 @@ type IfExpression struct {
 	// The block to execute if the condition is true.
 	Consequence *BlockStatement
 
-	// The block to execute if the condition is false (optional)
+	// The block to execute if the condition is false (optional).
+	// For "else if", it is a block holding only the nested if expression, whose token is the "if" token.
 	Alternative *BlockStatement
 }
 
@@ -297,8 +361,22 @@ func (ie *IfExpression) expressionNode() {}
 // TokenLiteral returns the literal value of the token associated with this expression.
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// ElseIf returns the nested if expression of an "else if", or nil if the alternative is not one.
+func (ie *IfExpression) ElseIf() *IfExpression {
+	alt := ie.Alternative
+	if alt == nil || alt.Token.Type != token.If || len(alt.Statements) != 1 {
+		return nil
+	}
+	stmt, ok := alt.Statements[0].(*ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	nested, _ := stmt.Expression.(*IfExpression)
+	return nested
+}
+
 // String returns a string representation of the `if expression`.
-// Format: "if <condition> <consequence> else <alternative>"
+// Format: "if <condition> <consequence> else <alternative>", where an "else if" alternative is the nested if expression.
 func (ie *IfExpression) String() string {
 	var out strings.Builder
 
@@ -307,7 +385,10 @@ func (ie *IfExpression) String() string {
 	out.WriteString(" ")
 	out.WriteString(ie.Consequence.String())
 
-	if ie.Alternative != nil {
+	if nested := ie.ElseIf(); nested != nil {
+		out.WriteString("else ")
+		out.WriteString(nested.String())
+	} else if ie.Alternative != nil {
 		out.WriteString("else ")
 		out.WriteString(ie.Alternative.String())
 	}
@@ -354,6 +435,9 @@ type FunctionLiteral struct {
 
 	// The name of the function (optional).
 	Name string
+
+	// The annotations attached to the function (e.g., "memoize" for "@memoize fn() {}").
+	Annotations []string
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -362,7 +446,7 @@ func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 
 // String returns a string representation of the function literal.
-// Format: "fn <namee>(<parameters>) <body>"
+// Format: "<annotations> fn <name>(<parameters>) <body>"
 func (fl *FunctionLiteral) String() string {
 	var out strings.Builder
 
@@ -371,6 +455,9 @@ func (fl *FunctionLiteral) String() string {
 		params = append(params, p.String())
 	}
 
+	for _, a := range fl.Annotations {
+		out.WriteString("@" + a + " ")
+	}
 	out.WriteString(fl.TokenLiteral())
 	if fl.Name != "" {
 		out.WriteString("<" + fl.Name + ">")
@@ -418,6 +505,46 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// MethodCallExpression represents a call of a function stored in a hash, passing the hash as the first argument.
+// For example, "rect.area()" calls rect["area"] with rect as its argument.
+type MethodCallExpression struct {
+	// The '.' token.
+	Token token.Token
+
+	// The expression producing the hash, evaluated once.
+	Receiver Expression
+
+	// The key of the function in the hash.
+	Method *Identifier
+
+	// The arguments passed after the receiver.
+	Arguments []Expression
+}
+
+func (mce *MethodCallExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the '.' token.
+func (mce *MethodCallExpression) TokenLiteral() string { return mce.Token.Literal }
+
+// String returns a string representation of the method call.
+// Format: "<receiver>.<method>(<arguments>)"
+func (mce *MethodCallExpression) String() string {
+	var out strings.Builder
+	args := make([]string, 0, len(mce.Arguments))
+
+	for _, a := range mce.Arguments {
+		args = append(args, a.String())
+	}
+	out.WriteString(mce.Receiver.String())
+	out.WriteString(".")
+	out.WriteString(mce.Method.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // StringLiteral represents a string literal expression in the AST.
 // For example, "hello world".
 type StringLiteral struct {
@@ -499,6 +626,47 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression represents a slice expression in the AST.
+// For example, "myArray[1:3]", "myArray[:2]" or "myString[2:]".
+type SliceExpression struct {
+	// The '[' token.
+	Token token.Token
+
+	// The expression being sliced (array or string).
+	Left Expression
+
+	// The index of the first element in the slice (optional, defaults to the start).
+	Low Expression
+
+	// The index after the last element in the slice (optional, defaults to the end).
+	High Expression
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the token associated with this expression.
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String returns a string representation of the slice expression.
+// Format: "(<left-expression>[<low>:<high>])"
+func (se *SliceExpression) String() string {
+	var out strings.Builder
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // HashLiteral represents a hash literal expression in the AST.
 // For example, "{key1: value1, key2: value2}".
 type HashLiteral struct {
@@ -507,10 +675,38 @@ type HashLiteral struct {
 
 	// The key-value pairs in the hash.
 	Pairs map[Expression]Expression
+
+	// Keys lists the keys of Pairs in source order.
+	Keys []Expression
 }
 
 func (hl *HashLiteral) expressionNode() {}
 
+// OrderedKeys returns the keys of the hash in source order.
+// Keys stored directly in the Pairs map, bypassing Keys, follow in the order of their string form.
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for _, key := range hl.Keys {
+		if _, ok := hl.Pairs[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == len(hl.Pairs) {
+		return keys
+	}
+
+	var rest []Expression
+	for key := range hl.Pairs {
+		if !slices.Contains(keys, key) {
+			rest = append(rest, key)
+		}
+	}
+	slices.SortStableFunc(rest, func(a, b Expression) int {
+		return cmp.Compare(a.String(), b.String())
+	})
+	return append(keys, rest...)
+}
+
 // TokenLiteral returns the literal value of the token associated with this hash.
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 
@@ -520,8 +716,8 @@ func (hl *HashLiteral) String() string {
 	var out strings.Builder
 
 	pairs := make([]string, 0, len(hl.Pairs))
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.OrderedKeys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -529,3 +725,233 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// AssignStatement represents an assignment to an existing variable (e.g., "x = x + 1;"),
+// or a compound assignment that combines the variable with a value (e.g., "x += 1;").
+type AssignStatement struct {
+	// The assignment operator token: '=' or a compound operator such as '+='.
+	Token token.Token
+
+	// The variable being assigned to.
+	Name *Identifier
+
+	// The expression that produces the new value, or the right operand of a compound assignment.
+	Value Expression
+}
+
+func (as *AssignStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the assignment operator token.
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+
+// String returns a string representation of the assignment.
+// Format: "<identifier> <operator> <expression>;"
+func (as *AssignStatement) String() string {
+	var out strings.Builder
+
+	out.WriteString(as.Name.String())
+	out.WriteString(" " + as.Token.Literal + " ")
+
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// IndexAssignStatement represents an assignment to an element of an array or a hash (e.g., "arr[0] = 1;"),
+// or a compound assignment to one (e.g., "counts[word] += 1;").
+type IndexAssignStatement struct {
+	// The assignment operator token: '=' or a compound operator such as '+='.
+	Token token.Token
+
+	// The array or hash being assigned into.
+	Left Expression
+
+	// The index or key of the element.
+	Index Expression
+
+	// The expression that produces the new value, or the right operand of a compound assignment.
+	Value Expression
+}
+
+func (ias *IndexAssignStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the assignment operator token.
+func (ias *IndexAssignStatement) TokenLiteral() string { return ias.Token.Literal }
+
+// String returns a string representation of the index assignment.
+// Format: "<expression>[<expression>] <operator> <expression>;"
+func (ias *IndexAssignStatement) String() string {
+	var out strings.Builder
+
+	out.WriteString(ias.Left.String())
+	out.WriteString("[")
+	out.WriteString(ias.Index.String())
+	out.WriteString("] " + ias.Token.Literal + " ")
+
+	if ias.Value != nil {
+		out.WriteString(ias.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// IncDecStatement represents incrementing or decrementing a variable by one (e.g., "i++;" or "i--;").
+type IncDecStatement struct {
+	// The '++' or '--' token.
+	Token token.Token
+
+	// The variable being incremented or decremented.
+	Name *Identifier
+}
+
+func (ids *IncDecStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the '++' or '--' token.
+func (ids *IncDecStatement) TokenLiteral() string { return ids.Token.Literal }
+
+// String returns a string representation of the statement.
+// Format: "<identifier>++;" or "<identifier>--;"
+func (ids *IncDecStatement) String() string {
+	return ids.Name.String() + ids.Token.Literal + ";"
+}
+
+// WhileStatement represents a loop that runs while its condition is truthy.
+// For example, "while (x < 10) { x = x + 1; }".
+type WhileStatement struct {
+	// The 'while' token.
+	Token token.Token
+
+	// The condition checked before each iteration.
+	Condition Expression
+
+	// The loop body.
+	Body *BlockStatement
+
+	// The label naming the loop for break and continue statements, or nil if the loop is unlabeled.
+	Label *Identifier
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the 'while' token.
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+// String returns a string representation of the while loop.
+// Format: "[<label>: ]while <condition> <body>"
+func (ws *WhileStatement) String() string {
+	var out strings.Builder
+
+	writeLabel(&out, ws.Label)
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement represents a C-style loop with optional init, condition and post parts.
+// For example, "for (let i = 0; i < 10; i = i + 1) { puts(i); }".
+type ForStatement struct {
+	// The 'for' token.
+	Token token.Token
+
+	// The statement run once before the loop starts (optional).
+	Init Statement
+
+	// The condition checked before each iteration (optional, defaults to true).
+	Condition Expression
+
+	// The statement run after each iteration, including those ended by 'continue' (optional).
+	Post Statement
+
+	// The loop body.
+	Body *BlockStatement
+
+	// The label naming the loop for break and continue statements, or nil if the loop is unlabeled.
+	Label *Identifier
+}
+
+func (fs *ForStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the 'for' token.
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// String returns a string representation of the for loop.
+// Format: "[<label>: ]for (<init>; <condition>; <post>) <body>"
+func (fs *ForStatement) String() string {
+	var out strings.Builder
+
+	writeLabel(&out, fs.Label)
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// writeLabel writes the label of a loop, followed by a colon, if the loop has one.
+func writeLabel(out *strings.Builder, label *Identifier) {
+	if label != nil {
+		out.WriteString(label.Value)
+		out.WriteString(": ")
+	}
+}
+
+// BreakStatement represents a "break;" statement, which leaves the innermost loop,
+// or a "break <label>;" statement, which leaves the enclosing loop with that label.
+type BreakStatement struct {
+	// The 'break' token.
+	Token token.Token
+
+	// The label of the loop to leave, or nil for the innermost loop.
+	Label *Identifier
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the 'break' token.
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// String returns a string representation of the break statement.
+func (bs *BreakStatement) String() string { return jumpString(bs.Token, bs.Label) }
+
+// ContinueStatement represents a "continue;" statement, which skips to the next iteration of the innermost loop,
+// or a "continue <label>;" statement, which skips to the next iteration of the enclosing loop with that label.
+type ContinueStatement struct {
+	// The 'continue' token.
+	Token token.Token
+
+	// The label of the loop to continue, or nil for the innermost loop.
+	Label *Identifier
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the 'continue' token.
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// String returns a string representation of the continue statement.
+func (cs *ContinueStatement) String() string { return jumpString(cs.Token, cs.Label) }
+
+// jumpString returns the string representation of a break or continue statement.
+// Format: "<keyword>[ <label>];"
+func jumpString(tok token.Token, label *Identifier) string {
+	if label == nil {
+		return tok.Literal + ";"
+	}
+	return tok.Literal + " " + label.Value + ";"
+}
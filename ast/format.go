@@ -0,0 +1,394 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dr8co/kong/token"
+)
+
+// Format returns node as canonical Monkey source: one statement per line, blocks indented with tabs,
+// operators surrounded by spaces, and only the parentheses that the structure of the tree requires,
+// besides those around a comparison that another comparison orders, as in "(a < b) < c".
+// In a program, statements that span several lines are set apart from their neighbors by a blank line.
+//
+// Parsing the result and formatting it again gives the same source. Comments are not part of the tree,
+// so they are not preserved.
+func Format(node Node) string {
+	f := &formatter{}
+	switch node := node.(type) {
+	case *Program:
+		f.statements(node.Statements, true)
+	case Statement:
+		f.statement(node)
+	case Expression:
+		f.expression(node, bindLowest)
+	}
+	return f.out.String()
+}
+
+// Binding strengths of expressions, mirroring the precedences of the parser.
+// An operand that binds less tightly than its position requires is parenthesized.
+const (
+	bindLowest = iota
+	bindTernary
+	bindEquals
+	bindLessGreater
+	bindSum
+	bindProduct
+	bindPrefix
+	bindPostfix // calls, method calls, index and slice expressions
+	bindAtom
+)
+
+// formatter accumulates formatted source.
+type formatter struct {
+	out strings.Builder
+
+	// indent is the nesting depth of the block being written.
+	indent int
+}
+
+func (f *formatter) write(s ...string) {
+	for _, part := range s {
+		f.out.WriteString(part)
+	}
+}
+
+// statements writes stmts one per line, each line indented to the current depth and ended with a newline.
+// If blankLines is true, statements spanning several lines are surrounded by blank lines.
+func (f *formatter) statements(stmts []Statement, blankLines bool) {
+	texts := make([]string, len(stmts))
+	for i, s := range stmts {
+		sub := &formatter{indent: f.indent}
+		sub.statement(s)
+		texts[i] = sub.out.String()
+	}
+
+	for i, text := range texts {
+		if blankLines && i > 0 && (strings.Contains(texts[i-1], "\n") || strings.Contains(text, "\n")) {
+			f.write("\n")
+		}
+		f.write(strings.Repeat("\t", f.indent), text)
+		// An if expression statement ends without a semicolon, unless the next statement
+		// would otherwise continue it as an operand.
+		if i+1 < len(texts) && endsWithBlock(stmts[i]) && strings.IndexAny(texts[i+1], "([-") == 0 {
+			f.write(";")
+		}
+		f.write("\n")
+	}
+}
+
+// endsWithBlock reports whether s is an expression statement written without a trailing semicolon.
+func endsWithBlock(s Statement) bool {
+	stmt, ok := s.(*ExpressionStatement)
+	if !ok {
+		return false
+	}
+	_, ok = stmt.Expression.(*IfExpression)
+	return ok
+}
+
+// block writes a braced block, with its statements on their own lines one level deeper.
+func (f *formatter) block(block *BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		f.write("{}")
+		return
+	}
+	f.write("{\n")
+	f.indent++
+	f.statements(block.Statements, false)
+	f.indent--
+	f.write(strings.Repeat("\t", f.indent), "}")
+}
+
+// statement writes s without leading indentation or a trailing newline.
+func (f *formatter) statement(s Statement) {
+	switch s := s.(type) {
+	case *LetStatement:
+		keyword := "let"
+		if s.IsConst() {
+			keyword = "const"
+		}
+		f.write(keyword, " ", s.Name.Value, " = ")
+		f.expression(s.Value, bindLowest)
+		f.write(";")
+	case *ReturnStatement:
+		f.write("return ")
+		f.expression(s.ReturnValue, bindLowest)
+		f.write(";")
+	case *ExpressionStatement:
+		f.expression(s.Expression, bindLowest)
+		if !endsWithBlock(s) {
+			f.write(";")
+		}
+	case *AssignStatement:
+		f.write(s.Name.Value, " ", s.Token.Literal, " ")
+		f.expression(s.Value, bindLowest)
+		f.write(";")
+	case *IndexAssignStatement:
+		f.expression(s.Left, bindPostfix)
+		f.write("[")
+		f.expression(s.Index, bindLowest)
+		f.write("] ", s.Token.Literal, " ")
+		f.expression(s.Value, bindLowest)
+		f.write(";")
+	case *IncDecStatement:
+		f.write(s.Name.Value, s.Token.Literal, ";")
+	case *WhileStatement:
+		f.label(s.Label)
+		f.write("while (")
+		f.expression(s.Condition, bindLowest)
+		f.write(") ")
+		f.block(s.Body)
+	case *ForStatement:
+		f.label(s.Label)
+		f.write("for (")
+		f.clause(s.Init)
+		f.write(";")
+		if s.Condition != nil {
+			f.write(" ")
+			f.expression(s.Condition, bindLowest)
+		}
+		f.write(";")
+		if s.Post != nil {
+			f.write(" ")
+			f.clause(s.Post)
+		}
+		f.write(") ")
+		f.block(s.Body)
+	case *BreakStatement:
+		f.jump("break", s.Label)
+	case *ContinueStatement:
+		f.jump("continue", s.Label)
+	case *BlockStatement:
+		f.block(s)
+	}
+}
+
+// clause writes the init or post statement of a for loop, without its semicolon.
+func (f *formatter) clause(s Statement) {
+	if s == nil {
+		return
+	}
+	sub := &formatter{indent: f.indent}
+	sub.statement(s)
+	f.write(strings.TrimSuffix(sub.out.String(), ";"))
+}
+
+func (f *formatter) label(label *Identifier) {
+	if label != nil {
+		f.write(label.Value, ": ")
+	}
+}
+
+func (f *formatter) jump(keyword string, label *Identifier) {
+	f.write(keyword)
+	if label != nil {
+		f.write(" ", label.Value)
+	}
+	f.write(";")
+}
+
+// binding returns how tightly e holds together as an operand.
+func binding(e Expression) int {
+	switch e := e.(type) {
+	case *TernaryExpression:
+		return bindTernary
+	case *InfixExpression:
+		switch e.Operator {
+		case "==", "!=", "in":
+			return bindEquals
+		case "<", "<=", ">", ">=":
+			return bindLessGreater
+		case "+", "-":
+			return bindSum
+		case "*", "/", "%":
+			return bindProduct
+		}
+		return bindLowest
+	case *PrefixExpression:
+		return bindPrefix
+	case *CallExpression, *MethodCallExpression, *IndexExpression, *SliceExpression:
+		return bindPostfix
+	}
+	return bindAtom
+}
+
+// operand writes an operand of the infix expression e like expression, but keeps the parentheses around
+// a comparison that e orders, as "a < b < c" would be a chained comparison instead of "(a < b) < c".
+func (f *formatter) operand(e *InfixExpression, operand Expression, minBinding int) {
+	if inner, ok := operand.(*InfixExpression); ok && inner.Parenthesized &&
+		binding(e) == bindLessGreater && binding(inner) == bindLessGreater {
+		minBinding = bindAtom
+	}
+	f.expression(operand, minBinding)
+}
+
+// expression writes e, in parentheses if it binds less tightly than minBinding.
+func (f *formatter) expression(e Expression, minBinding int) {
+	if e == nil {
+		return
+	}
+	if binding(e) < minBinding {
+		f.write("(")
+		f.expression(e, bindLowest)
+		f.write(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *Identifier:
+		f.write(e.Value)
+	case *IntegerLiteral:
+		if e.Token.Literal != "" {
+			f.write(e.Token.Literal)
+		} else {
+			f.write(strconv.FormatInt(e.Value, 10))
+		}
+	case *StringLiteral:
+		f.write(quote(e.Value))
+	case *Boolean:
+		f.write(strconv.FormatBool(e.Value))
+	case *NullLiteral:
+		f.write("null")
+	case *PrefixExpression:
+		f.write(e.Operator)
+		if right, ok := e.Right.(*PrefixExpression); ok && right.Operator == e.Operator {
+			// "--x" would read as a decrement.
+			f.write("(")
+			f.expression(e.Right, bindLowest)
+			f.write(")")
+		} else {
+			f.expression(e.Right, bindPrefix)
+		}
+	case *InfixExpression:
+		b := binding(e)
+		f.operand(e, e.Left, b)
+		f.write(" ", e.Operator, " ")
+		f.operand(e, e.Right, b+1)
+	case *TernaryExpression:
+		f.expression(e.Condition, bindTernary+1)
+		f.write(" ? ")
+		f.expression(e.Consequence, bindLowest)
+		f.write(" : ")
+		f.expression(e.Alternative, bindTernary)
+	case *IfExpression:
+		f.ifExpression(e)
+	case *FunctionLiteral:
+		for _, a := range e.Annotations {
+			f.write("@", a, " ")
+		}
+		f.write("fn(")
+		for i, p := range e.Parameters {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.write(p.Value)
+		}
+		f.write(") ")
+		f.block(e.Body)
+	case *CallExpression:
+		if index, ok := e.Function.(*IndexExpression); ok && index.Token.Type == token.Dot {
+			// "h.f(x)" would read as a method call, which passes h as well.
+			f.write("(")
+			f.expression(e.Function, bindLowest)
+			f.write(")")
+		} else {
+			f.expression(e.Function, bindPostfix)
+		}
+		f.list("(", e.Arguments, ")")
+	case *MethodCallExpression:
+		f.expression(e.Receiver, bindPostfix)
+		f.write(".", e.Method.Value)
+		f.list("(", e.Arguments, ")")
+	case *ArrayLiteral:
+		f.list("[", e.Elements, "]")
+	case *IndexExpression:
+		f.expression(e.Left, bindPostfix)
+		if key, ok := e.Index.(*StringLiteral); ok && e.Token.Type == token.Dot {
+			f.write(".", key.Value)
+			return
+		}
+		f.write("[")
+		f.expression(e.Index, bindLowest)
+		f.write("]")
+	case *SliceExpression:
+		f.expression(e.Left, bindPostfix)
+		f.write("[")
+		f.expression(e.Low, bindTernary+1)
+		f.write(":")
+		f.expression(e.High, bindLowest)
+		f.write("]")
+	case *HashLiteral:
+		f.write("{")
+		for i, key := range e.OrderedKeys() {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(key, bindTernary+1)
+			f.write(": ")
+			f.expression(e.Pairs[key], bindLowest)
+		}
+		f.write("}")
+	}
+}
+
+func (f *formatter) ifExpression(e *IfExpression) {
+	f.write("if (")
+	f.expression(e.Condition, bindLowest)
+	f.write(") ")
+	f.block(e.Consequence)
+	if nested := e.ElseIf(); nested != nil {
+		f.write(" else ")
+		f.ifExpression(nested)
+	} else if e.Alternative != nil {
+		f.write(" else ")
+		f.block(e.Alternative)
+	}
+}
+
+// list writes elements separated by commas between the open and close delimiters.
+func (f *formatter) list(open string, elements []Expression, closing string) {
+	f.write(open)
+	for i, e := range elements {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.expression(e, bindLowest)
+	}
+	f.write(closing)
+}
+
+// quote returns s as a string literal, escaping the characters the lexer unescapes,
+// and other control characters as hex escapes.
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case 0:
+			out.WriteString(`\0`)
+		default:
+			if c < ' ' || c == 0x7f {
+				out.WriteString(`\x`)
+				out.WriteByte("0123456789abcdef"[c>>4])
+				out.WriteByte("0123456789abcdef"[c&0xf])
+			} else {
+				out.WriteByte(c)
+			}
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/dr8co/kong/token"
+)
+
+// TestFormatExpressions verifies that Format parenthesizes operands only where the tree requires it.
+func TestFormatExpressions(t *testing.T) {
+	negate := func(e Expression) *PrefixExpression { return &PrefixExpression{Operator: "-", Right: e} }
+	grouped := func(e *InfixExpression) *InfixExpression {
+		e.Parenthesized = true
+		return e
+	}
+	ternary := func(c, a, b Expression) *TernaryExpression {
+		return &TernaryExpression{Condition: c, Consequence: a, Alternative: b}
+	}
+
+	tests := []struct {
+		expression Expression
+		expected   string
+	}{
+		{infix(infix(integer(1), "+", integer(2)), "*", integer(3)), "(1 + 2) * 3"},
+		{infix(integer(1), "+", infix(integer(2), "*", integer(3))), "1 + 2 * 3"},
+		{infix(infix(integer(1), "-", integer(2)), "-", integer(3)), "1 - 2 - 3"},
+		{infix(integer(1), "%", infix(integer(2), "*", integer(3))), "1 % (2 * 3)"},
+		{infix(integer(1), "-", infix(integer(2), "-", integer(3))), "1 - (2 - 3)"},
+		{infix(ident("a"), "-", negate(ident("b"))), "a - -b"},
+		{negate(negate(ident("x"))), "-(-x)"},
+		{infix(grouped(infix(ident("a"), "<", ident("b"))), "<", ident("c")), "(a < b) < c"},
+		{infix(ident("a"), ">=", grouped(infix(ident("b"), "<", ident("c")))), "a >= (b < c)"},
+		{infix(infix(ident("a"), "<", ident("b")), "<", ident("c")), "a < b < c"},
+		{infix(grouped(infix(ident("a"), "<", ident("b"))), "==", ident("c")), "a < b == c"},
+		{grouped(infix(grouped(infix(ident("a"), "+", ident("b"))), "+", ident("c"))), "a + b + c"},
+		{negate(infix(ident("a"), "+", ident("b"))), "-(a + b)"},
+		{&IndexExpression{Left: negate(ident("a")), Index: integer(0)}, "(-a)[0]"},
+		{ternary(ident("a"), ident("b"), ternary(ident("c"), ident("d"), ident("e"))), "a ? b : c ? d : e"},
+		{ternary(ternary(ident("a"), ident("b"), ident("c")), ident("d"), ident("e")), "(a ? b : c) ? d : e"},
+		{
+			&CallExpression{
+				Function:  &IndexExpression{Token: token.Token{Type: token.Dot}, Left: ident("h"), Index: &StringLiteral{Value: "f"}},
+				Arguments: []Expression{integer(1)},
+			},
+			"(h.f)(1)",
+		},
+		{&StringLiteral{Value: "a \"b\"\n\\c"}, `"a \"b\"\n\\c"`},
+		{&StringLiteral{Value: "\x00\x01é\x7f"}, `"\0\x01é\x7f"`},
+		{&ArrayLiteral{}, "[]"},
+		{&HashLiteral{Pairs: map[Expression]Expression{}}, "{}"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.expression); got != tt.expected {
+			t.Errorf("wrong format. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+// TestFormatStatements verifies the layout of blocks, and the blank lines around multi-line statements.
+func TestFormatStatements(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.Let}, Name: ident("x"), Value: integer(1)},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition:   ident("x"),
+			Consequence: block(&BreakStatement{}),
+			Alternative: block(),
+		}},
+		&ExpressionStatement{Expression: &PrefixExpression{Operator: "-", Right: ident("x")}},
+		&IncDecStatement{Token: token.Token{Type: token.Inc, Literal: "++"}, Name: ident("x")},
+	}}
+
+	expected := "let x = 1;\n\nif (x) {\n\tbreak;\n} else {};\n\n-x;\nx++;\n"
+	if got := Format(program); got != expected {
+		t.Errorf("wrong format.\nwant=%q\ngot =%q", expected, got)
+	}
+}
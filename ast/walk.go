@@ -0,0 +1,104 @@
+package ast
+
+// Walk traverses the tree rooted at node depth-first, in source order.
+// It calls fn for each node, and descends into the node's children only if fn returns true.
+func Walk(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(child, fn)
+	}
+}
+
+// Children returns the direct children of node, in source order. Missing optional parts,
+// such as the alternative of an if expression without an else, are left out.
+func Children(node Node) []Node {
+	var children []Node
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if n != nil {
+				children = append(children, n)
+			}
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *LetStatement:
+		add(identifierNode(node.Name), node.Value)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *PrefixExpression:
+		add(node.Right)
+	case *InfixExpression:
+		add(node.Left, node.Right)
+	case *TernaryExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+	case *IfExpression:
+		add(node.Condition, blockNode(node.Consequence), blockNode(node.Alternative))
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			add(identifierNode(p))
+		}
+		add(blockNode(node.Body))
+	case *CallExpression:
+		add(node.Function)
+		for _, a := range node.Arguments {
+			add(a)
+		}
+	case *MethodCallExpression:
+		add(node.Receiver, identifierNode(node.Method))
+		for _, a := range node.Arguments {
+			add(a)
+		}
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			add(e)
+		}
+	case *IndexExpression:
+		add(node.Left, node.Index)
+	case *SliceExpression:
+		add(node.Left, node.Low, node.High)
+	case *HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			add(key, node.Pairs[key])
+		}
+	case *AssignStatement:
+		add(identifierNode(node.Name), node.Value)
+	case *IndexAssignStatement:
+		add(node.Left, node.Index, node.Value)
+	case *IncDecStatement:
+		add(identifierNode(node.Name))
+	case *WhileStatement:
+		add(node.Condition, blockNode(node.Body))
+	case *ForStatement:
+		add(node.Init, node.Condition, node.Post, blockNode(node.Body))
+	}
+	return children
+}
+
+// identifierNode returns id as a [Node], or nil if id is nil.
+func identifierNode(id *Identifier) Node {
+	if id == nil {
+		return nil
+	}
+	return id
+}
+
+// blockNode returns block as a [Node], or nil if block is nil.
+func blockNode(block *BlockStatement) Node {
+	if block == nil {
+		return nil
+	}
+	return block
+}
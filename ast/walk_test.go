@@ -0,0 +1,147 @@
+package ast
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/dr8co/kong/token"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.Ident, Literal: name}, Value: name}
+}
+
+func integer(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.Int, Literal: strconv.FormatInt(value, 10)}, Value: value}
+}
+
+func infix(left Expression, operator string, right Expression) *InfixExpression {
+	return &InfixExpression{Token: token.Token{Literal: operator}, Left: left, Operator: operator, Right: right}
+}
+
+func block(statements ...Statement) *BlockStatement {
+	return &BlockStatement{Token: token.Token{Type: token.Lbrace, Literal: "{"}, Statements: statements}
+}
+
+// sampleProgram builds the tree of
+//
+//	let add = fn(a, b) { a + b };
+//	if (add(1, 2) > 2) { {"k": [1, 2], true: add} } else { return null; }
+func sampleProgram() *Program {
+	call := &CallExpression{Function: ident("add"), Arguments: []Expression{integer(1), integer(2)}}
+	hash := &HashLiteral{Pairs: map[Expression]Expression{
+		&StringLiteral{Token: token.Token{Type: token.String, Literal: "k"}, Value: "k"}: &ArrayLiteral{
+			Elements: []Expression{integer(1), integer(2)},
+		},
+		&Boolean{Token: token.Token{Type: token.True, Literal: "true"}, Value: true}: ident("add"),
+	}}
+
+	return &Program{Statements: []Statement{
+		&LetStatement{
+			Name: ident("add"),
+			Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("a"), ident("b")},
+				Body:       block(&ExpressionStatement{Expression: infix(ident("a"), "+", ident("b"))}),
+			},
+		},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition:   infix(call, ">", integer(2)),
+			Consequence: block(&ExpressionStatement{Expression: hash}),
+			Alternative: block(&ReturnStatement{ReturnValue: &NullLiteral{Token: token.Token{Literal: "null"}}}),
+		}},
+	}}
+}
+
+// countNodes walks node and counts the visited nodes by type, descending into a node only if descend returns true.
+func countNodes(node Node, descend func(Node) bool) map[string]int {
+	counts := map[string]int{}
+	Walk(node, func(n Node) bool {
+		counts[fmt.Sprintf("%T", n)]++
+		return descend(n)
+	})
+	return counts
+}
+
+// TestWalk verifies that Walk visits every node of a program, including hash pairs, call arguments
+// and nested blocks.
+func TestWalk(t *testing.T) {
+	expected := map[string]int{
+		"*ast.Program":             1,
+		"*ast.LetStatement":        1,
+		"*ast.ExpressionStatement": 3,
+		"*ast.ReturnStatement":     1,
+		"*ast.BlockStatement":      3,
+		"*ast.FunctionLiteral":     1,
+		"*ast.IfExpression":        1,
+		"*ast.InfixExpression":     2,
+		"*ast.CallExpression":      1,
+		"*ast.HashLiteral":         1,
+		"*ast.ArrayLiteral":        1,
+		"*ast.Identifier":          7,
+		"*ast.IntegerLiteral":      5,
+		"*ast.StringLiteral":       1,
+		"*ast.Boolean":             1,
+		"*ast.NullLiteral":         1,
+	}
+
+	counts := countNodes(sampleProgram(), func(Node) bool { return true })
+	if !maps.Equal(counts, expected) {
+		t.Errorf("wrong node counts.\nwant=%v\ngot =%v", expected, counts)
+	}
+}
+
+// TestWalkOrder verifies that Walk visits a node before its children, and children in source order.
+func TestWalkOrder(t *testing.T) {
+	call := &CallExpression{Function: ident("f"), Arguments: []Expression{integer(1), integer(2)}}
+	var visited []string
+	Walk(infix(call, ">", integer(3)), func(n Node) bool {
+		visited = append(visited, n.String())
+		return true
+	})
+
+	expected := []string{"(f(1, 2) > 3)", "f(1, 2)", "f", "1", "2", "3"}
+	if !slices.Equal(visited, expected) {
+		t.Errorf("wrong visiting order. want=%q, got=%q", expected, visited)
+	}
+}
+
+// TestWalkStop verifies that returning false from the callback skips the children of a node,
+// but not its siblings.
+func TestWalkStop(t *testing.T) {
+	counts := countNodes(sampleProgram(), func(n Node) bool {
+		_, isFunction := n.(*FunctionLiteral)
+		_, isHash := n.(*HashLiteral)
+		return !isFunction && !isHash
+	})
+
+	expected := map[string]int{
+		"*ast.Program":             1,
+		"*ast.LetStatement":        1,
+		"*ast.ExpressionStatement": 2,
+		"*ast.ReturnStatement":     1,
+		"*ast.BlockStatement":      2,
+		"*ast.FunctionLiteral":     1,
+		"*ast.IfExpression":        1,
+		"*ast.InfixExpression":     1,
+		"*ast.CallExpression":      1,
+		"*ast.HashLiteral":         1,
+		"*ast.Identifier":          2,
+		"*ast.IntegerLiteral":      3,
+		"*ast.NullLiteral":         1,
+	}
+	if !maps.Equal(counts, expected) {
+		t.Errorf("wrong node counts.\nwant=%v\ngot =%v", expected, counts)
+	}
+
+	visited := 0
+	Walk(sampleProgram(), func(Node) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("expected only the root to be visited, got %d nodes", visited)
+	}
+}
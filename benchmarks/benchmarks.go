@@ -0,0 +1,99 @@
+// Package benchmarks provides Monkey programs for measuring the performance of the interpreter.
+//
+// Each [Program] goes through the whole pipeline: it is lexed, parsed, compiled and run by the virtual machine.
+// The Go benchmarks of this package time the programs, and the --benchmark mode of the kong command
+// runs them as a quick check for performance regressions.
+package benchmarks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dr8co/kong/compiler"
+	"github.com/dr8co/kong/lexer"
+	"github.com/dr8co/kong/parser"
+	"github.com/dr8co/kong/vm"
+)
+
+// Program is a Monkey program used as a benchmark workload.
+type Program struct {
+	// Name identifies the program in reports.
+	Name string
+
+	// Source is the Monkey source code of the program.
+	Source string
+
+	// Result is the inspected value of the program's last expression, which shows that it ran correctly.
+	Result string
+}
+
+// Fibonacci computes a Fibonacci number recursively, which mostly measures function calls.
+var Fibonacci = Program{
+	Name: "fibonacci",
+	Source: `
+let fibonacci = fn(n) {
+	if (n < 2) { return n; }
+	fibonacci(n - 1) + fibonacci(n - 2)
+};
+fibonacci(25);
+`,
+	Result: "75025",
+}
+
+// ArraySum sums the elements of a large array in a loop, which mostly measures indexing and arithmetic.
+var ArraySum = Program{
+	Name: "array-sum",
+	Source: `
+let numbers = range(100000);
+let sum = 0;
+for (let i = 0; i < len(numbers); i++) {
+	sum += numbers[i];
+}
+sum;
+`,
+	Result: "4999950000",
+}
+
+// Programs lists the benchmark programs.
+var Programs = []Program{Fibonacci, ArraySum}
+
+// Compile lexes, parses and compiles the program.
+func (p Program) Compile() (*compiler.Bytecode, error) {
+	par := parser.New(lexer.New(p.Source))
+	program := par.ParseProgram()
+	if len(par.Errors()) != 0 {
+		return nil, errors.New("parser errors:\n\t" + strings.Join(par.Errors(), "\n\t"))
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("compilation error: %w", err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// Run runs the compiled program, returning an error if it fails or ends with a value other than p.Result.
+func (p Program) Run(bytecode *compiler.Bytecode) error {
+	machine := vm.New(bytecode)
+	err := machine.Run()
+	if err != nil {
+		return fmt.Errorf("VM error: %w", err)
+	}
+
+	result := machine.LastPoppedStackItem()
+	if result == nil || result.Inspect() != p.Result {
+		return fmt.Errorf("%s: wrong result. want=%s, got=%v", p.Name, p.Result, result)
+	}
+	return nil
+}
+
+// Execute compiles and runs the program, as [Program.Compile] and [Program.Run] do.
+func (p Program) Execute() error {
+	bytecode, err := p.Compile()
+	if err != nil {
+		return err
+	}
+	return p.Run(bytecode)
+}
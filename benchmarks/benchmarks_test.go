@@ -0,0 +1,46 @@
+package benchmarks
+
+import "testing"
+
+// TestPrograms verifies that every benchmark program runs and ends with its expected result.
+func TestPrograms(t *testing.T) {
+	for _, p := range Programs {
+		err := p.Execute()
+		if err != nil {
+			t.Errorf("%s: %s", p.Name, err)
+		}
+	}
+}
+
+// benchmarkPipeline times lexing, parsing, compiling and running the program.
+func benchmarkPipeline(b *testing.B, p Program) {
+	b.ReportAllocs()
+	for b.Loop() {
+		err := p.Execute()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkRun times only running the program, which is compiled before the timer starts.
+func benchmarkRun(b *testing.B, p Program) {
+	bytecode, err := p.Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		err := p.Run(bytecode)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B)    { benchmarkPipeline(b, Fibonacci) }
+func BenchmarkFibonacciRun(b *testing.B) { benchmarkRun(b, Fibonacci) }
+func BenchmarkArraySum(b *testing.B)     { benchmarkPipeline(b, ArraySum) }
+func BenchmarkArraySumRun(b *testing.B)  { benchmarkRun(b, ArraySum) }
@@ -186,6 +186,78 @@ const (
 	//
 	// Stack: [] -> [current_closure]
 	OpCurrentClosure
+
+	// OpSlice pops the high and low bounds and a collection from the stack, and pushes the slice between the bounds.
+	// A null bound stands for the start or the end of the collection.
+	//
+	// Stack: [collection, low, high] -> [collection[low:high]]
+	OpSlice
+
+	// OpDup pushes copies of the specified number of values at the top of the stack, keeping their order.
+	//
+	// Operands: [count:1] - 1-byte number of values to duplicate.
+	//
+	// Stack: [a, b] -> [a, b, a, b] (with a count of 2)
+	OpDup
+
+	// OpSwap exchanges the two values at the top of the stack.
+	//
+	// Stack: [a, b] -> [b, a]
+	OpSwap
+
+	// OpSetIndex pops a value, an index and a collection from the stack, and stores the value
+	// in the collection at the index, modifying the collection in place.
+	//
+	// Stack: [collection, index, value] -> []
+	OpSetIndex
+
+	// OpIn pops a collection and a value from the stack, and pushes whether the value is in the collection:
+	// an element of an array, a key of a hash, or a substring of a string.
+	//
+	// Stack: [value, collection] -> [result]
+	OpIn
+
+	// OpAddImmediate pops a value from the stack, adds a small non-negative integer to it, and pushes the result.
+	// It does the work of an OpConstant loading the integer followed by an OpAdd, without the constant pool lookup.
+	//
+	// Operands: [value:2] - 2-byte integer to add.
+	//
+	// Stack: [a] -> [a + value]
+	OpAddImmediate
+
+	// OpTailCall calls a function like OpCall, for a call whose result the current function returns right away.
+	// A call of the current closure reuses the current frame instead of pushing a new one.
+	//
+	// Operands: [num_args:1] - 1-byte count of arguments on the stack.
+	//
+	// Stack: [func, arg1, arg2, ..., argN] -> [return_value]
+	OpTailCall
+
+	// OpMod pops two values from the stack, and pushes the remainder of dividing the first by the second.
+	//
+	// Stack: [a, b] -> [a % b]
+	OpMod
+
+	// OpLessThan pops two values from the stack, compares them, and pushes true if the first is less.
+	//
+	// Stack: [a, b] -> [a < b]
+	OpLessThan
+
+	// OpLessEqual pops two values from the stack, compares them, and pushes true if the first is less or equal.
+	//
+	// Stack: [a, b] -> [a <= b]
+	OpLessEqual
+
+	// OpGreaterEqual pops two values from the stack, compares them, and pushes true if the first is greater or equal.
+	//
+	// Stack: [a, b] -> [a >= b]
+	OpGreaterEqual
+
+	// OpBindSelf pops the wrapper of the closure below it, such as the result of an annotation,
+	// and replaces the closure with the wrapper. OpCurrentClosure in the closure then pushes the wrapper.
+	//
+	// Stack: [closure, wrapper] -> [wrapper]
+	OpBindSelf
 )
 
 // Definition represents an instruction definition with its name and operand widths.
@@ -229,8 +301,23 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpDup:            {"OpDup", []int{1}},
+	OpSwap:           {"OpSwap", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpIn:             {"OpIn", []int{}},
+	OpAddImmediate:   {"OpAddImmediate", []int{2}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpMod:            {"OpMod", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpLessEqual:      {"OpLessEqual", []int{}},
+	OpGreaterEqual:   {"OpGreaterEqual", []int{}},
+	OpBindSelf:       {"OpBindSelf", []int{}},
 }
 
+// OpcodeCount returns the number of opcodes defined by this build of the instruction set.
+func OpcodeCount() int { return len(definitions) }
+
 // Lookup returns the [Definition] for the given [Opcode].
 func Lookup(op byte) (*Definition, error) {
 	def, ok := definitions[Opcode(op)]
@@ -277,6 +364,7 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			_, _ = fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
 		operands, read := ReadOperands(def, ins[i+1:])
@@ -324,6 +412,35 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+// ForEachInstruction calls f with the offset, opcode and operands of each instruction in ins, in order,
+// and returns the first error f returns.
+//
+// An undefined opcode or a truncated instruction stops the iteration with an error,
+// since the rest of ins cannot be decoded.
+func ForEachInstruction(ins Instructions, f func(offset int, op Opcode, operands []int) error) error {
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("at offset %d: %w", i, err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("at offset %d: truncated %s instruction", i, def.Name)
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		err = f(i, Opcode(ins[i]), operands)
+		if err != nil {
+			return err
+		}
+		i += 1 + read
+	}
+	return nil
+}
+
 // ReadUint16 decodes the first two bytes of the provided [Instructions] as uint16 in big-endian format.
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
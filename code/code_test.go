@@ -1,6 +1,11 @@
 package code
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
 
 // TestMake tests the [Make] function.
 func TestMake(t *testing.T) {
@@ -13,6 +18,10 @@ func TestMake(t *testing.T) {
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpDup, []int{2}, []byte{byte(OpDup), 2}},
+		{OpSwap, []int{}, []byte{byte(OpSwap)}},
+		{OpSetIndex, []int{}, []byte{byte(OpSetIndex)}},
+		{OpAddImmediate, []int{258}, []byte{byte(OpAddImmediate), 1, 2}},
 	}
 	for _, tt := range tests {
 		instruction := Make(tt.op, tt.operands...)
@@ -37,12 +46,18 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
 		Make(OpClosure, 65535, 255),
+		Make(OpDup, 2),
+		Make(OpSwap),
+		Make(OpSetIndex),
 	}
 	expected := `0000 OpAdd
 0001 OpGetLocal 1
 0003 OpConstant 2
 0006 OpConstant 65535
 0009 OpClosure 65535 255
+0013 OpDup 2
+0015 OpSwap
+0016 OpSetIndex
 `
 	concatenated := Instructions{}
 	for _, ins := range instructions {
@@ -55,6 +70,16 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+// TestInstructionsStringUndefinedOpcode tests that [Instructions.String] reports undefined opcodes and keeps going.
+func TestInstructionsStringUndefinedOpcode(t *testing.T) {
+	instructions := append(Instructions{255}, Make(OpAdd)...)
+
+	expected := "ERROR: opcode 255 undefined\n0001 OpAdd\n"
+	if instructions.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, instructions.String())
+	}
+}
+
 // TestReadOperands tests the [ReadOperands] function.
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
@@ -65,6 +90,8 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpDup, []int{2}, 1},
+		{OpSwap, []int{}, 0},
 	}
 
 	for _, tt := range tests {
@@ -87,3 +114,47 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+// TestForEachInstruction verifies that instructions are decoded in order with their offsets and operands,
+// and that undefined opcodes, truncated instructions and errors of the callback stop the iteration.
+func TestForEachInstruction(t *testing.T) {
+	ins := slices.Concat(Make(OpConstant, 65534), Make(OpPop), Make(OpClosure, 2, 3))
+
+	type instruction struct {
+		offset   int
+		op       Opcode
+		operands []int
+	}
+	var got []instruction
+	err := ForEachInstruction(ins, func(offset int, op Opcode, operands []int) error {
+		got = append(got, instruction{offset, op, operands})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []instruction{{0, OpConstant, []int{65534}}, {3, OpPop, []int{}}, {4, OpClosure, []int{2, 3}}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong instructions. want=%v, got=%v", expected, got)
+	}
+
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{slices.Concat(Make(OpPop), Instructions{255}), "at offset 1: opcode 255 undefined"},
+		{Make(OpConstant, 1)[:2], "at offset 0: truncated OpConstant instruction"},
+		{slices.Concat(Make(OpPop), Make(OpJump, 0)), "stop at 1"},
+	}
+	for _, tt := range tests {
+		err := ForEachInstruction(tt.ins, func(offset int, op Opcode, _ []int) error {
+			if op == OpJump {
+				return fmt.Errorf("stop at %d", offset)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package code
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// SourceSpan locates a piece of source code by the line and column of its first byte, both starting at 1,
+// and its length in bytes.
+type SourceSpan struct {
+	Line   int
+	Column int
+	Length int
+}
+
+// String returns the position of the span as "line:column".
+func (s SourceSpan) String() string {
+	return fmt.Sprintf("%d:%d", s.Line, s.Column)
+}
+
+// SourceMap maps the offsets of instructions to the source code they were compiled from.
+// Instructions that do not correspond to any source code, like those of tests built by hand, are absent.
+type SourceMap map[int]SourceSpan
+
+// Offsets returns the instruction offsets in the source map, in ascending order.
+func (m SourceMap) Offsets() []int {
+	return slices.Sorted(maps.Keys(m))
+}
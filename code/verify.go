@@ -0,0 +1,44 @@
+package code
+
+import "fmt"
+
+// Verify checks that ins is a well-formed instruction stream referring to a pool of numConstants constants,
+// so that a virtual machine can run it without reading past its end or out of the pool.
+//
+// Every opcode must be defined and followed by all of its operand bytes, every jump must land on the
+// start of an instruction or at the end of the stream, and every constant index must be in range.
+// Global indices need no check, since their two-byte operands cannot exceed the 65536 globals of the
+// virtual machine.
+func Verify(ins Instructions, numConstants int) error {
+	// starts marks the offsets at which an instruction starts, plus the end of the stream.
+	starts := make([]bool, len(ins)+1)
+	starts[len(ins)] = true
+	var jumps []int
+
+	err := ForEachInstruction(ins, func(i int, op Opcode, operands []int) error {
+		starts[i] = true
+
+		switch op {
+		case OpConstant, OpClosure:
+			if operands[0] >= numConstants {
+				return fmt.Errorf("at offset %d: constant index %d out of range (pool has %d constants)",
+					i, operands[0], numConstants)
+			}
+		case OpJump, OpJumpNotTruthy:
+			jumps = append(jumps, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Jumps may go forward, so their targets are checked once all the instructions are known.
+	for _, i := range jumps {
+		target := int(ReadUint16(ins[i+1:]))
+		if target >= len(starts) || !starts[target] {
+			return fmt.Errorf("at offset %d: jump target %d is not the start of an instruction", i, target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package code
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestVerify tests that [Verify] accepts well-formed instructions and reports the first problem in malformed ones.
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name         string
+		ins          Instructions
+		numConstants int
+		expected     string
+	}{
+		{
+			name: "valid",
+			ins: slices.Concat(
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpPop),
+			),
+			numConstants: 1,
+		},
+		{
+			name:         "jump to end",
+			ins:          Make(OpJump, 3),
+			numConstants: 0,
+		},
+		{
+			name:     "undefined opcode",
+			ins:      Instructions{255},
+			expected: "at offset 0: opcode 255 undefined",
+		},
+		{
+			name:     "truncated operand",
+			ins:      slices.Concat(Make(OpPop), Make(OpConstant, 0)[:2]),
+			expected: "at offset 1: truncated OpConstant instruction",
+		},
+		{
+			name:         "constant out of range",
+			ins:          slices.Concat(Make(OpConstant, 0), Make(OpConstant, 2)),
+			numConstants: 2,
+			expected:     "at offset 3: constant index 2 out of range (pool has 2 constants)",
+		},
+		{
+			name:     "closure constant out of range",
+			ins:      Make(OpClosure, 0, 0),
+			expected: "at offset 0: constant index 0 out of range (pool has 0 constants)",
+		},
+		{
+			name:     "jump into operand",
+			ins:      slices.Concat(Make(OpJump, 4), Make(OpGetGlobal, 0)),
+			expected: "at offset 0: jump target 4 is not the start of an instruction",
+		},
+		{
+			name:     "jump past end",
+			ins:      slices.Concat(Make(OpNull), Make(OpJumpNotTruthy, 5)),
+			expected: "at offset 1: jump target 5 is not the start of an instruction",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.ins, tt.numConstants)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected error, got none", tt.name)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/object"
+)
+
+// CompactConstants returns a copy of the bytecode without the constants that no instruction refers to,
+// such as those left in hand-assembled or edited bytecode, with the remaining constants renumbered.
+//
+// Constants are referenced by the OpConstant and OpClosure instructions of the program and of the
+// compiled functions it reaches, which are scanned in turn. The remaining constants keep their order,
+// and compiled functions are copied with their instructions rewritten, so b itself is left unchanged.
+//
+// Bytecode compiled for a REPL session should not be compacted, since later inputs refer to
+// constants by their original indices.
+func (b *Bytecode) CompactConstants() (*Bytecode, error) {
+	used := make([]bool, len(b.Constants))
+	pending := []code.Instructions{b.Instructions}
+	for len(pending) > 0 {
+		ins := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		err := forEachConstant(ins, func(index int) error {
+			if index >= len(b.Constants) {
+				return fmt.Errorf("constant index %d out of range (pool has %d constants)", index, len(b.Constants))
+			}
+			if used[index] {
+				return nil
+			}
+			used[index] = true
+			if fn, ok := b.Constants[index].(*object.CompiledFunction); ok {
+				pending = append(pending, fn.Instructions)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newIndex := make([]int, len(b.Constants))
+	constants := make([]object.Object, 0, len(b.Constants))
+	for i, c := range b.Constants {
+		if used[i] {
+			newIndex[i] = len(constants)
+			constants = append(constants, c)
+		}
+	}
+
+	for i, c := range constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		compacted := *fn
+		compacted.Instructions = renumberConstants(fn.Instructions, newIndex)
+		constants[i] = &compacted
+	}
+
+	return &Bytecode{
+		Instructions: renumberConstants(b.Instructions, newIndex),
+		Constants:    constants,
+		SourceMap:    b.SourceMap,
+	}, nil
+}
+
+// forEachConstant calls f with the constant index of each OpConstant and OpClosure instruction in ins.
+func forEachConstant(ins code.Instructions, f func(index int) error) error {
+	return code.ForEachInstruction(ins, func(_ int, op code.Opcode, operands []int) error {
+		if op == code.OpConstant || op == code.OpClosure {
+			return f(operands[0])
+		}
+		return nil
+	})
+}
+
+// renumberConstants returns a copy of ins with the constant index of each OpConstant and OpClosure
+// instruction replaced by its entry in newIndex. The instructions must have been checked by forEachConstant.
+func renumberConstants(ins code.Instructions, newIndex []int) code.Instructions {
+	out := make(code.Instructions, len(ins))
+	copy(out, ins)
+
+	// The instructions have been checked, so decoding them does not fail.
+	_ = code.ForEachInstruction(ins, func(i int, op code.Opcode, operands []int) error {
+		if op == code.OpConstant || op == code.OpClosure {
+			operands[0] = newIndex[operands[0]]
+			copy(out[i:], code.Make(op, operands...))
+		}
+		return nil
+	})
+	return out
+}
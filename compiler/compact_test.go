@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/object"
+)
+
+// TestCompactConstants verifies that constants no instruction refers to are removed, in the program and in functions,
+// and that the remaining constant indices are rewritten.
+func TestCompactConstants(t *testing.T) {
+	// The bytecode of `let f = fn(x) { x * 5 }; f(2) * 3;`, with 100 and 42 left over in the pool.
+	bytecode := &Bytecode{
+		Instructions: concatInstructions([]code.Instructions{
+			code.Make(code.OpClosure, 2, 0),
+			code.Make(code.OpSetGlobal, 0),
+			code.Make(code.OpGetGlobal, 0),
+			code.Make(code.OpConstant, 4),
+			code.Make(code.OpCall, 1),
+			code.Make(code.OpConstant, 5),
+			code.Make(code.OpMul),
+			code.Make(code.OpPop),
+		}),
+		Constants: []object.Object{
+			&object.Integer{Value: 100},
+			&object.Integer{Value: 5},
+			&object.CompiledFunction{
+				Instructions: concatInstructions([]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMul),
+					code.Make(code.OpReturnValue),
+				}),
+				NumLocals:     1,
+				NumParameters: 1,
+			},
+			&object.Integer{Value: 42},
+			&object.Integer{Value: 2},
+			&object.Integer{Value: 3},
+		},
+	}
+	original := bytecode.Instructions.String()
+
+	compacted, err := bytecode.CompactConstants()
+	if err != nil {
+		t.Fatalf("compaction error: %s", err)
+	}
+
+	if len(bytecode.Constants) != 6 {
+		t.Fatalf("wrong number of constants before compaction. want=6, got=%d", len(bytecode.Constants))
+	}
+	if len(compacted.Constants) != 4 {
+		t.Fatalf("wrong number of constants after compaction. want=4, got=%d", len(compacted.Constants))
+	}
+	for i, want := range map[int]int64{0: 5, 2: 2, 3: 3} {
+		err := testIntegerObject(want, compacted.Constants[i])
+		if err != nil {
+			t.Errorf("constant %d: %s", i, err)
+		}
+	}
+
+	fn, ok := compacted.Constants[1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 1 is not a CompiledFunction. got=%T", compacted.Constants[1])
+	}
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpMul),
+		code.Make(code.OpReturnValue),
+	}, fn.Instructions)
+	if err != nil {
+		t.Errorf("wrong function instructions: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 1, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpConstant, 3),
+		code.Make(code.OpMul),
+		code.Make(code.OpPop),
+	}, compacted.Instructions)
+	if err != nil {
+		t.Errorf("wrong program instructions: %s", err)
+	}
+
+	// The original bytecode is left unchanged.
+	if bytecode.Instructions.String() != original || len(bytecode.Constants) != 6 {
+		t.Errorf("original bytecode was modified")
+	}
+	if !strings.Contains(bytecode.Constants[2].(*object.CompiledFunction).Instructions.String(), "OpConstant 1") {
+		t.Errorf("original function instructions were modified")
+	}
+}
+
+// TestCompactConstantsErrors verifies that malformed instructions are reported instead of compacted.
+func TestCompactConstantsErrors(t *testing.T) {
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 1), Constants: []object.Object{&object.Integer{Value: 1}}},
+			"constant index 1 out of range (pool has 1 constants)",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2]},
+			"at offset 0: truncated OpConstant instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Instructions{255}},
+			"at offset 0: opcode 255 undefined",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.bytecode.CompactConstants()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
@@ -11,8 +11,10 @@
 //
 //   - Multiple compilation scopes for nested functions and closures
 //   - Symbol tables for variable resolution (local, global, free, and builtin variables)
-//   - Constant pooling for literals and compiled functions
-//   - Optimizations such as replacing tail OpPop with OpReturn
+//   - Constant pooling for literals and compiled functions, with equal literals sharing one constant
+//   - Optimizations such as folding expressions of literals, dropping statements after a return,
+//     break or continue, replacing tail OpPop with OpReturn, and turning calls a function returns
+//     to itself into OpTailCall
 //
 // # Compilation Process
 //
@@ -21,7 +23,7 @@
 //  1. Expressions are compiled to push their results onto the stack
 //  2. Operators pop operands from the stack and push results
 //  3. Variables are resolved through symbol tables and compiled to load/store instructions
-//  4. Control flow (if/else) is compiled using conditional and unconditional jumps
+//  4. Control flow (if/else, loops) is compiled using conditional and unconditional jumps
 //  5. Functions are compiled in separate scopes and stored as constants
 //  6. Closures capture free variables from enclosing scopes
 //
@@ -35,13 +37,15 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"slices"
-	"strings"
 
 	"github.com/dr8co/kong/ast"
 	"github.com/dr8co/kong/code"
 	"github.com/dr8co/kong/object"
+	"github.com/dr8co/kong/token"
 )
 
 // Compiler is responsible for compiling an AST into bytecode instructions and managing compilation states.
@@ -57,6 +61,65 @@ type Compiler struct {
 
 	// scopeIndex tracks the current compilation scope.
 	scopeIndex int
+
+	// internedConstants maps the keys of integer, string and boolean constants to their index in the constant pool,
+	// so repeated literals share one constant.
+	internedConstants map[any]int
+
+	// position is the source span of the node being compiled, recorded in the source map of each emitted instruction.
+	position code.SourceSpan
+
+	// debugInfo makes the compiler record the names of local variables in compiled functions.
+	debugInfo bool
+
+	// warnShadow makes the compiler warn about parameters and locals that shadow outer variables.
+	warnShadow bool
+
+	// treeShake makes the compiler leave unused top-level functions out of the bytecode.
+	treeShake bool
+
+	// warnings holds the warnings reported so far.
+	warnings []string
+}
+
+// Option configures optional behavior of a [Compiler].
+type Option func(*Compiler)
+
+// WithDebugInfo makes the compiler record information that is only needed for debugging,
+// like the names of the local variables of each function (see [object.CompiledFunction]).
+// It is off by default, to save memory.
+func WithDebugInfo() Option {
+	return func(c *Compiler) {
+		c.debugInfo = true
+	}
+}
+
+// WithShadowWarnings makes the compiler warn when a function parameter or a local variable
+// shadows a variable of an enclosing scope: a global, or a local of an enclosing function.
+// Shadowing a builtin function is not reported.
+// The warnings are available from [Compiler.Warnings]. It is off by default.
+func WithShadowWarnings() Option {
+	return func(c *Compiler) {
+		c.warnShadow = true
+	}
+}
+
+// MaxConstants is the number of constants that instructions can refer to, limited by the two-byte
+// constant index operand of OpConstant and OpClosure.
+const MaxConstants = 1 << 16
+
+// WithTreeShaking makes the compiler leave the top-level functions that a program never uses
+// out of its bytecode. A function is used if the rest of the program refers to it by name,
+// directly or through other used functions.
+//
+// Unused functions are still compiled, so that their errors and warnings are reported,
+// but neither their instructions nor their constants are kept.
+// Since the analysis only sees the program being compiled, the option is not suited to code
+// compiled in parts, like the inputs of a REPL session.
+func WithTreeShaking() Option {
+	return func(c *Compiler) {
+		c.treeShake = true
+	}
 }
 
 // Bytecode represents the compiled instructions and constants for a program or function.
@@ -66,6 +129,10 @@ type Bytecode struct {
 
 	// Contains the constant values used in the bytecode, represented as a slice of objects.
 	Constants []object.Object
+
+	// SourceMap maps the offsets of the instructions to the source code they were compiled from.
+	// Compiled functions in the constant pool carry their own source maps.
+	SourceMap code.SourceMap
 }
 
 // EmittedInstruction represents a bytecode instruction that has been emitted during compilation.
@@ -87,6 +154,29 @@ type CompilationScope struct {
 
 	// previousInstruction tracks the second most recently emitted bytecode instruction in the current compilation scope.
 	previousInstruction EmittedInstruction
+
+	// lastSelfCall is the most recent OpCall instruction that calls the function being compiled,
+	// which becomes an OpTailCall if its result is returned right away.
+	lastSelfCall EmittedInstruction
+
+	// loops holds the loops being compiled in this scope, innermost last.
+	loops []*loopContext
+
+	// sourceMap maps the offsets of the scope's instructions to their source code.
+	sourceMap code.SourceMap
+}
+
+// loopContext tracks the jumps emitted by break and continue statements inside a loop,
+// so they can be patched once the loop's exit and continue positions are known.
+type loopContext struct {
+	// label is the name given to the loop, or empty if the loop is unlabeled.
+	label string
+
+	// breaks holds the positions of the jumps that leave the loop.
+	breaks []int
+
+	// continues holds the positions of the jumps to the next iteration.
+	continues []int
 }
 
 // newCompilationScope creates a new compilation scope with an empty instruction sequence.
@@ -95,41 +185,76 @@ func newCompilationScope() CompilationScope {
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		sourceMap:           code.SourceMap{},
 	}
 }
 
-// New creates a new compiler instance.
-func New() *Compiler {
+// New creates a new compiler instance with the given options.
+func New(opts ...Option) *Compiler {
 	symbolTable := NewSymbolTable()
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
 
-	return &Compiler{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes:      []CompilationScope{newCompilationScope()},
-		scopeIndex:  0,
+	c := &Compiler{
+		constants:         []object.Object{},
+		symbolTable:       symbolTable,
+		scopes:            []CompilationScope{newCompilationScope()},
+		scopeIndex:        0,
+		internedConstants: make(map[any]int),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
-// NewWithState creates a new compiler instance with a pre-defined symbol table and constant pool.
-func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
-	return &Compiler{
-		constants:   constants,
-		symbolTable: s,
-		scopes:      []CompilationScope{newCompilationScope()},
-		scopeIndex:  0,
+// NewWithState creates a new compiler instance with a pre-defined symbol table, constant pool and options.
+func NewWithState(s *SymbolTable, constants []object.Object, opts ...Option) *Compiler {
+	internedConstants := make(map[any]int)
+	for i, c := range constants {
+		if key, ok := internKey(c); ok {
+			if _, seen := internedConstants[key]; !seen {
+				internedConstants[key] = i
+			}
+		}
+	}
+
+	c := &Compiler{
+		constants:         constants,
+		symbolTable:       s,
+		scopes:            []CompilationScope{newCompilationScope()},
+		scopeIndex:        0,
+		internedConstants: internedConstants,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // Compile traverses the given AST node and translates it into bytecode instructions for interpretation.
 //
 //nolint:gocyclo
 func (c *Compiler) Compile(node ast.Node) error {
+	if span, ok := sourceSpan(node); ok {
+		defer c.setPosition(c.setPosition(span))
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
+		var unused map[*ast.LetStatement]bool
+		if c.treeShake {
+			unused = unusedFunctions(node)
+		}
 		for _, s := range node.Statements {
+			if let, ok := s.(*ast.LetStatement); ok && unused[let] {
+				err := c.compileDiscarded(s)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			err := c.Compile(s)
 			if err != nil {
 				return err
@@ -144,16 +269,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
+		if isChainedComparison(node) {
+			return fmt.Errorf("chained comparison %s is not supported: compare each pair, as in `a < b ? b < c : false`",
+				ast.Format(node))
+		}
+		if value, ok := foldConstant(node); ok {
+			c.emitFolded(value)
 			return nil
 		}
 
@@ -162,6 +283,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		if value, ok := immediateOperand(node.Right); ok && node.Operator == "+" {
+			c.emit(code.OpAddImmediate, value)
+			return nil
+		}
+
 		err = c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -176,38 +302,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
 		case ">=":
-			// a >= b  <=> !(b > a)
-			// compile Right then Left then OpGreaterThan then OpBang
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			c.emit(code.OpBang)
+			c.emit(code.OpGreaterEqual)
 		case "<=":
-			// a <= b <=> !(a > b)
-			// compile Left then Right then OpGreaterThan then OpBang
-			err := c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			c.emit(code.OpBang)
+			c.emit(code.OpLessEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
+		case "in":
+			c.emit(code.OpIn)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
@@ -223,7 +333,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
 	case *ast.PrefixExpression:
+		if value, ok := foldConstant(node); ok {
+			c.emitFolded(value)
+			return nil
+		}
+
 		err := c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -250,12 +368,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
+		// A consequence that always returns, breaks or continues needs neither a value nor a jump over the alternative.
+		jumpPos := -1
+		if !blockLeaves(node.Consequence) {
+			c.keepBlockValue()
 
-		// Emit an `OpJump` with a bogus value
-		jumpPos := c.emit(code.OpJump, 9999)
+			// Emit an `OpJump` with a bogus value
+			jumpPos = c.emit(code.OpJump, 9999)
+		}
 		afterConsequencePos := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
 
@@ -266,32 +386,207 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
+			if !blockLeaves(node.Alternative) {
+				c.keepBlockValue()
 			}
 		}
-		afterAlternativePos := len(c.currentInstructions())
-		c.changeOperand(jumpPos, afterAlternativePos)
+		if jumpPos >= 0 {
+			afterAlternativePos := len(c.currentInstructions())
+			c.changeOperand(jumpPos, afterAlternativePos)
+		}
+
+	case *ast.TernaryExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
 
 	case *ast.BlockStatement:
-		for _, s := range node.Statements {
+		for i, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
+			if leavesBlock(s) {
+				return c.compileUnreachable(node.Statements[i+1:])
+			}
 		}
 
-	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+	case *ast.WhileStatement:
+		conditionPos := len(c.currentInstructions())
+		truthy, constant := constantCondition(node.Condition)
+
+		if constant && !truthy {
+			// The body never runs. It is still compiled, so that its errors are reported
+			// and the names it defines stay defined, but its instructions and constants are dropped.
+			numConstants := len(c.constants)
+			_, err := c.compileLoopBody(node.Body, node.Label)
+			if err != nil {
+				return err
+			}
+			c.discardCompiled(conditionPos, numConstants)
+			return nil
+		}
+
+		jumpNotTruthyPos := -1
+		if !constant {
+			err := c.Compile(node.Condition)
+			if err != nil {
+				return err
+			}
+			jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		loop, err := c.compileLoopBody(node.Body, node.Label)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, conditionPos)
+
+		// In a while loop, continue re-checks the condition.
+		c.patchLoop(loop, conditionPos, len(c.currentInstructions()))
+		if jumpNotTruthyPos != -1 {
+			c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		}
+
+	case *ast.ForStatement:
+		if node.Init != nil {
+			err := c.Compile(node.Init)
+			if err != nil {
+				return err
+			}
+		}
+
+		conditionPos := len(c.currentInstructions())
+		jumpNotTruthyPos := -1
+		if node.Condition != nil {
+			err := c.Compile(node.Condition)
+			if err != nil {
+				return err
+			}
+			jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		loop, err := c.compileLoopBody(node.Body, node.Label)
+		if err != nil {
+			return err
+		}
+
+		// In a for loop, continue must still run the post statement,
+		// otherwise the loop variable never advances.
+		postPos := len(c.currentInstructions())
+		if node.Post != nil {
+			err := c.Compile(node.Post)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpJump, conditionPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.patchLoop(loop, postPos, afterLoopPos)
+		if jumpNotTruthyPos >= 0 {
+			c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		}
+
+	case *ast.BreakStatement:
+		loop, err := c.targetLoop("break", node.Label)
+		if err != nil {
+			return err
+		}
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop, err := c.targetLoop("continue", node.Label)
+		if err != nil {
+			return err
+		}
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+
+	case *ast.AssignStatement:
+		symbol, err := c.assignableSymbol(node.Name)
+		if err != nil {
+			return err
+		}
+
+		if node.Token.Type != token.Assign {
+			c.loadSymbol(symbol)
+		}
+		err = c.compileAssignedValue(node.Token, node.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.IncDecStatement:
+		symbol, err := c.assignableSymbol(node.Name)
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
+
+		c.loadSymbol(symbol)
+		if node.Token.Type == token.Inc {
+			c.emit(code.OpAddImmediate, 1)
 		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 1}))
+			c.emit(code.OpSub)
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.IndexAssignStatement:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+		if node.Token.Type != token.Assign {
+			// Read the current element from copies of the collection and the index,
+			// so that neither expression is evaluated twice.
+			c.emit(code.OpDup, 2)
+			c.emit(code.OpIndex)
+		}
+		err = c.compileAssignedValue(node.Token, node.Value)
+		if err != nil {
+			return err
 		}
+		c.emit(code.OpSetIndex)
+
+	case *ast.LetStatement:
+		if c.symbolTable.definedConstant(node.Name.Value) {
+			return fmt.Errorf("cannot reassign constant %s", node.Name.Value)
+		}
+		if local, ok := c.symbolTable.store[node.Name.Value]; !ok || local.Scope != LocalScope {
+			c.checkShadowing("local", node.Name)
+		}
+		var symbol Symbol
+		if node.IsConst() {
+			symbol = c.symbolTable.DefineConstant(node.Name.Value)
+		} else {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
 
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
@@ -314,17 +609,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpArray, len(node.Elements))
 
 	case *ast.HashLiteral:
-		keys := make([]ast.Expression, 0, len(node.Pairs))
-
-		for k := range node.Pairs {
-			keys = append(keys, k)
+		// Literal keys are known to collide before the program runs.
+		literalKeys := make(map[any]bool)
+		for _, k := range node.OrderedKeys() {
+			key, ok := literalHashKey(k)
+			if !ok {
+				continue
+			}
+			if literalKeys[key] {
+				if s, isString := key.(string); isString {
+					return fmt.Errorf("duplicate hash key: %q", s)
+				}
+				return fmt.Errorf("duplicate hash key: %v", key)
+			}
+			literalKeys[key] = true
 		}
 
-		slices.SortFunc(keys, func(a, b ast.Expression) int {
-			return strings.Compare(a.String(), b.String())
-		})
-
-		for _, k := range keys {
+		// The pairs are emitted in source order, which the hash keeps.
+		for _, k := range node.OrderedKeys() {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -347,13 +649,53 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpIndex)
 
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+
 	case *ast.FunctionLiteral:
+		// Each annotation names a builtin that wraps the closure.
+		wrappers := make([]int, len(node.Annotations))
+		for i, name := range node.Annotations {
+			index, err := annotationBuiltin(name)
+			if err != nil {
+				return err
+			}
+			wrappers[i] = index
+		}
+
+		// A global annotated function refers to itself through its (wrapped) global binding,
+		// and a local one through the wrapper that OpBindSelf binds to its closure,
+		// so recursive calls go through the wrapper either way.
+		bindSelf := node.Name != "" && len(wrappers) > 0 && c.symbolTable.Outer != nil
+		selfBinding := node.Name != "" && (len(wrappers) == 0 || bindSelf)
+		if !bindSelf {
+			// The builtins are pushed first and called once the closure is on the stack.
+			for _, index := range wrappers {
+				c.emit(code.OpGetBuiltin, index)
+			}
+		}
+
 		c.enterScope()
-		if node.Name != "" {
+		if selfBinding {
 			c.symbolTable.DefineFunctionName(node.Name)
 		}
 
 		for _, param := range node.Parameters {
+			c.checkShadowing("parameter", param)
 			c.symbolTable.Define(param.Value)
 		}
 
@@ -370,6 +712,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		var localNames []string
+		if c.debugInfo {
+			localNames = c.symbolTable.localNames()
+		}
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
@@ -380,15 +727,37 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
+			LocalNames:    localNames,
 		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
 
+		if bindSelf {
+			// A copy of the closure stays below the wrappers, which are applied innermost first.
+			c.emit(code.OpDup, 1)
+			for _, index := range slices.Backward(wrappers) {
+				c.emit(code.OpGetBuiltin, index)
+				c.emit(code.OpSwap)
+				c.emit(code.OpCall, 1)
+			}
+			c.emit(code.OpBindSelf)
+		} else {
+			for range wrappers {
+				c.emit(code.OpCall, 1)
+			}
+		}
+
 	case *ast.ReturnStatement:
+		if c.scopeIndex == 0 {
+			return errors.New("return outside function")
+		}
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		c.markTailCall(c.scopes[c.scopeIndex].lastInstruction)
 		c.emit(code.OpReturnValue)
 
 	case *ast.CallExpression:
@@ -396,28 +765,384 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		// A function refers to itself by name with OpCurrentClosure.
+		_, isName := node.Function.(*ast.Identifier)
+		selfCall := isName && c.lastInstructionIs(code.OpCurrentClosure)
 		for _, arg := range node.Arguments {
 			err := c.Compile(arg)
 			if err != nil {
 				return err
 			}
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		pos := c.emit(code.OpCall, len(node.Arguments))
+		if selfCall {
+			c.scopes[c.scopeIndex].lastSelfCall = EmittedInstruction{Opcode: code.OpCall, Position: pos}
+		}
+
+	case *ast.MethodCallExpression:
+		err := c.Compile(node.Receiver)
+		if err != nil {
+			return err
+		}
+		// Look the method up in a copy of the receiver, then put the method below the receiver,
+		// which becomes the first argument.
+		c.emit(code.OpDup, 1)
+		err = c.Compile(&ast.StringLiteral{Token: node.Method.Token, Value: node.Method.Value})
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		c.emit(code.OpSwap)
+
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments)+1)
+	}
+	return nil
+}
+
+// assignableSymbol resolves the variable name for an assignment, reporting an error if it is undefined,
+// a constant, or not a global or a local of the current function.
+func (c *Compiler) assignableSymbol(name *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(name.Value)
+	if !ok {
+		return symbol, fmt.Errorf("undefined variable %s", name.Value)
+	}
+	if symbol.Constant {
+		return symbol, fmt.Errorf("cannot reassign constant %s", name.Value)
+	}
+	if symbol.Scope != GlobalScope && symbol.Scope != LocalScope {
+		return symbol, fmt.Errorf("cannot assign to %s", name.Value)
+	}
+	return symbol, nil
+}
+
+// immediateOperand returns the value of expr if it is an integer literal small enough
+// to be the operand of an OpAddImmediate instruction.
+func immediateOperand(expr ast.Expression) (int, bool) {
+	lit, ok := expr.(*ast.IntegerLiteral)
+	if !ok || lit.Value < 0 || lit.Value > math.MaxUint16 {
+		return 0, false
+	}
+	return int(lit.Value), true
+}
+
+// storeSymbol emits the instruction that pops the top of the stack into the global or local variable s.
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// compileAssignedValue compiles the value of an assignment with the operator op.
+// For a compound assignment, the current value must already be on the stack, and is combined with the value.
+func (c *Compiler) compileAssignedValue(op token.Token, value ast.Expression) error {
+	if immediate, ok := immediateOperand(value); ok && op.Type == token.PlusAssign {
+		c.emit(code.OpAddImmediate, immediate)
+		return nil
+	}
+
+	err := c.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	switch op.Type {
+	case token.Assign:
+	case token.PlusAssign:
+		c.emit(code.OpAdd)
+	case token.MinusAssign:
+		c.emit(code.OpSub)
+	case token.AsteriskAssign:
+		c.emit(code.OpMul)
+	case token.SlashAssign:
+		c.emit(code.OpDiv)
+	case token.PercentAssign:
+		c.emit(code.OpMod)
+	default:
+		return fmt.Errorf("unknown assignment operator %s", op.Literal)
 	}
 	return nil
 }
 
+// isChainedComparison reports whether node orders the result of another ordering comparison, as in 1 < 2 < 3,
+// which compares a boolean with an integer instead of checking that the integers are in order.
+// Equality comparisons such as a < b == true are not chains, since booleans can be compared for equality,
+// and neither are comparisons written in parentheses, as in (1 < 2) < 3.
+func isChainedComparison(node *ast.InfixExpression) bool {
+	if !isOrdering(node.Operator) {
+		return false
+	}
+	for _, operand := range []ast.Expression{node.Left, node.Right} {
+		if infix, ok := operand.(*ast.InfixExpression); ok && isOrdering(infix.Operator) && !infix.Parenthesized {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrdering reports whether operator is one of the ordering comparisons <, <=, > and >=.
+func isOrdering(operator string) bool {
+	switch operator {
+	case "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// foldConstant evaluates an expression of integer and boolean literals at compile time,
+// returning an [object.Integer] or an [object.Boolean].
+// Comparisons of two string literals with == and != are folded as well.
+//
+// It reports false if the expression has any other operand, or if evaluating it would be a runtime error,
+// like dividing by zero or ordering booleans, which is left for the VM to report.
+func foldConstant(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}, true
+
+	case *ast.Boolean:
+		return object.NativeBoolToBoolean(node.Value), true
+
+	case *ast.PrefixExpression:
+		right, ok := foldConstant(node.Right)
+		if !ok {
+			return nil, false
+		}
+		switch right := right.(type) {
+		case *object.Integer:
+			switch node.Operator {
+			case "-":
+				return &object.Integer{Value: -right.Value}, true
+			case "!":
+				// Integers are truthy.
+				return object.False, true
+			}
+		case *object.Boolean:
+			if node.Operator == "!" {
+				return object.NativeBoolToBoolean(!right.Value), true
+			}
+		}
+
+	case *ast.InfixExpression:
+		if left, isString := node.Left.(*ast.StringLiteral); isString {
+			right, isString := node.Right.(*ast.StringLiteral)
+			if isString {
+				return foldEquality(node.Operator, left.Value == right.Value)
+			}
+			return nil, false
+		}
+
+		left, ok := foldConstant(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := foldConstant(node.Right)
+		if !ok {
+			return nil, false
+		}
+		switch left := left.(type) {
+		case *object.Integer:
+			if right, isInteger := right.(*object.Integer); isInteger {
+				return foldIntegerInfix(node.Operator, left.Value, right.Value)
+			}
+		case *object.Boolean:
+			if right, isBoolean := right.(*object.Boolean); isBoolean {
+				return foldEquality(node.Operator, left.Value == right.Value)
+			}
+		}
+	}
+	return nil, false
+}
+
+// foldIntegerInfix evaluates an infix operation on two integers like the VM does.
+// Division and modulo by zero are not folded.
+func foldIntegerInfix(operator string, left, right int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		return &object.Integer{Value: left + right}, true
+	case "-":
+		return &object.Integer{Value: left - right}, true
+	case "*":
+		return &object.Integer{Value: left * right}, true
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return &object.Integer{Value: left / right}, true
+	case "%":
+		if right == 0 {
+			return nil, false
+		}
+		return &object.Integer{Value: left % right}, true
+	case "<":
+		return object.NativeBoolToBoolean(left < right), true
+	case ">":
+		return object.NativeBoolToBoolean(left > right), true
+	case "<=":
+		return object.NativeBoolToBoolean(left <= right), true
+	case ">=":
+		return object.NativeBoolToBoolean(left >= right), true
+	}
+	return foldEquality(operator, left == right)
+}
+
+// foldEquality evaluates == or != given whether the operands are equal.
+// It reports false for any other operator.
+func foldEquality(operator string, equal bool) (object.Object, bool) {
+	switch operator {
+	case "==":
+		return object.NativeBoolToBoolean(equal), true
+	case "!=":
+		return object.NativeBoolToBoolean(!equal), true
+	}
+	return nil, false
+}
+
+// emitFolded emits the instruction that pushes a value computed by foldConstant.
+func (c *Compiler) emitFolded(value object.Object) {
+	switch value {
+	case object.True:
+		c.emit(code.OpTrue)
+	case object.False:
+		c.emit(code.OpFalse)
+	default:
+		c.emit(code.OpConstant, c.addConstant(value))
+	}
+}
+
+// constantCondition reports whether a loop condition is a literal, whose truthiness is known at compile time,
+// and if so, whether it is truthy.
+func constantCondition(condition ast.Expression) (truthy, constant bool) {
+	switch condition := condition.(type) {
+	case *ast.Boolean:
+		return condition.Value, true
+	case *ast.NullLiteral:
+		return false, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// compileLoopBody compiles the body of a loop with an optional label,
+// collecting the break and continue statements within it.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, label *ast.Identifier) (*loopContext, error) {
+	loop := &loopContext{}
+	if label != nil {
+		loop.label = label.Value
+	}
+	index := c.scopeIndex
+	c.scopes[index].loops = append(c.scopes[index].loops, loop)
+
+	err := c.Compile(body)
+
+	loops := c.scopes[index].loops
+	c.scopes[index].loops = loops[:len(loops)-1]
+	return loop, err
+}
+
+// targetLoop returns the loop that a break or continue statement with an optional label jumps out of or to:
+// the innermost loop of the current compilation scope, or the innermost one with the label.
+// Loops outside the function being compiled are not candidates.
+func (c *Compiler) targetLoop(keyword string, label *ast.Identifier) (*loopContext, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	if label == nil {
+		if len(loops) == 0 {
+			return nil, fmt.Errorf("%s outside loop", keyword)
+		}
+		return loops[len(loops)-1], nil
+	}
+
+	for i := len(loops) - 1; i >= 0; i-- {
+		if loops[i].label == label.Value {
+			return loops[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown label %s", label.Value)
+}
+
+// patchLoop points the continue statements of a loop at continuePos and its break statements at breakPos.
+func (c *Compiler) patchLoop(loop *loopContext, continuePos, breakPos int) {
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continuePos)
+	}
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, breakPos)
+	}
+}
+
+// annotationBuiltin returns the index of the builtin that the named annotation applies.
+func annotationBuiltin(name string) (int, error) {
+	for i, def := range object.Builtins {
+		if def.Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown annotation @%s", name)
+}
+
 // addConstant adds a constant value to the constant pool and returns its index.
+// Integers, strings and booleans are interned: a constant equal to one already in the pool reuses its index.
+// Compiled functions are always added, since each literal is its own function.
 func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := internKey(obj)
+	if ok {
+		if i, ok := c.internedConstants[key]; ok {
+			return i
+		}
+		c.internedConstants[key] = len(c.constants)
+	}
+
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
 }
 
+// internKey returns the key identifying obj among interned constants, or false if obj is not interned.
+// The keys of different types never compare equal, as each type keys by a different Go type.
+func internKey(obj object.Object) (any, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, true
+	case *object.String:
+		return obj.Value, true
+	case *object.Boolean:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// literalHashKey returns the value of a hash key written as an integer, string or boolean literal.
+// Keys of other kinds are only known at run time.
+func literalHashKey(expr ast.Expression) (any, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return expr.Value, true
+	case *ast.StringLiteral:
+		return expr.Value, true
+	case *ast.Boolean:
+		return expr.Value, true
+	default:
+		return nil, false
+	}
+}
+
 // emit generates a bytecode instruction with the given opcode and operands,
 // adds it to the instruction list, and tracks its position.
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
+	if c.position.Line > 0 {
+		c.scopes[c.scopeIndex].sourceMap[pos] = c.position
+	}
 
 	c.setLastInstruction(op, pos)
 	return pos
@@ -439,11 +1164,47 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	return posNewInstruction
 }
 
+// NumGlobals returns the number of global variable slots used by the code compiled so far.
+// Redefining a global with "let" uses a new slot.
+func (c *Compiler) NumGlobals() int {
+	table := c.symbolTable
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	return table.numDefinitions
+}
+
+// Warnings returns the warnings reported while compiling, each prefixed with the "line:column" of its source.
+// Warnings are only reported for the checks enabled by options such as [WithShadowWarnings].
+func (c *Compiler) Warnings() []string {
+	return c.warnings
+}
+
+// checkShadowing warns if enabled and the variable name, about to be defined in a function scope,
+// shadows a variable of an enclosing scope. The kind describes the variable, like "parameter".
+func (c *Compiler) checkShadowing(kind string, name *ast.Identifier) {
+	if !c.warnShadow || c.symbolTable.Outer == nil {
+		return
+	}
+	symbol, ok := c.symbolTable.Outer.lookup(name.Value)
+	if !ok || symbol.Scope == BuiltinScope {
+		return
+	}
+
+	shadowed := "a variable of an enclosing function"
+	if symbol.Scope == GlobalScope {
+		shadowed = "a global variable"
+	}
+	c.warnings = append(c.warnings, fmt.Sprintf("%d:%d: %s %s shadows %s",
+		name.Token.Line, name.Token.Column, kind, name.Value, shadowed))
+}
+
 // Bytecode returns the compiled bytecode containing instructions and constants for a program or function.
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
 
@@ -465,6 +1226,96 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = newInstruction
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.forgetSourceFrom(last.Position)
+}
+
+// discardInstructions removes the instructions emitted from pos onwards in the current compilation scope.
+// The last emitted instructions are forgotten as well, so that none from before pos is mistaken
+// for the end of the removed code.
+func (c *Compiler) discardInstructions(pos int) {
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:pos]
+	c.forgetSourceFrom(pos)
+	c.scopes[c.scopeIndex].lastInstruction = EmittedInstruction{}
+	c.scopes[c.scopeIndex].previousInstruction = EmittedInstruction{}
+	if c.scopes[c.scopeIndex].lastSelfCall.Position >= pos {
+		c.scopes[c.scopeIndex].lastSelfCall = EmittedInstruction{}
+	}
+}
+
+// compileDiscarded compiles node, reporting its errors and defining its names,
+// but then drops the instructions and the constants it added.
+func (c *Compiler) compileDiscarded(node ast.Node) error {
+	pos := len(c.currentInstructions())
+	numConstants := len(c.constants)
+
+	err := c.Compile(node)
+	if err != nil {
+		return err
+	}
+
+	c.discardCompiled(pos, numConstants)
+	return nil
+}
+
+// discardCompiled drops the instructions emitted from pos onwards and the constants added after the first numConstants,
+// as well as the break and continue statements of enclosing loops among the dropped instructions,
+// which would otherwise be patched into whatever instructions are emitted there next.
+func (c *Compiler) discardCompiled(pos, numConstants int) {
+	c.discardInstructions(pos)
+	c.constants = c.constants[:numConstants]
+	for key, i := range c.internedConstants {
+		if i >= numConstants {
+			delete(c.internedConstants, key)
+		}
+	}
+	// Forget the break and continue statements of enclosing loops among the dropped instructions.
+	for _, loop := range c.scopes[c.scopeIndex].loops {
+		loop.breaks = slices.DeleteFunc(loop.breaks, func(p int) bool { return p >= pos })
+		loop.continues = slices.DeleteFunc(loop.continues, func(p int) bool { return p >= pos })
+	}
+}
+
+// leavesBlock reports whether stmt always transfers control out of the block it is in.
+func leavesBlock(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+// blockLeaves reports whether the block always transfers control out of itself before reaching its end.
+func blockLeaves(block *ast.BlockStatement) bool {
+	return slices.ContainsFunc(block.Statements, leavesBlock)
+}
+
+// compileUnreachable compiles the statements that follow a return, break or continue in a block
+// like [Compiler.compileDiscarded], and leaves the block ending with that statement's jump or return.
+func (c *Compiler) compileUnreachable(stmts []ast.Statement) error {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	for _, s := range stmts {
+		err := c.compileDiscarded(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.scopes[c.scopeIndex].lastInstruction = last
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	return nil
+}
+
+// keepBlockValue leaves the value of a just-compiled block on the stack:
+// the value of its trailing expression, or null if the block ends with any other statement.
+func (c *Compiler) keepBlockValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
 }
 
 // replaceInstruction replaces a sequence of bytecode instructions at the specified position with a new instruction sequence.
@@ -512,6 +1363,24 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+	c.markTailCall(c.scopes[c.scopeIndex].previousInstruction)
+}
+
+// markTailCall turns ins into an OpTailCall if it calls the function being compiled,
+// as the result of ins is about to be returned. The OpReturnValue after it is kept,
+// since other branches of the function may jump to it.
+func (c *Compiler) markTailCall(ins EmittedInstruction) {
+	scope := &c.scopes[c.scopeIndex]
+	if ins.Opcode != code.OpCall || ins != scope.lastSelfCall {
+		return
+	}
+	c.replaceInstruction(ins.Position, []byte{byte(code.OpTailCall)})
+	if scope.lastInstruction.Position == ins.Position {
+		scope.lastInstruction.Opcode = code.OpTailCall
+	}
+	if scope.previousInstruction.Position == ins.Position {
+		scope.previousInstruction.Opcode = code.OpTailCall
+	}
 }
 
 // loadSymbol generates bytecode to load the value of a symbol from its associated scope using the symbol's index.
@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"testing"
 
 	"github.com/dr8co/kong/ast"
@@ -30,11 +32,13 @@ func parse(input string) *ast.Program {
 func TestIntegerArithmetic(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "1 + 2",
+			input:             "let a = 1; 2 + a",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpPop),
 			},
@@ -50,40 +54,60 @@ func TestIntegerArithmetic(t *testing.T) {
 			},
 		},
 		{
-			input:             "1 - 2",
+			input:             "let a = 1; a - 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpSub),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "1 * 2",
+			input:             "let a = 1; a * 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpMul),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "2 / 1",
+			input:             "let a = 2; a / 1",
 			expectedConstants: []interface{}{2, 1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpDiv),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "-1",
+			input:             "let a = 7; a % 3",
+			expectedConstants: []interface{}{7, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = 1; -a",
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpMinus),
 				code.Make(code.OpPop),
 			},
@@ -112,72 +136,393 @@ func TestBooleanExpressions(t *testing.T) {
 			},
 		},
 		{
-			input:             "1 > 2",
+			input:             "let a = 1; a > 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpGreaterThan),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			input:             "let a = 1; a < 2",
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "1 == 2",
+			input:             "let a = 1; a == 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpEqual),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-
-			input:             "1 != 2",
+			input:             "let a = 1; a != 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpNotEqual),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "true == false",
-			expectedConstants: []interface{}{},
+			input:             "true == 1",
+			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpTrue),
-				code.Make(code.OpFalse),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpEqual),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "true != false",
+			input:             "let t = true; !t",
 			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestComparisonFolding tests that comparisons of literals are evaluated at compile time,
+// unless the comparison is an error at runtime.
+func TestComparisonFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{"1 > 2", []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{"5 > 3", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{"1 < 2", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{"2 <= 2", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{"1 >= 2", []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{"1 == 2", []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{"1 != 2", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{`"a" == "a"`, []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{`"a" != "a"`, []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{"true == false", []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{"true != false", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{"!(1 < 2)", []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{
+			`"a" < "b"`,
+			[]interface{}{"a", "b"},
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			"true > false",
+			[]interface{}{},
+			[]code.Instructions{
 				code.Make(code.OpTrue),
 				code.Make(code.OpFalse),
-				code.Make(code.OpNotEqual),
+				code.Make(code.OpGreaterThan),
 				code.Make(code.OpPop),
 			},
 		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestConstantFolding tests that integer and boolean operations on literals are evaluated at compile time
+// into a single instruction, except for division by zero, which is left to fail at runtime.
+func TestConstantFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{"2 * 3 + 4", []interface{}{10}, []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpPop)}},
+		{"-(2 - 5)", []interface{}{3}, []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpPop)}},
+		{"7 / 2 * -1", []interface{}{-3}, []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpPop)}},
+		{"1 + 2 == 3", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{"!!true", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
+		{"-7 % 3", []interface{}{-1}, []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpPop)}},
+		{"!5", []interface{}{}, []code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)}},
+		{"(1 < 2) == !false", []interface{}{}, []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)}},
 		{
-			input:             "!true",
-			expectedConstants: []interface{}{},
+			"1 / 0",
+			[]interface{}{1, 0},
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			"1 % 0",
+			[]interface{}{1, 0},
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Only the operands that can be folded are.
+			"2 * 3 + 1 / (2 - 2)",
+			[]interface{}{6, 1, 0},
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDiv),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			"let a = 2; (1 + 2) * a",
+			[]interface{}{2, 3},
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			"-true",
+			[]interface{}{},
+			[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpMinus), code.Make(code.OpPop)},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestTreeShaking tests that unused top-level functions are left out, along with their constants,
+// while functions used directly or transitively are kept.
+func TestTreeShaking(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let unused = fn() { "dead" };
+			let helper = fn(x) { x };
+			let main = fn() { helper("live") };
+			main();
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				"live",
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpBang),
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The string interned by the dropped function is added again when used.
+			input:             `let unused = fn() { "s" }; "s"`,
+			expectedConstants: []interface{}{"s"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Recursive functions that nothing else calls are dropped too.
+			input:             `let countdown = fn(n) { if (n > 0) { countdown(n - 1) } }; 1`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Functions referenced as values, or bound twice, are kept.
+			input: `let f = fn() { 1 }; let g = fn() { 2 }; let g = fn() { 3 }; [f]`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpReturnValue)},
+				2,
+				[]code.Instructions{code.Make(code.OpConstant, 2), code.Make(code.OpReturnValue)},
+				3,
+				[]code.Instructions{code.Make(code.OpConstant, 4), code.Make(code.OpReturnValue)},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpClosure, 5, 0),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests, WithTreeShaking())
+
+	// Errors in unused functions are still reported.
+	compiler := New(WithTreeShaking())
+	err := compiler.Compile(parse(`let unused = fn() { missing }; 1`))
+	if err == nil || err.Error() != "undefined variable missing" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+// TestUnreachableCode tests that statements after a return, break or continue are left out,
+// while the instructions other code jumps to are kept.
+func TestUnreachableCode(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 1; 2; 3 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// A consequence that returns needs no jump over the alternative.
+			input: `fn(x) { if (x) { return 1; 2 } return 3; 4 }`,
+			expectedConstants: []interface{}{
+				1,
+				3,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 9),
+					// 0005
+					code.Make(code.OpConstant, 0),
+					// 0008
+					code.Make(code.OpReturnValue),
+					// 0009
+					code.Make(code.OpNull),
+					// 0010
+					code.Make(code.OpPop),
+					// 0011
+					code.Make(code.OpConstant, 1),
+					// 0014
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The dropped break is not patched to the end of the loop.
+			input:             `for (let i = 0; i < 3; i = i + 1) { continue; break; }`,
+			expectedConstants: []interface{}{0, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 31),
+				// 0016
+				code.Make(code.OpJump, 19),
+				// 0019
+				code.Make(code.OpGetGlobal, 0),
+				// 0022
+				code.Make(code.OpAddImmediate, 1),
+				// 0025
+				code.Make(code.OpSetGlobal, 0),
+				// 0028
+				code.Make(code.OpJump, 6),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	// Errors in unreachable code are still reported.
+	compiler := New()
+	err := compiler.Compile(parse(`fn() { return 1; missing }`))
+	if err == nil || err.Error() != "undefined variable missing" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+// TestAddImmediate tests that adding a small integer literal compiles to an OpAddImmediate instruction
+// instead of loading the integer from the constant pool.
+func TestAddImmediate(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = 1; a + 65535; a + 65536",
+			expectedConstants: []interface{}{1, 65536},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpAddImmediate, 65535),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { a += 2; a - 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAddImmediate, 2),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -290,31 +635,299 @@ func TestGlobalLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-// TestStringExpressions tests the compilation of string expressions into constants and bytecode instructions.
-func TestStringExpressions(t *testing.T) {
+func TestConstStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             `"monkey"`,
-			expectedConstants: []interface{}{"monkey"},
+			input: `
+            const one = 1;
+            one;
+            `,
+			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             `"mon" + "key"`,
-			expectedConstants: []interface{}{"mon", "key"},
+			input: `
+            const one = 1;
+            fn() { one };
+            `,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestIncDecStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let i = 0; i++;",
+			expectedConstants: []interface{}{0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpAddImmediate, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: "fn() { let i = 0; i-- }",
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSub),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"i++;", "undefined variable i"},
+		{"const i = 0; i++;", "cannot reassign constant i"},
+		{"len--;", "cannot assign to len"},
+		{"fn() { let i = 0; fn() { i++ } }", "cannot assign to i"},
+	}
+	for _, tt := range errorTests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 in [1, 2]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"a" in {"a": 1}`,
+			expectedConstants: []interface{}{"a", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"ell" in "hello"`,
+			expectedConstants: []interface{}{"ell", "hello"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
 
+func TestConstReassignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`const x = 1; x = 2;`, "cannot reassign constant x"},
+		{`const x = 1; x += 2;`, "cannot reassign constant x"},
+		{`const x = 1; let x = 2;`, "cannot reassign constant x"},
+		{`const x = 1; const x = 2;`, "cannot reassign constant x"},
+		{`fn() { const x = 1; x = 2; }`, "cannot reassign constant x"},
+		{`fn() { const x = 1; let x = 2; }`, "cannot reassign constant x"},
+		{`const x = 1; fn() { x = 2; }`, "cannot reassign constant x"},
+		{`fn() { const x = 1; fn() { x = 2; } }`, "cannot reassign constant x"},
+		{`let x = 1; const x = 2;`, ""},
+		{`const x = 1; fn() { let x = 2; x = 3; }`, ""},
+		{`const x = [1]; x[0] = 2;`, ""},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compile error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected compile error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestStringExpressions tests the compilation of string expressions into constants and bytecode instructions.
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"monkey"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestConstantInterning tests that repeated integer and string literals share a single constant,
+// while repeated function literals do not.
+func TestConstantInterning(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `{"key": 1}; {"key": 2}["key"]`,
+			expectedConstants: []interface{}{"key", 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { "a" + "b" }; "b" + "a"`,
+			expectedConstants: []interface{}{
+				"a",
+				"b",
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let x = 2; [x * 2, x - 2, 2, "2", fn() { 2 }, fn() { 2 }]`,
+			expectedConstants: []interface{}{
+				2,
+				"2",
+				[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpReturnValue)},
+				[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpReturnValue)},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMul),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSub),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpArray, 6),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestConstantInterningWithState tests that constants from an existing constant pool are reused.
+func TestConstantInterningWithState(t *testing.T) {
+	constants := []object.Object{&object.Integer{Value: 1}, &object.String{Value: "monkey"}}
+	compiler := NewWithState(NewSymbolTable(), constants)
+
+	err := compiler.Compile(parse(`"monkey"; "kong"; 1`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	err = testConstants([]interface{}{1, "monkey", "kong"}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+}
+
 // TestArrayLiterals tests the compilation of array literals into bytecode,
 // including constants and generated instructions.
 func TestArrayLiterals(t *testing.T) {
@@ -339,17 +952,19 @@ func TestArrayLiterals(t *testing.T) {
 			},
 		},
 		{
-			input:             "[1 + 2, 3 - 4, 5 * 6]",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             "let a = 1; [2 + a, 3 - a, a * 4]",
+			expectedConstants: []interface{}{1, 2, 3, 4},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpSub),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 3),
 				code.Make(code.OpMul),
 				code.Make(code.OpArray, 3),
 				code.Make(code.OpPop),
@@ -386,20 +1001,31 @@ func TestHashLiterals(t *testing.T) {
 		},
 		{
 			input:             "{1: 2 + 3, 4: 5 * 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedConstants: []interface{}{1, 5, 4, 30},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpAdd),
 				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
 				code.Make(code.OpHash, 4),
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// Pairs are emitted in source order, not sorted.
+			input:             `{"b": 1, "a": 2, 3: true}`,
+			expectedConstants: []interface{}{"b", 1, "a", 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpTrue),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -410,34 +1036,148 @@ func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 1),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpHash, 2),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestSliceExpressions tests that slice bounds are compiled in order, with null for a missing bound.
+func TestIndexAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = [1]; a[0] = 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] -= 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup, 2),
+				code.Make(code.OpIndex),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
 				code.Make(code.OpSub),
+				code.Make(code.OpSetIndex),
+			},
+		},
+		{
+			input:             "let x = 1; x *= 3;",
+			expectedConstants: []interface{}{1, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let o = {}; o.m(1); o.f",
+			expectedConstants: []interface{}{"m", 1, "f"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDup, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSwap),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
 	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1:2]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"abc"[:2]`,
+			expectedConstants: []interface{}{"abc", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"abc"[1:]`,
+			expectedConstants: []interface{}{"abc", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
 	runCompilerTests(t, tests)
 }
 
@@ -447,34 +1187,28 @@ func TestFunctions(t *testing.T) {
 		{
 			input: `fn() { return 5 + 10 }`,
 			expectedConstants: []interface{}{
-				5,
-				10,
+				15,
 				[]code.Instructions{
 					code.Make(code.OpConstant, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpAdd),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input: `fn() { 5 + 10 }`,
 			expectedConstants: []interface{}{
-				5,
-				10,
+				15,
 				[]code.Instructions{
 					code.Make(code.OpConstant, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpAdd),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -893,90 +1627,518 @@ func TestClosures(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpClosure, 6, 0),
-				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 6, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestRecursiveFunctions tests the compilation of recursive functions and nested closures with their corresponding instructions.
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { countDown(x - 1); };
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) { countDown(x - 1); };
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestTailCalls tests that a function returning the result of a call to itself uses OpTailCall,
+// while other calls stay OpCall.
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let f = fn(n) { if (n == 0) { return 0; } f(n - 1) };`,
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpEqual),
+					code.Make(code.OpJumpNotTruthy, 13),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `let f = fn(n, acc) { return f(n - 1, acc + n); };`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpTailCall, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `let f = fn(n) { f(n - 1) + 1 }; let g = fn(n) { f(n) };`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpAddImmediate, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 1),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
 
-// TestRecursiveFunctions tests the compilation of recursive functions and nested closures with their corresponding instructions.
-func TestRecursiveFunctions(t *testing.T) {
+// TestAnnotatedFunctions tests that annotated functions are wrapped by the named builtin,
+// that global annotated functions recurse through their global binding,
+// and that local ones recurse through the wrapper bound to their closure.
+func TestAnnotatedFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input: `
-			let countDown = fn(x) { countDown(x - 1); };
-			countDown(1);
-			`,
+			input: `let f = @memoize fn(n) { f(n) };`,
 			expectedConstants: []interface{}{
-				1,
 				[]code.Instructions{
-					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetGlobal, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSub),
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpGetBuiltin, 6),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpCall, 1),
-				code.Make(code.OpPop),
+				code.Make(code.OpSetGlobal, 0),
 			},
 		},
 		{
-			input: `
-			let wrapper = fn() {
-				let countDown = fn(x) { countDown(x - 1); };
-				countDown(1);
-			};
-			wrapper();
-			`,
+			input: `fn() { let f = @memoize fn(n) { f(n) }; }`,
 			expectedConstants: []interface{}{
-				1,
 				[]code.Instructions{
 					code.Make(code.OpCurrentClosure),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 				[]code.Instructions{
-					code.Make(code.OpClosure, 1, 0),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
+					code.Make(code.OpClosure, 0, 0),
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpGetBuiltin, 6),
+					code.Make(code.OpSwap),
 					code.Make(code.OpCall, 1),
-					code.Make(code.OpReturnValue),
+					code.Make(code.OpBindSelf),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpReturn),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestUnknownAnnotation tests that annotations not naming a builtin are rejected at compile time.
+func TestUnknownAnnotation(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`let f = @cache fn(n) { n };`))
+	if err == nil {
+		t.Fatalf("expected compile error, got none")
+	}
+	if err.Error() != "unknown annotation @cache" {
+		t.Errorf("wrong compile error. want=%q, got=%q", "unknown annotation @cache", err)
+	}
+}
+
+// TestLoops tests the compilation of while and for loops, including where break and continue jump to.
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = true; while (x) { break; continue; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpSetGlobal, 0),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0010: break leaves the loop, and the unreachable continue is dropped
+				code.Make(code.OpJump, 16),
+				// 0013
+				code.Make(code.OpJump, 4),
+			},
+		},
+		{
+			input:             `for (let i = 0; i < 2; i = i + 1) { continue; }`,
+			expectedConstants: []interface{}{0, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
 				code.Make(code.OpSetGlobal, 0),
+				// 0006
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 31),
+				// 0016: continue runs the post statement
+				code.Make(code.OpJump, 19),
+				// 0019
+				code.Make(code.OpGetGlobal, 0),
+				// 0022
+				code.Make(code.OpAddImmediate, 1),
+				// 0025
+				code.Make(code.OpSetGlobal, 0),
+				// 0028
+				code.Make(code.OpJump, 6),
+			},
+		},
+		{
+			input:             `for (;;) { break; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpJump, 6),
+				// 0003
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `outer: for (;;) { for (;;) { break outer; } }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000: break outer leaves both loops
+				code.Make(code.OpJump, 9),
+				// 0003
+				code.Make(code.OpJump, 0),
+				// 0006
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `outer: for (let i = 0; ; i++) { while (true) { continue outer; } }`,
+			expectedConstants: []interface{}{0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006: continue outer runs the post statement of the outer loop
+				code.Make(code.OpJump, 12),
+				// 0009
+				code.Make(code.OpJump, 6),
+				// 0012
+				code.Make(code.OpGetGlobal, 0),
+				// 0015
+				code.Make(code.OpAddImmediate, 1),
+				// 0018
+				code.Make(code.OpSetGlobal, 0),
+				// 0021
+				code.Make(code.OpJump, 6),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// TestConstantLoopConditions tests that loops with constant conditions are compiled without the unused check or body.
+func TestConstantLoopConditions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The condition is never checked; only break leaves the loop.
+			input:             `while (true) { break; continue; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000: break leaves the loop, and the unreachable continue is dropped
+				code.Make(code.OpJump, 6),
+				// 0003
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `while (1) { puts(1); }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetBuiltin, 5),
+				// 0002
+				code.Make(code.OpConstant, 0),
+				// 0005
+				code.Make(code.OpCall, 1),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			// The body of a loop that never runs is dropped, side effects and constants included.
+			input:             `let x = 1; while (false) { puts(x); x = 2; } x`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Names defined in the dropped body are still known to the code after it.
+			input:             `while (false) { let y = 1; } y`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// A function ending with a dropped loop still returns null, not the value before the loop.
+			input: `fn() { 5; while (false) { } }`,
+			expectedConstants: []interface{}{
+				5,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
 	}
+
 	runCompilerTests(t, tests)
 }
 
-func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+// TestLoopErrors tests that misplaced loop statements and invalid assignments are rejected at compile time.
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`break;`, "break outside loop"},
+		{`continue;`, "continue outside loop"},
+		{`while (true) { fn() { break; } }`, "break outside loop"},
+		{`while (true) { break outer; }`, "unknown label outer"},
+		{`outer: while (true) { } while (true) { continue outer; }`, "unknown label outer"},
+		{`outer: while (true) { fn() { while (true) { break outer; } } }`, "unknown label outer"},
+		{`x = 1;`, "undefined variable x"},
+		{`len = 1;`, "cannot assign to len"},
+		{`let x = 1; fn() { x = 2; }`, ""},
+		{`fn() { let x = 1; fn() { x = 2; } }`, "cannot assign to x"},
+		{`while (false) { y; }`, "undefined variable y"},
+		{`return 5;`, "return outside function"},
+		{`if (true) { return 1; }`, "return outside function"},
+		{`fn() { return 1; }`, ""},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compile error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected compile error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestChainedComparisons verifies that ordering the result of an ordering comparison is a compile error,
+// while other operators may be chained.
+func TestChainedComparisons(t *testing.T) {
+	hint := " is not supported: compare each pair, as in `a < b ? b < c : false`"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < 2 < 3", "chained comparison 1 < 2 < 3" + hint},
+		{"let a = 1; let b = 2; a >= b > 0", "chained comparison a >= b > 0" + hint},
+		{"let x = 5; 0 <= x <= 10", "chained comparison 0 <= x <= 10" + hint},
+		{"(1 < 2) < 3 < 4", "chained comparison (1 < 2) < 3 < 4" + hint},
+		{"(1 < 2 < 3) > false", "chained comparison 1 < 2 < 3" + hint},
+		{"fn(a, b) { if (1 < (a < b)) { a } }", ""},
+		{"(1 < 2) < 3", ""},
+		{"let a = 1; (a < 2) > (a > 0)", ""},
+		{"1 + 2 + 3", ""},
+		{"1 < 2 == true", ""},
+		{"1 < 2 != 2 > 3", ""},
+		{"let a = 1; (a < 2) == (a > 0)", ""},
+		{"1 < 2 ? 2 < 3 : false", ""},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compile error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestDuplicateHashKeys tests that literal keys repeated in a hash literal are rejected,
+// while keys only known at run time are left alone.
+func TestDuplicateHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{1: "a", 1: "b"}`, "duplicate hash key: 1"},
+		{`{1: "a", 0x1: "b"}`, "duplicate hash key: 1"},
+		{`{"a": 1, "b": 2, "a": 3}`, `duplicate hash key: "a"`},
+		{`{true: 1, false: 2, true: 3}`, "duplicate hash key: true"},
+		{`fn() { {"k": {2: 1, 2: 1}} }`, "duplicate hash key: 2"},
+		{`{1: "a", "1": "b", true: "c"}`, ""},
+		{`let x = 1; {x: "a", x: "b"}`, ""},
+		{`{1 + 1: "a", 2: "b"}`, ""},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compile error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected compile error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase, opts ...Option) {
 	t.Helper()
 
 	for _, test := range tests {
 		program := parse(test.input)
 
-		compiler := New()
+		compiler := New(opts...)
 		err := compiler.Compile(program)
 		if err != nil {
 			t.Fatalf("Compilation error: %s", err)
@@ -1077,3 +2239,185 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestTernaryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x > 0 ? 10 : 20; 3333;",
+			expectedConstants: []interface{}{1, 0, 10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpGreaterThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0016
+				code.Make(code.OpConstant, 2),
+				// 0019
+				code.Make(code.OpJump, 25),
+				// 0022
+				code.Make(code.OpConstant, 3),
+				// 0025
+				code.Make(code.OpPop),
+				// 0026
+				code.Make(code.OpConstant, 4),
+				// 0029
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+// TestSourceMap verifies the source spans recorded for the instructions of a program and of a function.
+func TestSourceMap(t *testing.T) {
+	input := "let x = 1;\nlet f = fn(a) {\n  a * \"b\"\n};\nf(x)"
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expected := code.SourceMap{
+		0:  {Line: 1, Column: 9, Length: 1}, // OpConstant 1
+		3:  {Line: 1, Column: 1, Length: 3}, // OpSetGlobal x, from let
+		6:  {Line: 2, Column: 9, Length: 2}, // OpClosure, from fn
+		10: {Line: 2, Column: 1, Length: 3}, // OpSetGlobal f, from let
+		13: {Line: 5, Column: 1, Length: 1}, // OpGetGlobal f
+		16: {Line: 5, Column: 3, Length: 1}, // OpGetGlobal x
+		19: {Line: 5, Column: 2, Length: 1}, // OpCall, from (
+		21: {Line: 5, Column: 1, Length: 1}, // OpPop, from the expression statement
+	}
+	if !maps.Equal(bytecode.SourceMap, expected) {
+		t.Errorf("wrong source map.\nwant=%v\ngot =%v", expected, bytecode.SourceMap)
+	}
+
+	fn, ok := bytecode.Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 - not a function: %T", bytecode.Constants[2])
+	}
+	expected = code.SourceMap{
+		0: {Line: 3, Column: 3, Length: 1}, // OpGetLocal a
+		2: {Line: 3, Column: 7, Length: 3}, // OpConstant "b", with its quotes
+		5: {Line: 3, Column: 5, Length: 1}, // OpMul
+		6: {Line: 3, Column: 3, Length: 1}, // OpReturnValue, replacing the statement's OpPop
+	}
+	if !maps.Equal(fn.SourceMap, expected) {
+		t.Errorf("wrong function source map.\nwant=%v\ngot =%v", expected, fn.SourceMap)
+	}
+}
+
+// TestSourceMapOfRemovedInstructions verifies that instructions removed during compilation leave no source map entries.
+func TestSourceMapOfRemovedInstructions(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse("if (true) { 1 } else { 2; 3 }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	// Every instruction has an entry, and there is none for the removed ones.
+	var offsets []int
+	for i := 0; i < len(bytecode.Instructions); {
+		def, err := code.Lookup(bytecode.Instructions[i])
+		if err != nil {
+			t.Fatalf("lookup error: %s", err)
+		}
+		_, read := code.ReadOperands(def, bytecode.Instructions[i+1:])
+		offsets = append(offsets, i)
+		i += 1 + read
+	}
+	if !slices.Equal(bytecode.SourceMap.Offsets(), offsets) {
+		t.Errorf("wrong source map offsets. want=%v, got=%v", offsets, bytecode.SourceMap.Offsets())
+	}
+}
+
+// TestLocalNames verifies that the names of local variables are recorded only when compiling with debugging information.
+func TestLocalNames(t *testing.T) {
+	input := `
+	let global = 1;
+	fn(a, b) {
+		let sum = a + b;
+		let inner = fn(c) { let d = c * sum; d };
+		let sum = inner(global);
+		sum
+	}`
+
+	compiler := New(WithDebugInfo())
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var names [][]string
+	for _, c := range compiler.Bytecode().Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			names = append(names, fn.LocalNames)
+		}
+	}
+
+	expected := [][]string{
+		{"c", "d"},
+		// The first sum is shadowed by the second one.
+		{"a", "b", "", "inner", "sum"},
+	}
+	if !slices.EqualFunc(names, expected, slices.Equal) {
+		t.Errorf("wrong local names. want=%q, got=%q", expected, names)
+	}
+
+	compiler = New()
+	err = compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	for i, c := range compiler.Bytecode().Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok && fn.LocalNames != nil {
+			t.Errorf("constant %d: expected no local names without debugging information, got %q", i, fn.LocalNames)
+		}
+	}
+}
+
+func TestShadowWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; fn() { let x = 2; x }", []string{"1:23: local x shadows a global variable"}},
+		{"let x = 1; fn(x) { x }", []string{"1:15: parameter x shadows a global variable"}},
+		{"let x = 1; fn() { let y = 2; y }", nil},
+		{"let x = 1; let x = 2; x", nil},
+		{"fn(a) { fn(b) { let a = b; a } }", []string{"1:21: local a shadows a variable of an enclosing function"}},
+		{"fn(a) { let a = 1; let a = 2; a }", nil},
+		{"let x = 1; fn() { let x = 2; let x = 3; x }", []string{"1:23: local x shadows a global variable"}},
+		{"let f = fn(len) { len }", nil},
+	}
+
+	for _, tt := range tests {
+		compiler := New(WithShadowWarnings())
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+		if !slices.Equal(compiler.Warnings(), tt.expected) {
+			t.Errorf("wrong warnings for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, compiler.Warnings())
+		}
+	}
+
+	compiler := New()
+	err := compiler.Compile(parse("let x = 1; fn(x) { x }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if len(compiler.Warnings()) != 0 {
+		t.Errorf("warnings reported without WithShadowWarnings: %q", compiler.Warnings())
+	}
+}
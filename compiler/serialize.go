@@ -0,0 +1,349 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/object"
+)
+
+// FormatVersion is the version of the serialized bytecode format written by [Bytecode.Serialize].
+const FormatVersion = 3
+
+// magic identifies serialized Kong bytecode.
+const magic = "KONG"
+
+// Tags identifying the type of each serialized constant.
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagBoolean
+	tagCompiledFunction
+)
+
+// ErrNotBytecode is returned by [Deserialize] when the data does not start with the bytecode magic header.
+var ErrNotBytecode = errors.New("not kong bytecode: bad magic header")
+
+// errTruncated is returned when the serialized data ends unexpectedly.
+var errTruncated = errors.New("invalid bytecode: unexpected end of data")
+
+// Serialize encodes the bytecode into a binary format that can be written to disk and restored with [Deserialize].
+//
+// The encoding starts with a header holding the magic bytes "KONG", the [FormatVersion],
+// and the number of opcodes known to this build, followed by the instructions, their source map
+// and the constant pool.
+func (b *Bytecode) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(magic)
+	writeUint16(&buf, FormatVersion)
+	writeUint16(&buf, code.OpcodeCount())
+	writeBytes(&buf, b.Instructions)
+	writeSourceMap(&buf, b.SourceMap)
+
+	writeUint32(&buf, len(b.Constants))
+	for i, c := range b.Constants {
+		err := writeConstant(&buf, c)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Deserialize decodes bytecode produced by [Bytecode.Serialize].
+//
+// It returns an error if the data is not Kong bytecode, was written by an incompatible
+// format version, uses opcodes unknown to this build, or is truncated or otherwise malformed.
+func Deserialize(data []byte) (*Bytecode, error) {
+	r := &bytecodeReader{data: data}
+
+	header, err := r.read(len(magic))
+	if err != nil || string(header) != magic {
+		return nil, ErrNotBytecode
+	}
+
+	version, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d (this build supports version %d)", version, FormatVersion)
+	}
+
+	numOpcodes, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if numOpcodes > code.OpcodeCount() {
+		return nil, fmt.Errorf("bytecode uses %d opcodes, but this build only knows %d; recompile the program",
+			numOpcodes, code.OpcodeCount())
+	}
+
+	instructions, err := r.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	sourceMap, err := r.readSourceMap(len(instructions))
+	if err != nil {
+		return nil, err
+	}
+
+	numConstants, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	// Each constant takes at least two bytes, which bounds the allocation for corrupt counts.
+	constants := make([]object.Object, 0, min(numConstants, r.remaining()/2))
+	for i := range numConstants {
+		c, err := r.readConstant()
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		constants = append(constants, c)
+	}
+
+	if r.remaining() != 0 {
+		return nil, fmt.Errorf("invalid bytecode: %d trailing bytes", r.remaining())
+	}
+
+	return &Bytecode{Instructions: instructions, Constants: constants, SourceMap: sourceMap}, nil
+}
+
+// writeConstant encodes a single constant, prefixed with its type tag.
+func writeConstant(buf *bytes.Buffer, obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		buf.WriteByte(tagInteger)
+		//nolint:gosec
+		writeUint64(buf, uint64(obj.Value))
+
+	case *object.String:
+		buf.WriteByte(tagString)
+		writeBytes(buf, []byte(obj.Value))
+
+	case *object.Boolean:
+		buf.WriteByte(tagBoolean)
+		if obj.Value {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+
+	case *object.CompiledFunction:
+		buf.WriteByte(tagCompiledFunction)
+		writeUint32(buf, obj.NumLocals)
+		writeUint32(buf, obj.NumParameters)
+		writeBytes(buf, []byte(obj.Name))
+		writeBytes(buf, obj.Instructions)
+		writeSourceMap(buf, obj.SourceMap)
+
+	default:
+		return fmt.Errorf("cannot serialize constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+// writeSourceMap encodes a source map as the number of entries,
+// followed by the offset, line, column and length of each entry in order of offset.
+func writeSourceMap(buf *bytes.Buffer, m code.SourceMap) {
+	writeUint32(buf, len(m))
+	for _, offset := range m.Offsets() {
+		span := m[offset]
+		writeUint32(buf, offset)
+		writeUint32(buf, span.Line)
+		writeUint32(buf, span.Column)
+		writeUint32(buf, span.Length)
+	}
+}
+
+func writeUint16(buf *bytes.Buffer, v int) {
+	//nolint:gosec
+	buf.Write(binary.BigEndian.AppendUint16(nil, uint16(v)))
+}
+
+func writeUint32(buf *bytes.Buffer, v int) {
+	//nolint:gosec
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	buf.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+// writeBytes writes a length-prefixed byte slice.
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeUint32(buf, len(b))
+	buf.Write(b)
+}
+
+// bytecodeReader reads serialized bytecode, checking bounds on every read.
+type bytecodeReader struct {
+	data []byte
+	pos  int
+}
+
+// remaining returns the number of unread bytes.
+func (r *bytecodeReader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+// read returns the next n bytes, or an error if fewer than n bytes remain.
+func (r *bytecodeReader) read(n int) ([]byte, error) {
+	if n < 0 || n > r.remaining() {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *bytecodeReader) readByte() (byte, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *bytecodeReader) readUint16() (int, error) {
+	b, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(b)), nil
+}
+
+func (r *bytecodeReader) readUint32() (int, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *bytecodeReader) readUint64() (uint64, error) {
+	b, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// readBytes reads a length-prefixed byte slice and returns a copy of it.
+func (r *bytecodeReader) readBytes() ([]byte, error) {
+	n, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(b), nil
+}
+
+// readSourceMap decodes a source map for instructions of the given length.
+// Offsets must be in ascending order and within the instructions.
+func (r *bytecodeReader) readSourceMap(numInstructions int) (code.SourceMap, error) {
+	n, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	// Each entry takes 16 bytes, which bounds the allocation for corrupt counts.
+	if n > r.remaining()/16 {
+		return nil, errTruncated
+	}
+
+	m := make(code.SourceMap, n)
+	previous := -1
+	for range n {
+		var fields [4]int
+		for i := range fields {
+			fields[i], err = r.readUint32()
+			if err != nil {
+				return nil, err
+			}
+		}
+		offset := fields[0]
+		if offset <= previous || offset >= numInstructions {
+			return nil, fmt.Errorf("invalid bytecode: source map offset %d out of order or range", offset)
+		}
+		previous = offset
+		m[offset] = code.SourceSpan{Line: fields[1], Column: fields[2], Length: fields[3]}
+	}
+	return m, nil
+}
+
+// readConstant decodes a single tagged constant.
+func (r *bytecodeReader) readConstant() (object.Object, error) {
+	tag, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case tagInteger:
+		v, err := r.readUint64()
+		if err != nil {
+			return nil, err
+		}
+		//nolint:gosec
+		return &object.Integer{Value: int64(v)}, nil
+
+	case tagString:
+		b, err := r.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: string(b)}, nil
+
+	case tagBoolean:
+		b, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		// Only 0 and 1 are accepted, so that every accepted encoding serializes back to the same bytes.
+		if b > 1 {
+			return nil, fmt.Errorf("invalid bytecode: boolean byte %d", b)
+		}
+		return object.NativeBoolToBoolean(b == 1), nil
+
+	case tagCompiledFunction:
+		numLocals, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		numParameters, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := r.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		sourceMap, err := r.readSourceMap(len(instructions))
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: numParameters,
+			Name:          string(name),
+			SourceMap:     sourceMap,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("invalid bytecode: unknown constant tag %d", tag)
+	}
+}
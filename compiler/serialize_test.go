@@ -0,0 +1,200 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/object"
+)
+
+// TestSerializeRoundTrip verifies that deserializing serialized bytecode restores the instructions and constants.
+func TestSerializeRoundTrip(t *testing.T) {
+	input := `
+	let greeting = "hello";
+	let add = fn(a, b) { let c = a + b; c };
+	let wrapper = fn(x) { fn(y) { add(x, y) } };
+	wrapper(1)(2);
+	`
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	bytecode.Constants = append(bytecode.Constants, &object.Boolean{Value: true})
+
+	data, err := bytecode.Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+
+	restored, err := Deserialize(data)
+	if err != nil {
+		t.Fatalf("deserialize error: %s", err)
+	}
+
+	if restored.Instructions.String() != bytecode.Instructions.String() {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q", bytecode.Instructions, restored.Instructions)
+	}
+	if len(bytecode.SourceMap) == 0 || !maps.Equal(restored.SourceMap, bytecode.SourceMap) {
+		t.Errorf("wrong source map.\nwant=%v\ngot =%v", bytecode.SourceMap, restored.SourceMap)
+	}
+
+	if len(restored.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bytecode.Constants), len(restored.Constants))
+	}
+
+	for i, want := range bytecode.Constants {
+		got := restored.Constants[i]
+		if got.Type() != want.Type() {
+			t.Errorf("constant %d has wrong type. want=%s, got=%s", i, want.Type(), got.Type())
+			continue
+		}
+
+		switch want := want.(type) {
+		case *object.CompiledFunction:
+			fn := got.(*object.CompiledFunction)
+			if fn.Instructions.String() != want.Instructions.String() {
+				t.Errorf("constant %d has wrong instructions.\nwant=%q\ngot =%q", i, want.Instructions, fn.Instructions)
+			}
+			if fn.NumLocals != want.NumLocals || fn.NumParameters != want.NumParameters || fn.Name != want.Name {
+				t.Errorf("constant %d has wrong metadata. want=%d/%d/%q, got=%d/%d/%q",
+					i, want.NumLocals, want.NumParameters, want.Name, fn.NumLocals, fn.NumParameters, fn.Name)
+			}
+			if !maps.Equal(fn.SourceMap, want.SourceMap) {
+				t.Errorf("constant %d has wrong source map.\nwant=%v\ngot =%v", i, want.SourceMap, fn.SourceMap)
+			}
+		default:
+			if got.Inspect() != want.Inspect() {
+				t.Errorf("constant %d has wrong value. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+			}
+		}
+	}
+}
+
+// TestDeserializeErrors verifies that malformed or incompatible data is rejected with a descriptive error.
+func TestDeserializeErrors(t *testing.T) {
+	valid, err := (&Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}).Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+
+	badVersion := append([]byte{}, valid...)
+	binary.BigEndian.PutUint16(badVersion[4:], FormatVersion+1)
+
+	newerOpcodes := append([]byte{}, valid...)
+	//nolint:gosec
+	binary.BigEndian.PutUint16(newerOpcodes[6:], uint16(code.OpcodeCount()+1))
+
+	badTag := append([]byte{}, valid...)
+	badTag[len(badTag)-9] = 99
+
+	badBoolean, err := (&Bytecode{Constants: []object.Object{object.True}}).Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+	badBoolean[len(badBoolean)-1] = 2
+
+	badSourceMap, err := (&Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		SourceMap:    code.SourceMap{3: {Line: 1, Column: 1, Length: 1}},
+	}).Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, ErrNotBytecode.Error()},
+		{"bad magic", []byte("MONKEY"), ErrNotBytecode.Error()},
+		{"bad version", badVersion, "unsupported bytecode version 4 (this build supports version 3)"},
+		{"newer opcodes", newerOpcodes, "bytecode uses"},
+		{"truncated", valid[:len(valid)-3], "unexpected end of data"},
+		{"trailing bytes", append(append([]byte{}, valid...), 0), "1 trailing bytes"},
+		{"unknown tag", badTag, "unknown constant tag 99"},
+		{"bad boolean", badBoolean, "boolean byte 2"},
+		{"bad source map", badSourceMap, "source map offset 3 out of order or range"},
+	}
+
+	for _, tt := range tests {
+		_, err := Deserialize(tt.data)
+		if err == nil {
+			t.Errorf("%s: expected error, got none", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want substring %q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+
+	_, err = Deserialize([]byte("NOPE"))
+	if !errors.Is(err, ErrNotBytecode) {
+		t.Errorf("expected ErrNotBytecode, got=%v", err)
+	}
+}
+
+// TestSerializeUnsupportedConstant verifies that constants without an encoding are reported.
+func TestSerializeUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{&object.Array{}}}
+
+	_, err := bytecode.Serialize()
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if err.Error() != "constant 0: cannot serialize constant of type ARRAY" {
+		t.Errorf("wrong error: %q", err)
+	}
+}
+
+// FuzzBytecodeRoundTrip verifies that Deserialize returns an error instead of panicking on arbitrary data,
+// and that bytecode it accepts serializes back to the same bytes.
+func FuzzBytecodeRoundTrip(f *testing.F) {
+	programs := []string{
+		`1 + 2 * 3`,
+		`let greeting = "hello"; puts(greeting + " world");`,
+		`let add = fn(a, b) { let c = a + b; c }; let wrapper = fn(x) { fn(y) { add(x, y) } }; wrapper(1)(2);`,
+		`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10) == 55;`,
+		`let h = {"a": [1, 2], true: null}; for (let i = 0; i < 3; i++) { if (i in h["a"]) { continue; } }`,
+	}
+	for _, input := range programs {
+		compiler := New(WithDebugInfo())
+		err := compiler.Compile(parse(input))
+		if err != nil {
+			f.Fatalf("compiler error: %s", err)
+		}
+		data, err := compiler.Bytecode().Serialize()
+		if err != nil {
+			f.Fatalf("serialize error: %s", err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{})
+	f.Add([]byte(magic))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := Deserialize(data)
+		if err != nil {
+			return
+		}
+
+		reserialized, err := bytecode.Serialize()
+		if err != nil {
+			t.Fatalf("serialize error after successful deserialization: %s", err)
+		}
+		// The header records the number of opcodes of the build that wrote the data, which may be older.
+		if !bytes.Equal(reserialized[8:], data[8:]) {
+			t.Fatalf("round trip is not stable.\nin =%x\nout=%x", data, reserialized)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package compiler
+
+import (
+	"maps"
+
+	"github.com/dr8co/kong/ast"
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/token"
+)
+
+// setPosition makes span the source position of the instructions emitted next, and returns the previous one.
+func (c *Compiler) setPosition(span code.SourceSpan) code.SourceSpan {
+	previous := c.position
+	c.position = span
+	return previous
+}
+
+// forgetSourceFrom removes the source map entries of the instructions from pos onwards in the current scope,
+// after those instructions have been removed.
+func (c *Compiler) forgetSourceFrom(pos int) {
+	maps.DeleteFunc(c.scopes[c.scopeIndex].sourceMap, func(offset int, _ code.SourceSpan) bool {
+		return offset >= pos
+	})
+}
+
+// sourceSpan returns the source span of the token that identifies node: its operator, keyword or literal.
+//
+// It reports false for nodes that only group others, like programs and blocks,
+// so that their instructions keep the positions of the statements they come from.
+func sourceSpan(node ast.Node) (code.SourceSpan, bool) {
+	var tok token.Token
+
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		tok = node.Token
+	case *ast.ReturnStatement:
+		tok = node.Token
+	case *ast.ExpressionStatement:
+		tok = node.Token
+	case *ast.AssignStatement:
+		tok = node.Token
+	case *ast.IndexAssignStatement:
+		tok = node.Token
+	case *ast.IncDecStatement:
+		tok = node.Token
+	case *ast.WhileStatement:
+		tok = node.Token
+	case *ast.ForStatement:
+		tok = node.Token
+	case *ast.BreakStatement:
+		tok = node.Token
+	case *ast.ContinueStatement:
+		tok = node.Token
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.IntegerLiteral:
+		tok = node.Token
+	case *ast.StringLiteral:
+		tok = node.Token
+	case *ast.Boolean:
+		tok = node.Token
+	case *ast.NullLiteral:
+		tok = node.Token
+	case *ast.PrefixExpression:
+		tok = node.Token
+	case *ast.InfixExpression:
+		tok = node.Token
+	case *ast.TernaryExpression:
+		tok = node.Token
+	case *ast.IfExpression:
+		tok = node.Token
+	case *ast.FunctionLiteral:
+		tok = node.Token
+	case *ast.CallExpression:
+		tok = node.Token
+	case *ast.MethodCallExpression:
+		tok = node.Token
+	case *ast.ArrayLiteral:
+		tok = node.Token
+	case *ast.HashLiteral:
+		tok = node.Token
+	case *ast.IndexExpression:
+		tok = node.Token
+	case *ast.SliceExpression:
+		tok = node.Token
+	}
+
+	if tok.Line == 0 {
+		return code.SourceSpan{}, false
+	}
+	return code.SourceSpan{Line: tok.Line, Column: tok.Column, Length: tok.Length}, true
+}
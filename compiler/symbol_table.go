@@ -1,5 +1,10 @@
 package compiler
 
+import (
+	"cmp"
+	"slices"
+)
+
 // SymbolScope represents the scope of a symbol within a program, such as global, local, builtin, free, or function.
 type SymbolScope string
 
@@ -32,6 +37,9 @@ type Symbol struct {
 
 	// The position of the symbol within its respective scope or table.
 	Index int
+
+	// Constant reports whether the symbol was defined with "const", and cannot be reassigned.
+	Constant bool
 }
 
 // SymbolTable manages variable bindings, symbol definition, and resolution within nested or global scopes.
@@ -79,6 +87,14 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
+// DefineConstant adds a new symbol like [SymbolTable.Define], marked as a constant that cannot be reassigned.
+func (s *SymbolTable) DefineConstant(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Constant = true
+	s.store[name] = symbol
+	return symbol
+}
+
 // Resolve looks up a symbol by name in the current symbol table and, if not found, in enclosing scopes recursively.
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
@@ -94,6 +110,17 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return obj, ok
 }
 
+// lookup finds the symbol of name in this table or the enclosing ones, like [SymbolTable.Resolve],
+// but without capturing it as a free variable of the tables in between.
+func (s *SymbolTable) lookup(name string) (Symbol, bool) {
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
 // DefineBuiltin adds a symbol with a built-in scope to the symbol table using the given index and name.
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
@@ -104,7 +131,7 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 // defineFree adds a free symbol to the FreeSymbols collection and assigns it a FreeScope with a new index.
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Constant: original.Constant}
 
 	symbol.Scope = FreeScope
 	s.store[original.Name] = symbol
@@ -119,3 +146,36 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	s.store[name] = symbol
 	return symbol
 }
+
+// Symbols returns the symbols of the given scope defined directly in this table, ordered by index.
+// Names that were redefined are only listed with their latest definition.
+func (s *SymbolTable) Symbols(scope SymbolScope) []Symbol {
+	var symbols []Symbol
+	for _, symbol := range s.store {
+		if symbol.Scope == scope {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	slices.SortFunc(symbols, func(a, b Symbol) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	return symbols
+}
+
+// localNames returns the names of the local variables defined in this table, indexed by their slot.
+// The slot of a name that was redefined in the same table has an empty name.
+func (s *SymbolTable) localNames() []string {
+	names := make([]string, s.numDefinitions)
+	for _, symbol := range s.Symbols(LocalScope) {
+		names[symbol.Index] = symbol.Name
+	}
+	return names
+}
+
+// definedConstant reports whether name is a constant defined directly in this table,
+// as opposed to one captured from or shadowed in another scope.
+func (s *SymbolTable) definedConstant(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Constant && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope)
+}
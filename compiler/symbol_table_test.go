@@ -333,3 +333,34 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
 	}
 }
+
+// TestSymbols tests listing the symbols of a scope in definition order.
+func TestSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+	global.Define("c")
+	global.Define("b")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 1},
+		{Name: "c", Scope: GlobalScope, Index: 2},
+		{Name: "b", Scope: GlobalScope, Index: 3},
+	}
+
+	result := global.Symbols(GlobalScope)
+	if len(result) != len(expected) {
+		t.Fatalf("wrong number of symbols. want=%d, got=%d (%+v)", len(expected), len(result), result)
+	}
+	for i, sym := range expected {
+		if result[i] != sym {
+			t.Errorf("wrong symbol at %d. want=%+v, got=%+v", i, sym, result[i])
+		}
+	}
+
+	builtins := global.Symbols(BuiltinScope)
+	if len(builtins) != 1 || builtins[0].Name != "len" {
+		t.Errorf("wrong builtin symbols. got=%+v", builtins)
+	}
+}
@@ -0,0 +1,58 @@
+package compiler
+
+import "github.com/dr8co/kong/ast"
+
+// unusedFunctions returns the top-level "let" statements of program that bind a function
+// which is never referenced, directly or through other functions, by the rest of the program.
+//
+// The analysis is by name and conservative: a function is kept if its name appears as an identifier
+// anywhere in the reachable code, even as a local variable, a parameter or a method name,
+// and a name bound by more than one top-level statement is always kept.
+func unusedFunctions(program *ast.Program) map[*ast.LetStatement]bool {
+	bindings := make(map[string]int)
+	for _, s := range program.Statements {
+		if let, ok := s.(*ast.LetStatement); ok && let.Name != nil {
+			bindings[let.Name.Value]++
+		}
+	}
+
+	// Functions bound exactly once at the top level are candidates for removal;
+	// every other statement is reachable.
+	candidates := make(map[string]*ast.LetStatement)
+	var reachable []ast.Node
+	for _, s := range program.Statements {
+		if let, ok := s.(*ast.LetStatement); ok && let.Name != nil && bindings[let.Name.Value] == 1 {
+			if _, isFunction := let.Value.(*ast.FunctionLiteral); isFunction {
+				candidates[let.Name.Value] = let
+				continue
+			}
+		}
+		reachable = append(reachable, s)
+	}
+
+	used := make(map[string]bool)
+	for len(reachable) > 0 {
+		node := reachable[len(reachable)-1]
+		reachable = reachable[:len(reachable)-1]
+
+		ast.Walk(node, func(n ast.Node) bool {
+			id, ok := n.(*ast.Identifier)
+			if !ok || used[id.Value] {
+				return true
+			}
+			used[id.Value] = true
+			if let, isCandidate := candidates[id.Value]; isCandidate {
+				reachable = append(reachable, let.Value)
+			}
+			return true
+		})
+	}
+
+	unused := make(map[*ast.LetStatement]bool)
+	for name, let := range candidates {
+		if !used[name] {
+			unused[let] = true
+		}
+	}
+	return unused
+}
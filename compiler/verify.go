@@ -0,0 +1,64 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/object"
+)
+
+// Verify checks the structure of the bytecode, as bytecode loaded from a file may be corrupt or crafted.
+//
+// The instructions of the program and of each compiled function in the constant pool are checked with
+// [code.Verify]. In addition, every OpClosure instruction must refer to a compiled function, every
+// OpGetBuiltin instruction to an existing builtin, and every local to one of the locals of its function.
+//
+// Verify does not track the depth of the stack or the free variables of closures. The virtual machine
+// reports calls without a callee, missing free variables and returns from the main program as errors,
+// but bytecode that passes Verify can still underflow the stack and make the virtual machine panic,
+// so programs that run bytecode from untrusted files should recover from runtime panics.
+func (b *Bytecode) Verify() error {
+	err := verifyInstructions(b.Instructions, b.Constants, 0)
+	if err != nil {
+		return fmt.Errorf("invalid bytecode: %w", err)
+	}
+
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		err = verifyInstructions(fn.Instructions, b.Constants, fn.NumLocals)
+		if err != nil {
+			return fmt.Errorf("invalid bytecode: constant %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// verifyInstructions checks the instructions of the program or of a function with numLocals locals.
+func verifyInstructions(ins code.Instructions, constants []object.Object, numLocals int) error {
+	err := code.Verify(ins, len(constants))
+	if err != nil {
+		return err
+	}
+
+	return code.ForEachInstruction(ins, func(i int, op code.Opcode, operands []int) error {
+		switch op {
+		case code.OpClosure:
+			if _, ok := constants[operands[0]].(*object.CompiledFunction); !ok {
+				return fmt.Errorf("at offset %d: constant %d is not a function", i, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return fmt.Errorf("at offset %d: builtin index %d out of range (%d builtins)",
+					i, operands[0], len(object.Builtins))
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if operands[0] >= numLocals {
+				return fmt.Errorf("at offset %d: local index %d out of range (%d locals)", i, operands[0], numLocals)
+			}
+		}
+		return nil
+	})
+}
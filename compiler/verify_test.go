@@ -0,0 +1,89 @@
+package compiler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/object"
+)
+
+// TestVerify verifies that compiled programs pass verification and that crafted bytecode is rejected.
+func TestVerify(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`
+	let add = fn(a, b) { let c = a + b; c };
+	let wrapper = fn(x) { fn(y) { add(x, y) } };
+	for (let i = 0; i < 3; i++) { if (i == 1) { continue; } puts(wrapper(i)(len("ab"))); }
+	`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = compiler.Bytecode().Verify()
+	if err != nil {
+		t.Errorf("compiled bytecode failed verification: %s", err)
+	}
+
+	function := func(numLocals int, ins ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: slices.Concat(ins...), NumLocals: numLocals}
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			name:     "bad jump",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpJump, 1)},
+			expected: "invalid bytecode: at offset 0: jump target 1 is not the start of an instruction",
+		},
+		{
+			name: "closure of a non-function",
+			bytecode: &Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+			expected: "invalid bytecode: at offset 0: constant 0 is not a function",
+		},
+		{
+			name:     "unknown builtin",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpGetBuiltin, 255)},
+			expected: "builtin index 255 out of range",
+		},
+		{
+			name:     "local outside a function",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			expected: "invalid bytecode: at offset 0: local index 0 out of range (0 locals)",
+		},
+		{
+			name: "local out of range in a function",
+			bytecode: &Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants: []object.Object{
+					function(1, code.Make(code.OpGetLocal, 0), code.Make(code.OpSetLocal, 1)),
+				},
+			},
+			expected: "invalid bytecode: constant 0: at offset 2: local index 1 out of range (1 locals)",
+		},
+		{
+			name: "function referring to a missing constant",
+			bytecode: &Bytecode{
+				Constants: []object.Object{function(0, code.Make(code.OpConstant, 1), code.Make(code.OpReturnValue))},
+			},
+			expected: "invalid bytecode: constant 0: at offset 0: constant index 1 out of range (pool has 1 constants)",
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.bytecode.Verify()
+		if err == nil {
+			t.Errorf("%s: expected error, got none", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want substring %q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
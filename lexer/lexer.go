@@ -17,7 +17,9 @@
 package lexer
 
 import (
+	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/dr8co/kong/token"
 )
@@ -28,10 +30,18 @@ var (
 	tokenMinus     = token.Token{Type: token.Minus, Literal: "-"}
 	tokenSlash     = token.Token{Type: token.Slash, Literal: "/"}
 	tokenAsterisk  = token.Token{Type: token.Asterisk, Literal: "*"}
+	tokenPercent   = token.Token{Type: token.Percent, Literal: "%"}
 	tokenLT        = token.Token{Type: token.Lt, Literal: "<"}
 	tokenLTE       = token.Token{Type: token.Lte, Literal: "<="}
 	tokenGT        = token.Token{Type: token.Gt, Literal: ">"}
 	tokenGTE       = token.Token{Type: token.Gte, Literal: ">="}
+	tokenPlusEq    = token.Token{Type: token.PlusAssign, Literal: "+="}
+	tokenMinusEq   = token.Token{Type: token.MinusAssign, Literal: "-="}
+	tokenSlashEq   = token.Token{Type: token.SlashAssign, Literal: "/="}
+	tokenAsterEq   = token.Token{Type: token.AsteriskAssign, Literal: "*="}
+	tokenPercentEq = token.Token{Type: token.PercentAssign, Literal: "%="}
+	tokenInc       = token.Token{Type: token.Inc, Literal: "++"}
+	tokenDec       = token.Token{Type: token.Dec, Literal: "--"}
 	tokenSemicolon = token.Token{Type: token.Semicolon, Literal: ";"}
 	tokenColon     = token.Token{Type: token.Colon, Literal: ":"}
 	tokenComma     = token.Token{Type: token.Comma, Literal: ","}
@@ -41,6 +51,10 @@ var (
 	tokenRBrace    = token.Token{Type: token.Rbrace, Literal: "}"}
 	tokenLBracket  = token.Token{Type: token.Lbracket, Literal: "["}
 	tokenRBracket  = token.Token{Type: token.Rbracket, Literal: "]"}
+	tokenAt        = token.Token{Type: token.At, Literal: "@"}
+	tokenDot       = token.Token{Type: token.Dot, Literal: "."}
+	tokenQuestion  = token.Token{Type: token.Question, Literal: "?"}
+	tokenArrow     = token.Token{Type: token.Arrow, Literal: "=>"}
 	tokenEOF       = token.Token{Type: token.EOF, Literal: ""}
 )
 
@@ -50,6 +64,9 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	// line is the line of the current character, and lineStart the position where that line starts.
+	line      int
+	lineStart int
 	// Pre-allocates a token to reuse for single-character tokens
 	singleCharToken token.Token
 }
@@ -57,6 +74,10 @@ type Lexer struct {
 // readChar reads the next character from the input and advances the position.
 // It's optimized to minimize checks and operations.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -71,6 +92,7 @@ func (l *Lexer) readChar() {
 func New(input string) *Lexer {
 	l := &Lexer{
 		input:           input,
+		line:            1,
 		singleCharToken: token.Token{}, // Initialize the token buffer
 	}
 	l.readChar()
@@ -79,10 +101,36 @@ func New(input string) *Lexer {
 
 // NextToken reads the next token from the input.
 // It skips whitespace, identifies the token type based on the current character,
-// and returns a token with the appropriate type and literal value.
+// and returns a token with the appropriate type and literal value, and its position in the input.
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 
+	start := min(l.position, len(l.input))
+	line, column := l.line, start-l.lineStart+1
+
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+	tok.Length = min(l.position, len(l.input)) - start
+	return tok
+}
+
+// Tokens reads the remaining tokens from the input and returns them, up to and including the EOF token.
+// It advances the lexer to the end of the input, so it can only be used once per lexer,
+// and not together with NextToken: later calls return only the EOF token.
+func (l *Lexer) Tokens() []token.Token {
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+// readToken reads the token starting at the current character.
+func (l *Lexer) readToken() token.Token {
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -92,6 +140,12 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar() // Advance to the next character after '=='
 			return token.Token{Type: token.Eq, Literal: string(ch) + string('=')}
 		}
+		if l.peekChar() == '>' {
+			l.readChar()
+			// advance past '>'
+			l.readChar()
+			return tokenArrow
+		}
 		l.readChar() // Advance to the next character after '='
 		return token.Token{Type: token.Assign, Literal: "="}
 	case '!':
@@ -105,17 +159,71 @@ func (l *Lexer) NextToken() token.Token {
 		l.readChar() // Advance to the next character after '!'
 		return token.Token{Type: token.Bang, Literal: "!"}
 	case '+':
+		if l.peekChar() == '=' {
+			l.readChar()
+			// advance past '='
+			l.readChar()
+			return tokenPlusEq
+		}
+		if l.peekChar() == '+' {
+			l.readChar()
+			// advance past the second '+'
+			l.readChar()
+			return tokenInc
+		}
 		l.readChar() // Advance to the next character after '+'
 		return tokenPlus
 	case '-':
+		if l.peekChar() == '=' {
+			l.readChar()
+			// advance past '='
+			l.readChar()
+			return tokenMinusEq
+		}
+		if l.peekChar() == '-' {
+			l.readChar()
+			// advance past the second '-'
+			l.readChar()
+			return tokenDec
+		}
 		l.readChar() // Advance to the next character after '-'
 		return tokenMinus
 	case '/':
+		if l.peekChar() == '*' {
+			// skipWhitespace leaves only unterminated block comments; the comment runs to the end of the input.
+			for l.ch != 0 {
+				l.readChar()
+			}
+			l.singleCharToken.Type = token.Illegal
+			l.singleCharToken.Literal = "unterminated comment"
+			return l.singleCharToken
+		}
+		if l.peekChar() == '=' {
+			l.readChar()
+			// advance past '='
+			l.readChar()
+			return tokenSlashEq
+		}
 		l.readChar() // Advance to the next character after '/'
 		return tokenSlash
 	case '*':
+		if l.peekChar() == '=' {
+			l.readChar()
+			// advance past '='
+			l.readChar()
+			return tokenAsterEq
+		}
 		l.readChar() // Advance to the next character after '*'
 		return tokenAsterisk
+	case '%':
+		if l.peekChar() == '=' {
+			l.readChar()
+			// advance past '='
+			l.readChar()
+			return tokenPercentEq
+		}
+		l.readChar() // Advance to the next character after '%'
+		return tokenPercent
 	case '<':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -161,19 +269,31 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		l.readChar() // Advance to the next character after ']'
 		return tokenRBracket
+	case '@':
+		l.readChar() // Advance to the next character after '@'
+		return tokenAt
+	case '.':
+		l.readChar() // Advance to the next character after '.'
+		return tokenDot
+	case '?':
+		l.readChar() // Advance to the next character after '?'
+		return tokenQuestion
 	case '"':
-		// readString returns the unescaped content and a bool indicating whether the
-		// string was properly terminated (closed by a matching quote).
-		lit, ok := l.readString()
-		if !ok {
-			// unterminated string literal
+		// readString returns the unescaped content and a description of what is wrong
+		// with the literal, such as a missing closing quote, or "" if nothing is.
+		lit, problem := l.readString()
+		if problem == "unterminated string" {
 			l.singleCharToken.Type = token.Illegal
-			l.singleCharToken.Literal = "unterminated string"
+			l.singleCharToken.Literal = problem
 			return l.singleCharToken
 		}
-		tok := token.Token{Type: token.String, Literal: lit}
 		l.readChar() // Advance to the next character after the closing quote
-		return tok
+		if problem != "" {
+			l.singleCharToken.Type = token.Illegal
+			l.singleCharToken.Literal = problem
+			return l.singleCharToken
+		}
+		return token.Token{Type: token.String, Literal: lit}
 	case 0:
 		return tokenEOF
 	default:
@@ -208,8 +328,19 @@ func isDigit(ch byte) bool {
 
 // readNumber reads a number from the input and returns it as a string.
 // It's optimized to avoid unnecessary allocations.
+//
+// A number starting with a base prefix ("0x", "0b" or "0o") runs until the end of the word,
+// so that invalid digits like the "g" in "0xfg" are reported by the parser instead of starting a new token.
 func (l *Lexer) readNumber() string {
 	position := l.position
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		return l.input[position:l.position]
+	}
 	// Fast-forward through digits
 	for isDigit(l.ch) {
 		l.readChar()
@@ -217,6 +348,15 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
+func isBasePrefix(ch byte) bool {
+	switch ch {
+	case 'x', 'X', 'b', 'B', 'o', 'O':
+		return true
+	default:
+		return false
+	}
+}
+
 // readIdentifier reads an identifier from the input and returns it as a string.
 // It's optimized to avoid unnecessary allocations.
 func (l *Lexer) readIdentifier() string {
@@ -230,8 +370,9 @@ func (l *Lexer) readIdentifier() string {
 
 // skipWhitespace skips any whitespace characters (and comments) in the input.
 // It's optimized to use a single loop.
+// An unterminated block comment is not skipped, so that readToken can report it.
 func (l *Lexer) skipWhitespace() {
-	// Fast-forward through whitespace and skip `//` line comments.
+	// Fast-forward through whitespace, `//` line comments and `/* */` block comments.
 	for {
 		// skip ordinary whitespace
 		if l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
@@ -252,6 +393,22 @@ func (l *Lexer) skipWhitespace() {
 			continue
 		}
 
+		// skip /* */ comments, which may span lines but do not nest:
+		// the first */ ends the comment.
+		if l.ch == '/' && l.peekChar() == '*' && strings.Contains(l.input[l.readPosition+1:], "*/") {
+			// consume "/*"
+			l.readChar()
+			l.readChar()
+			// advance until "*/", reading through newlines so that line numbers stay accurate
+			for l.ch != '*' || l.peekChar() != '/' {
+				l.readChar()
+			}
+			// consume "*/"
+			l.readChar()
+			l.readChar()
+			continue
+		}
+
 		break
 	}
 }
@@ -266,9 +423,11 @@ func (l *Lexer) peekChar() byte {
 }
 
 // readString reads a string from the input and returns the unescaped content and
-// a boolean indicating whether the string was properly terminated (closed by a quote).
-func (l *Lexer) readString() (string, bool) {
+// a description of what is wrong with the literal, or "" if it is well-formed:
+// "unterminated string" if it is not closed by a quote, or the first malformed escape sequence.
+func (l *Lexer) readString() (string, string) {
 	var b strings.Builder
+	var problem string
 
 	// advance to the first character inside the quotes
 	l.readChar()
@@ -276,12 +435,12 @@ func (l *Lexer) readString() (string, bool) {
 	for {
 		if l.ch == '"' {
 			// properly terminated
-			return b.String(), true
+			return b.String(), problem
 		}
 
 		if l.ch == 0 {
 			// reached EOF without closing quote
-			return b.String(), false
+			return b.String(), "unterminated string"
 		}
 
 		if l.ch == '\\' {
@@ -289,7 +448,7 @@ func (l *Lexer) readString() (string, bool) {
 			l.readChar()
 			if l.ch == 0 {
 				// backslash at EOF — unterminated
-				return b.String(), false
+				return b.String(), "unterminated string"
 			}
 			switch l.ch {
 			case 'n':
@@ -302,6 +461,14 @@ func (l *Lexer) readString() (string, bool) {
 				b.WriteByte('"')
 			case '\\':
 				b.WriteByte('\\')
+			case '0':
+				b.WriteByte(0)
+			case 'x', 'u':
+				// A malformed escape is reported once the whole literal is read,
+				// so that lexing resumes after its closing quote.
+				if msg := l.readNumericEscape(&b); msg != "" && problem == "" {
+					problem = msg
+				}
 			default:
 				// Unknown escape: preserve backslash and the char
 				b.WriteByte('\\')
@@ -314,3 +481,53 @@ func (l *Lexer) readString() (string, bool) {
 		l.readChar()
 	}
 }
+
+// readNumericEscape reads the hex digits of a \xHH or \uHHHH escape, the current character being the 'x' or 'u',
+// and writes the byte or the UTF-8 encoding of the code point they stand for to b.
+// It leaves the lexer on the last digit, and returns a description of the escape if it is malformed, or "".
+func (l *Lexer) readNumericEscape(b *strings.Builder) string {
+	start := l.position
+	kind := l.ch
+	digits := 2
+	if kind == 'u' {
+		digits = 4
+	}
+
+	var value rune
+	for range digits {
+		next := l.peekChar()
+		digit, ok := hexDigitValue(next)
+		if !ok {
+			escape := `\` + l.input[start:l.position+1]
+			if ' ' < next && next < utf8.RuneSelf && next != '"' && next != '\\' {
+				escape += string(next)
+			}
+			return fmt.Sprintf("invalid escape sequence %s: want %d hex digits", escape, digits)
+		}
+		value = value<<4 | digit
+		l.readChar()
+	}
+
+	if kind == 'x' {
+		b.WriteByte(byte(value))
+		return ""
+	}
+	if !utf8.ValidRune(value) {
+		return fmt.Sprintf("invalid escape sequence \\u%04x: not a valid code point", value)
+	}
+	b.WriteRune(value)
+	return ""
+}
+
+// hexDigitValue returns the value of the hexadecimal digit ch, and false if ch is not one.
+func hexDigitValue(ch byte) (rune, bool) {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return rune(ch - '0'), true
+	case 'a' <= ch && ch <= 'f':
+		return rune(ch - 'a' + 10), true
+	case 'A' <= ch && ch <= 'F':
+		return rune(ch - 'A' + 10), true
+	}
+	return 0, false
+}
@@ -14,7 +14,7 @@ let add = fn(x, y) {
     x + y;
 };
 let result = add(five, ten);
-!-/*5;
+!-/ *%5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -75,6 +75,7 @@ if (5 < 10) {
 		{token.Minus, "-"},
 		{token.Slash, "/"},
 		{token.Asterisk, "*"},
+		{token.Percent, "%"},
 		{token.Int, "5"},
 		{token.Semicolon, ";"},
 		{token.Int, "5"},
@@ -414,6 +415,114 @@ func TestDivisionFollowedByComment(t *testing.T) {
 	}
 }
 
+// TestBlockComments verifies that /* */ comments are skipped whether they fit on one line or span several,
+// that they do not nest, and that tokens following a comment keep their position.
+func TestBlockComments(t *testing.T) {
+	input := `let a = /* inline */ 1;
+/* spans
+   two lines */ let b = 2 /**/ * 3;
+/* a /* b */ c */`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		line, column    int
+	}{
+		{token.Let, "let", 1, 1},
+		{token.Ident, "a", 1, 5},
+		{token.Assign, "=", 1, 7},
+		{token.Int, "1", 1, 22},
+		{token.Semicolon, ";", 1, 23},
+		{token.Let, "let", 3, 17},
+		{token.Ident, "b", 3, 21},
+		{token.Assign, "=", 3, 23},
+		{token.Int, "2", 3, 25},
+		{token.Asterisk, "*", 3, 32},
+		{token.Int, "3", 3, 34},
+		{token.Semicolon, ";", 3, 35},
+		// The first */ ends the comment.
+		{token.Ident, "c", 4, 14},
+		{token.Asterisk, "*", 4, 16},
+		{token.Slash, "/", 4, 17},
+		{token.EOF, "", 4, 18},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.line || tok.Column != tt.column {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.line, tt.column, tok.Line, tok.Column)
+		}
+	}
+}
+
+// TestUnterminatedBlockComment verifies that a block comment left open at the end of the input
+// is reported as a single illegal token that consumes the rest of the input.
+func TestUnterminatedBlockComment(t *testing.T) {
+	tests := []string{
+		"let x = 1; /* never closed",
+		"/*",
+		"/*/",
+		"x /* almost *",
+	}
+
+	for _, input := range tests {
+		l := New(input)
+		tok := l.NextToken()
+		for tok.Type != token.Illegal && tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+		if tok.Type != token.Illegal || tok.Literal != "unterminated comment" {
+			t.Fatalf("input %q: expected illegal token %q, got %s %q", input, "unterminated comment", tok.Type, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("input %q: expected EOF after the comment, got %s %q", input, next.Type, next.Literal)
+		}
+	}
+}
+
+// TestTokens verifies that Tokens returns the same tokens as calling NextToken until EOF,
+// including the EOF token, and that the lexer is drained afterwards.
+func TestTokens(t *testing.T) {
+	input := `let add = fn(x, y) { x + y; };
+/* sum */ add(1, 2) >= 3 ? "yes\n" : [1, 2][0];
+let h = {"a": 1}; // trailing comment
+h.a += 1;`
+
+	var want []token.Token
+	l := New(input)
+	for {
+		tok := l.NextToken()
+		want = append(want, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	l = New(input)
+	got := l.Tokens()
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of tokens. want=%d, got=%d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("tokens[%d] wrong. want=%+v, got=%+v", i, want[i], got[i])
+		}
+	}
+
+	if again := l.Tokens(); len(again) != 1 || again[0].Type != token.EOF {
+		t.Fatalf("expected only EOF from a drained lexer, got %+v", again)
+	}
+}
+
 // TestSingleSlashAtEOF validates that the lexer correctly identifies a single slash token followed by an EOF token.
 func TestSingleSlashAtEOF(t *testing.T) {
 	input := `/`
@@ -484,6 +593,41 @@ func TestStringEscapes(t *testing.T) {
 	}
 }
 
+func TestNumericStringEscapes(t *testing.T) {
+	input := `"\x41\x62c" "\u00e9t\u00E9" "nul:\0." "\u20ac\xff" "\xZZ" "\x4" "\u12g4 x" "\ud800" "\q" "after"`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.String, "Abc"},
+		{token.String, "été"},
+		{token.String, "nul:\x00."},
+		{token.String, "€\xff"},
+		{token.Illegal, `invalid escape sequence \xZ: want 2 hex digits`},
+		{token.Illegal, `invalid escape sequence \x4: want 2 hex digits`},
+		{token.Illegal, `invalid escape sequence \u12g: want 4 hex digits`},
+		{token.Illegal, `invalid escape sequence \ud800: not a valid code point`},
+		// Unknown escapes are kept as they are.
+		{token.String, `\q`},
+		// Lexing resumes after a string with a malformed escape.
+		{token.String, "after"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
 func TestUnterminatedString(t *testing.T) {
 	input := `"no end`
 
@@ -497,3 +641,371 @@ func TestUnterminatedString(t *testing.T) {
 		t.Fatalf("expected literal 'unterminated string', got %q", tok.Literal)
 	}
 }
+
+func TestAtToken(t *testing.T) {
+	input := `@memoize fn(x) { x }; @ @a`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.At, "@"},
+		{token.Ident, "memoize"},
+		{token.Function, "fn"},
+		{token.Lparen, "("},
+		{token.Ident, "x"},
+		{token.Rparen, ")"},
+		{token.Lbrace, "{"},
+		{token.Ident, "x"},
+		{token.Rbrace, "}"},
+		{token.Semicolon, ";"},
+		{token.At, "@"},
+		{token.At, "@"},
+		{token.Ident, "a"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestLoopKeywords tests that the loop keywords are recognized.
+func TestLoopKeywords(t *testing.T) {
+	input := `while for break continue whilst`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.While, "while"},
+		{token.For, "for"},
+		{token.Break, "break"},
+		{token.Continue, "continue"},
+		{token.Ident, "whilst"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestInKeyword(t *testing.T) {
+	input := `x in xs; index`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Ident, "x"},
+		{token.In, "in"},
+		{token.Ident, "xs"},
+		{token.Semicolon, ";"},
+		{token.Ident, "index"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestArrowToken(t *testing.T) {
+	input := `(x) => x == 1 = >`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Lparen, "("},
+		{token.Ident, "x"},
+		{token.Rparen, ")"},
+		{token.Arrow, "=>"},
+		{token.Ident, "x"},
+		{token.Eq, "=="},
+		{token.Int, "1"},
+		{token.Assign, "="},
+		{token.Gt, ">"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestCompoundAssignmentOperators tests that compound assignment operators are lexed as single tokens.
+func TestCompoundAssignmentOperators(t *testing.T) {
+	input := `x += 1; x -= 2; x *= 3; x /= 4; x %= 3; x + = 5;`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Ident, "x"}, {token.PlusAssign, "+="}, {token.Int, "1"}, {token.Semicolon, ";"},
+		{token.Ident, "x"}, {token.MinusAssign, "-="}, {token.Int, "2"}, {token.Semicolon, ";"},
+		{token.Ident, "x"}, {token.AsteriskAssign, "*="}, {token.Int, "3"}, {token.Semicolon, ";"},
+		{token.Ident, "x"}, {token.SlashAssign, "/="}, {token.Int, "4"}, {token.Semicolon, ";"},
+		{token.Ident, "x"}, {token.PercentAssign, "%="}, {token.Int, "3"}, {token.Semicolon, ";"},
+		{token.Ident, "x"}, {token.Plus, "+"}, {token.Assign, "="}, {token.Int, "5"}, {token.Semicolon, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestIncDecOperators(t *testing.T) {
+	input := `i++; i--; a - -b; +-`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Ident, "i"}, {token.Inc, "++"}, {token.Semicolon, ";"},
+		{token.Ident, "i"}, {token.Dec, "--"}, {token.Semicolon, ";"},
+		{token.Ident, "a"}, {token.Minus, "-"}, {token.Minus, "-"}, {token.Ident, "b"}, {token.Semicolon, ";"},
+		{token.Plus, "+"}, {token.Minus, "-"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestIntegerBases(t *testing.T) {
+	input := `0xff 0B101 0o17 0 10 0xfg+1`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Int, "0xff"},
+		{token.Int, "0B101"},
+		{token.Int, "0o17"},
+		{token.Int, "0"},
+		{token.Int, "10"},
+		{token.Int, "0xfg"},
+		{token.Plus, "+"},
+		{token.Int, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestDotToken tests that '.' is recognized as a field access and method call operator.
+func TestDotToken(t *testing.T) {
+	input := `rect.area(); a.b.c`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Ident, "rect"},
+		{token.Dot, "."},
+		{token.Ident, "area"},
+		{token.Lparen, "("},
+		{token.Rparen, ")"},
+		{token.Semicolon, ";"},
+		{token.Ident, "a"},
+		{token.Dot, "."},
+		{token.Ident, "b"},
+		{token.Dot, "."},
+		{token.Ident, "c"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestQuestionToken tests that '?' is recognized as the conditional operator.
+func TestQuestionToken(t *testing.T) {
+	input := `a?b:c`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Ident, "a"},
+		{token.Question, "?"},
+		{token.Ident, "b"},
+		{token.Colon, ":"},
+		{token.Ident, "c"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNullKeyword(t *testing.T) {
+	input := `let x = null; nullable`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.Let, "let"},
+		{token.Ident, "x"},
+		{token.Assign, "="},
+		{token.Null, "null"},
+		{token.Semicolon, ";"},
+		{token.Ident, "nullable"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestTokenPositions tests that tokens record the line, column and length of their source.
+func TestTokenPositions(t *testing.T) {
+	input := "let s = \"a\\nb\";\n  // comment\n\tx >= 10\n"
+
+	tests := []struct {
+		expectedLiteral string
+		line            int
+		column          int
+		length          int
+	}{
+		{"let", 1, 1, 3},
+		{"s", 1, 5, 1},
+		{"=", 1, 7, 1},
+		{"a\nb", 1, 9, 6},
+		{";", 1, 15, 1},
+		{"x", 3, 2, 1},
+		{">=", 3, 4, 2},
+		{"10", 3, 7, 2},
+		{"", 4, 1, 0},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.line || tok.Column != tt.column || tok.Length != tt.length {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d+%d, got=%d:%d+%d",
+				i, tt.line, tt.column, tt.length, tok.Line, tok.Column, tok.Length)
+		}
+	}
+}
+
+// FuzzLexer verifies that the lexer reaches EOF without panicking on any input,
+// and that every token but the last advances through the input.
+func FuzzLexer(f *testing.F) {
+	seeds := []string{
+		"",
+		`let add = fn(x, y) { x + y; }; add(1, 2);`,
+		`"unterminated`,
+		"0x 0b2 0o9 0123 1e5 ++ -- => @memoize",
+		"\x00\xff\xfe{[(",
+		"let ü = \"ünïcödé\"; // comment",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		// Each token consumes at least one byte, so there can be no more tokens than bytes.
+		for range len(input) + 1 {
+			if l.NextToken().Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("lexer did not reach EOF after %d tokens on %q", len(input)+1, input)
+	})
+}
@@ -2,6 +2,8 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -9,17 +11,26 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dr8co/kong/ast"
+	"github.com/dr8co/kong/benchmarks"
 	"github.com/dr8co/kong/compiler"
 	"github.com/dr8co/kong/lexer"
+	"github.com/dr8co/kong/object"
 	"github.com/dr8co/kong/parser"
 	"github.com/dr8co/kong/repl"
+	"github.com/dr8co/kong/token"
 	"github.com/dr8co/kong/vm"
 )
 
 const version = "0.1.0"
 
+// bytecodeExt is the default file extension for compiled bytecode.
+const bytecodeExt = ".kbc"
+
 // printUsage displays custom usage information
 func printUsage() {
 	_, _ = fmt.Fprintf(os.Stderr, `Kong Monkey Compiler v%s
@@ -34,6 +45,25 @@ DESCRIPTION:
 OPTIONS:
     -f, --file <path>       Execute a Monkey script file
     -e, --eval <code>       Evaluate a Monkey expression and print the result
+    --compile <path>        Compile a Monkey script file to bytecode without running it
+    -o, --output <path>     Output path for --compile (default: the script path with a .kbc extension)
+    --run-bytecode <path>   Execute a bytecode file produced by --compile
+    --format <path>         Rewrite a Monkey script file in the canonical layout; files with comments are refused
+    -D, --disassemble       Print the compiled bytecode of a -f file or -e expression instead of running it
+    --emit-dot              Print the AST of a -f file or -e expression as a Graphviz DOT graph
+    --ast                   Print the AST of a -f file or -e expression as an indented tree
+    --tokens                Print the tokens of a -f file or -e expression, with their positions
+    --max-loop-iterations <n>
+                            Stop a program after n loop iterations in total (default: 0, no limit)
+    --timeout <duration>    Stop a program that runs longer than duration, such as 5s (default: 0, no limit)
+    --tree-shake            Leave the top-level functions a program never uses out of its bytecode
+    --warn-shadow           Warn when a parameter or local of a -f file or -e expression shadows an outer variable
+    --stats                 Run a -f file or -e expression and print a summary of each phase
+    --check-determinism     Run a -f file or -e expression twice and report whether the outputs match
+    --limits                Compile a -f file or -e expression and report its use of the constant and global limits
+    --repl-init <path>      Run a Monkey script file in the REPL session before the first prompt
+    --no-color              Print REPL output without colors (colors are only used in a terminal)
+    --benchmark             Run the built-in benchmark programs and report their speed
     -d, --debug             Enable debug mode with more verbose output
     -v, --version           Show version information
     -h, --help              Show this help message
@@ -53,7 +83,51 @@ EXAMPLES:
     # Execute with debug mode
     %s -f script.monkey -d
 
-`, version, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0]) // #nosec G705 - false positive.
+    # Compile a script to bytecode, then run the bytecode
+    %s --compile script.monkey -o script.kbc
+    %s --run-bytecode script.kbc
+
+    # Rewrite a script in the canonical layout
+    %s --format script.monkey
+
+    # Show the bytecode of an expression
+    %s -D -e "1 + 2"
+
+    # List the tokens of a script
+    %s --tokens -f script.monkey
+
+    # Print the syntax tree of an expression
+    %s --ast -e "1 + 2 * 3"
+
+    # Render the syntax tree of a script with Graphviz
+    %s --emit-dot -f script.monkey | dot -Tsvg -o ast.svg
+
+    # Guard against infinite loops
+    %s --max-loop-iterations 1000000 -f script.monkey
+    %s --timeout 5s -f script.monkey
+
+    # Compile a script without the helper functions it never calls
+    %s --compile script.monkey --tree-shake
+
+    # Report shadowed variables before running a script
+    %s --warn-shadow -f script.monkey
+
+    # Show how large a script is at each phase
+    %s --stats -f script.monkey
+
+    # Show how close a script comes to the constant and global limits
+    %s --limits -f script.monkey
+
+    # Check that a script prints the same output on every run
+    %s --check-determinism -f script.monkey
+
+    # Start the REPL with helper functions already defined
+    %s --repl-init helpers.monkey
+
+    # Measure the speed of the interpreter
+    %s --benchmark
+
+`, version, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0]) // #nosec G705 - false positive.
 }
 
 func main() {
@@ -65,12 +139,32 @@ func main() {
 	evalFlag := flag.String("eval", "", "Evaluate a Monkey expression and print the result")
 	debugFlag := flag.Bool("debug", false, "Enable debug mode with more verbose output")
 	versionFlag := flag.Bool("version", false, "Show version information")
+	compileFlag := flag.String("compile", "", "Compile a Monkey script file to bytecode")
+	outputFlag := flag.String("output", "", "Output path for --compile")
+	runBytecodeFlag := flag.String("run-bytecode", "", "Execute a bytecode file produced by --compile")
+	formatFlag := flag.String("format", "", "Rewrite a Monkey script file in the canonical layout")
+	disassembleFlag := flag.Bool("disassemble", false, "Print the compiled bytecode instead of running it")
+	maxLoopIterationsFlag := flag.Int("max-loop-iterations", 0, "Stop a program after n loop iterations in total")
+	timeoutFlag := flag.Duration("timeout", 0, "Stop a program that runs longer than the given duration")
+	treeShakeFlag := flag.Bool("tree-shake", false, "Leave unused top-level functions out of the compiled program")
+	warnShadowFlag := flag.Bool("warn-shadow", false, "Warn about parameters and locals that shadow outer variables")
+	statsFlag := flag.Bool("stats", false, "Print a summary of each phase after running")
+	limitsFlag := flag.Bool("limits", false, "Report the use of the constant pool and globals limits")
+	checkDeterminismFlag := flag.Bool("check-determinism", false, "Run the program twice and compare the outputs")
+	emitDotFlag := flag.Bool("emit-dot", false, "Print the AST as a Graphviz DOT graph instead of running it")
+	astFlag := flag.Bool("ast", false, "Print the AST as an indented tree instead of running it")
+	tokensFlag := flag.Bool("tokens", false, "Print the tokens of the input instead of running it")
+	replInitFlag := flag.String("repl-init", "", "Run a Monkey script file before starting the REPL")
+	noColorFlag := flag.Bool("no-color", false, "Print REPL results, errors and prompts without colors")
+	benchmarkFlag := flag.Bool("benchmark", false, "Run the built-in benchmark programs and report their speed")
 
 	// Define short flag aliases
 	flag.StringVar(fileFlag, "f", "", "Execute a Monkey script file")
 	flag.StringVar(evalFlag, "e", "", "Evaluate a Monkey expression and print the result")
 	flag.BoolVar(debugFlag, "d", false, "Enable debug mode with more verbose output")
 	flag.BoolVar(versionFlag, "v", false, "Show version information")
+	flag.StringVar(outputFlag, "o", "", "Output path for --compile")
+	flag.BoolVar(disassembleFlag, "D", false, "Print the compiled bytecode instead of running it")
 
 	// Parse command-line flags
 	flag.Parse()
@@ -81,22 +175,145 @@ func main() {
 		return
 	}
 
+	// Run the benchmark programs if requested
+	if *benchmarkFlag {
+		if err := runBenchmarks(os.Stdout, benchmarkRuns); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	vmOpts := []vm.Option{vm.WithMaxLoopIterations(*maxLoopIterationsFlag), vm.WithTimeout(*timeoutFlag)}
+
+	var compilerOpts []compiler.Option
+	if *warnShadowFlag {
+		compilerOpts = append(compilerOpts, compiler.WithShadowWarnings())
+	}
+	if *treeShakeFlag {
+		compilerOpts = append(compilerOpts, compiler.WithTreeShaking())
+	}
+
+	// Compile a file to bytecode if specified
+	if *compileFlag != "" {
+		output := *outputFlag
+		if output == "" {
+			output = strings.TrimSuffix(*compileFlag, filepath.Ext(*compileFlag)) + bytecodeExt
+		}
+		if err := compileFile(*compileFlag, output, compilerOpts...); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Bytecode written to: %s\n", output)
+		return
+	}
+
+	// Format a file if specified
+	if *formatFlag != "" {
+		if err := formatFile(*formatFlag); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Execute a bytecode file if specified
+	if *runBytecodeFlag != "" {
+		if err := runBytecodeFile(*runBytecodeFlag, os.Stdout, *debugFlag, vmOpts...); err != nil {
+			if status, ok := exitStatus(err); ok {
+				os.Exit(status)
+			}
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Disassemble a file or an expression if requested
+	if *disassembleFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := disassembleInput(*fileFlag, *evalFlag, os.Stdout, compilerOpts...); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Print the AST of a file or an expression if requested
+	if *emitDotFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := emitDotInput(*fileFlag, *evalFlag, os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Print the tokens of a file or an expression if requested
+	if *tokensFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := dumpTokensInput(*fileFlag, *evalFlag, os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Print the AST of a file or an expression as a tree if requested
+	if *astFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := dumpASTInput(*fileFlag, *evalFlag, os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Run a file or an expression and report its stats if requested
+	if *statsFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := reportStats(*fileFlag, *evalFlag, os.Stdout, vmOpts...); err != nil {
+			if status, ok := exitStatus(err); ok {
+				os.Exit(status)
+			}
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Report the use of the constant pool and globals limits if requested
+	if *limitsFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := reportLimits(*fileFlag, *evalFlag, os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Run a file or an expression twice and compare the outputs if requested
+	if *checkDeterminismFlag && (*fileFlag != "" || *evalFlag != "") {
+		if err := checkDeterminism(*fileFlag, *evalFlag, os.Stdout, vmOpts...); err != nil {
+			if status, ok := exitStatus(err); ok {
+				os.Exit(status)
+			}
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Execute a file if specified
 	if *fileFlag != "" {
-		executeFile(*fileFlag, *debugFlag)
+		executeFile(*fileFlag, *debugFlag, compilerOpts, vmOpts...)
 		return
 	}
 
 	// Evaluate an expression if specified
 	if *evalFlag != "" {
-		evaluateExpression(*evalFlag)
+		evaluateExpression(*evalFlag, compilerOpts, vmOpts...)
 		return
 	}
 
 	// If there are positional (non-flag) arguments, treat them as code to evaluate.
 	if flag.NArg() > 0 {
 		code := strings.Join(flag.Args(), " ")
-		evaluateExpression(code)
+		evaluateExpression(code, compilerOpts, vmOpts...)
 		return
 	}
 
@@ -106,7 +323,7 @@ func main() {
 			// stdin is being piped/redirected
 			if content, err := io.ReadAll(os.Stdin); err == nil {
 				if len(content) > 0 {
-					evaluateExpression(string(content))
+					evaluateExpression(string(content), compilerOpts, vmOpts...)
 					return
 				}
 			}
@@ -128,11 +345,15 @@ func main() {
 	fmt.Printf("Feel free to type in Monkey code. (%s or Ctrl+C to exit)\n", eof)
 
 	// Start the REPL
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Color = !*noColorFlag
+	if err := repl.StartWithInit(os.Stdin, os.Stdout, *replInitFlag); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
 // executeFile reads and executes a Monkey script file
-func executeFile(filename string, debug bool) {
+func executeFile(filename string, debug bool, compilerOpts []compiler.Option, opts ...vm.Option) {
 	cleaned := filepath.Clean(filename)
 	absolute, err := filepath.Abs(cleaned)
 	if err != nil {
@@ -160,19 +381,19 @@ func executeFile(filename string, debug bool) {
 	}
 
 	// Compile the program
-	comp := compiler.New()
+	comp := compiler.New(compilerOpts...)
 	err = comp.Compile(program)
 	if err != nil {
 		fmt.Printf("Compilation error: %s\n", err)
 		os.Exit(1)
 	}
+	printWarnings(comp.Warnings())
 
 	// Run the bytecode in the VM
-	machine := vm.New(comp.Bytecode())
+	machine := vm.New(comp.Bytecode(), opts...)
 	err = machine.Run()
 	if err != nil {
-		fmt.Printf("VM error: %s\n", err)
-		os.Exit(1)
+		exitOnError(err)
 	}
 
 	// Print the result if in debug mode
@@ -184,8 +405,646 @@ func executeFile(filename string, debug bool) {
 	}
 }
 
+// compileSource parses and compiles Monkey source code into bytecode with the given compiler options.
+func compileSource(input string, opts ...compiler.Option) (*compiler.Bytecode, error) {
+	bytecode, _, err := compileProgram(input, opts...)
+	return bytecode, err
+}
+
+// compileProgram parses and compiles Monkey source code with the given compiler options,
+// returning both the bytecode and the parsed program.
+func compileProgram(input string, opts ...compiler.Option) (*compiler.Bytecode, *ast.Program, error) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, nil, errors.New("parser errors:\n\t" + strings.Join(p.Errors(), "\n\t"))
+	}
+
+	comp := compiler.New(opts...)
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compilation error: %w", err)
+	}
+	return comp.Bytecode(), program, nil
+}
+
+// disassemble writes a human-readable listing of the bytecode's instructions and constant pool to out.
+// Compiled functions in the constant pool are listed with their own instructions.
+func disassemble(out io.Writer, bytecode *compiler.Bytecode) error {
+	var b strings.Builder
+
+	b.WriteString("Instructions:\n")
+	b.WriteString(bytecode.Instructions.String())
+
+	b.WriteString("\nConstants:\n")
+	for i, c := range bytecode.Constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			_, _ = fmt.Fprintf(&b, "%04d %s (parameters: %d, locals: %d)\n", i, c.Type(), c.NumParameters, c.NumLocals)
+			for line := range strings.Lines(c.Instructions.String()) {
+				b.WriteString("     " + line)
+			}
+		case *object.String:
+			_, _ = fmt.Fprintf(&b, "%04d %s %q\n", i, c.Type(), c.Value)
+		default:
+			_, _ = fmt.Fprintf(&b, "%04d %s %s\n", i, c.Type(), c.Inspect())
+		}
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// disassembleInput compiles the named file, or expr if filename is empty, with the given compiler options,
+// and writes its disassembly to out.
+func disassembleInput(filename, expr string, out io.Writer, opts ...compiler.Option) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+
+	bytecode, err := compileSource(input, opts...)
+	if err != nil {
+		return err
+	}
+	return disassemble(out, bytecode)
+}
+
+// emitDot writes the AST of program to out as a Graphviz DOT digraph.
+// Each node is labeled with its type and, where it has one, its name, value or operator,
+// and has an edge to each of its children.
+func emitDot(out io.Writer, program *ast.Program) error {
+	var b strings.Builder
+	ids := make(map[ast.Node]int)
+
+	b.WriteString("digraph AST {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	ast.Walk(program, func(node ast.Node) bool {
+		id, ok := ids[node]
+		if !ok {
+			id = len(ids)
+			ids[node] = id
+		}
+		_, _ = fmt.Fprintf(&b, "\tn%d [label=%s];\n", id, dotLabel(node))
+
+		for _, child := range ast.Children(node) {
+			childID := len(ids)
+			ids[child] = childID
+			_, _ = fmt.Fprintf(&b, "\tn%d -> n%d;\n", id, childID)
+		}
+		return true
+	})
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// dotLabel returns the quoted DOT label of an AST node: its type, followed by its literal on a second line.
+func dotLabel(node ast.Node) string {
+	label := nodeType(node)
+	if literal := nodeLiteral(node); literal != "" {
+		label += "\n" + literal
+	}
+
+	// DOT strings escape quotes and backslashes like Go, and render \n as a line break.
+	return strconv.Quote(label)
+}
+
+// nodeType returns the name of the type of an AST node, such as "LetStatement".
+func nodeType(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+// nodeLiteral returns the name, value or operator of an AST node that has one, or "".
+func nodeLiteral(node ast.Node) string {
+	var literal string
+	switch node := node.(type) {
+	case *ast.Identifier:
+		literal = node.Value
+	case *ast.IntegerLiteral, *ast.Boolean:
+		literal = node.TokenLiteral()
+	case *ast.StringLiteral:
+		literal = strconv.Quote(node.Value)
+	case *ast.PrefixExpression:
+		literal = node.Operator
+	case *ast.InfixExpression:
+		literal = node.Operator
+	case *ast.AssignStatement, *ast.IndexAssignStatement, *ast.IncDecStatement:
+		literal = node.TokenLiteral()
+	case *ast.FunctionLiteral:
+		literal = node.Name
+	}
+	return literal
+}
+
+// dumpAST writes the AST of program to out as an indented tree, one node per line.
+// Each node is shown with its type and, where it has one, its name, value or operator,
+// followed by its children indented one level deeper.
+func dumpAST(out io.Writer, program *ast.Program) error {
+	var b strings.Builder
+
+	var dump func(node ast.Node, depth int)
+	dump = func(node ast.Node, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(nodeType(node))
+		if literal := nodeLiteral(node); literal != "" {
+			b.WriteString(" ")
+			b.WriteString(literal)
+		}
+		b.WriteString(nodeAttributes(node))
+		b.WriteString("\n")
+
+		for _, child := range ast.Children(node) {
+			dump(child, depth+1)
+		}
+	}
+	dump(program, 0)
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// nodeAttributes returns the parts of an AST node that are neither its literal nor its children,
+// such as the label of a loop, in brackets, or "" if it has none.
+func nodeAttributes(node ast.Node) string {
+	var attributes []string
+	label := func(l *ast.Identifier) {
+		if l != nil {
+			attributes = append(attributes, "label="+l.Value)
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if node.IsConst() {
+			attributes = append(attributes, "const")
+		}
+	case *ast.FunctionLiteral:
+		for _, a := range node.Annotations {
+			attributes = append(attributes, "@"+a)
+		}
+	case *ast.IndexExpression:
+		if node.Token.Type == token.Dot {
+			attributes = append(attributes, "dot")
+		}
+	case *ast.WhileStatement:
+		label(node.Label)
+	case *ast.ForStatement:
+		label(node.Label)
+	case *ast.BreakStatement:
+		label(node.Label)
+	case *ast.ContinueStatement:
+		label(node.Label)
+	}
+
+	if len(attributes) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(attributes, " ") + "]"
+}
+
+// dumpTokens writes the tokens of input to out, one per line, up to and including the EOF token.
+// Each line holds the token's position, its type, and its literal as a quoted string.
+func dumpTokens(out io.Writer, input string) error {
+	var b strings.Builder
+
+	for _, tok := range lexer.New(input).Tokens() {
+		_, _ = fmt.Fprintf(&b, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// dumpTokensInput lexes the named file, or expr if filename is empty, and writes its tokens to out.
+func dumpTokensInput(filename, expr string, out io.Writer) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+	return dumpTokens(out, input)
+}
+
+// dumpASTInput parses the named file, or expr if filename is empty, and writes its AST to out as an indented tree.
+func dumpASTInput(filename, expr string, out io.Writer) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return errors.New("parser errors:\n\t" + strings.Join(p.Errors(), "\n\t"))
+	}
+	return dumpAST(out, program)
+}
+
+// emitDotInput parses the named file, or expr if filename is empty, and writes its AST to out as DOT.
+func emitDotInput(filename, expr string, out io.Writer) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return errors.New("parser errors:\n\t" + strings.Join(p.Errors(), "\n\t"))
+	}
+	return emitDot(out, program)
+}
+
+// readInput returns the contents of the named file, or expr if filename is empty.
+func readInput(filename, expr string) (string, error) {
+	if filename == "" {
+		return expr, nil
+	}
+	//nolint:gosec // The path is provided by the user on purpose
+	content, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	return string(content), nil
+}
+
+// resourceUsage is how much of the constant pool and the globals store a program uses.
+type resourceUsage struct {
+	constants int
+	globals   int
+}
+
+// collectUsage compiles input and returns how much of the constant pool and the globals store it uses.
+func collectUsage(input string) (resourceUsage, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return resourceUsage{}, errors.New("parser errors:\n\t" + strings.Join(p.Errors(), "\n\t"))
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return resourceUsage{}, fmt.Errorf("compilation error: %w", err)
+	}
+	return resourceUsage{constants: len(comp.Bytecode().Constants), globals: comp.NumGlobals()}, nil
+}
+
+// reportLimits compiles the named file, or expr if filename is empty, and writes to out how close it comes
+// to the limits of the constant pool and the globals store.
+func reportLimits(filename, expr string, out io.Writer) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+
+	usage, err := collectUsage(input)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "constants: %d/%d\nglobals: %d/%d\n",
+		usage.constants, compiler.MaxConstants, usage.globals, vm.GlobalsSize)
+	return err
+}
+
+// runStats summarizes a program at each phase of its execution.
+type runStats struct {
+	tokens               int
+	statements           int
+	constants            int
+	instructionBytes     int
+	instructionsExecuted int
+}
+
+// collectStats lexes, parses, compiles and runs input with the given VM options, and returns its stats.
+// Statements are counted at the top level, and instruction bytes include those of compiled functions.
+func collectStats(input string, opts ...vm.Option) (runStats, error) {
+	var stats runStats
+
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		stats.tokens++
+	}
+
+	bytecode, program, err := compileProgram(input)
+	if err != nil {
+		return stats, err
+	}
+	stats.statements = len(program.Statements)
+	stats.constants = len(bytecode.Constants)
+	stats.instructionBytes = len(bytecode.Instructions)
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			stats.instructionBytes += len(fn.Instructions)
+		}
+	}
+
+	machine := vm.New(bytecode, opts...)
+	err = machine.Run()
+	stats.instructionsExecuted = machine.InstructionsExecuted()
+	if err != nil {
+		return stats, fmt.Errorf("VM error: %w", err)
+	}
+	return stats, nil
+}
+
+// writeStats writes a report of stats to out.
+func writeStats(out io.Writer, stats runStats) error {
+	_, err := fmt.Fprintf(out, `Tokens:                %d
+Statements:            %d
+Constants:             %d
+Instruction bytes:     %d
+Instructions executed: %d
+`, stats.tokens, stats.statements, stats.constants, stats.instructionBytes, stats.instructionsExecuted)
+	return err
+}
+
+// reportStats runs the named file, or expr if filename is empty, and writes its output and stats to out.
+// A program that calls `exit` still has its stats written, and its exit status is returned as the error.
+func reportStats(filename, expr string, out io.Writer, opts ...vm.Option) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+	defer object.SetOutput(object.SetOutput(out))
+
+	stats, err := collectStats(input, opts...)
+	if _, exited := exitStatus(err); err != nil && !exited {
+		return err
+	}
+	if werr := writeStats(out, stats); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// errNondeterministic is returned by checkDeterminism when two runs of a program produce different output.
+var errNondeterministic = errors.New("program is nondeterministic: the two runs produced different output")
+
+// runCaptured compiles and runs input with the given VM options, writing its output to out.
+// The result of the program, if any, is written after its output so that it is compared too,
+// and so is the status of a program that calls `exit`, which is returned as the error.
+func runCaptured(input string, out io.Writer, opts ...vm.Option) error {
+	bytecode, err := compileSource(input)
+	if err != nil {
+		return err
+	}
+	defer object.SetOutput(object.SetOutput(out))
+
+	machine := vm.New(bytecode, opts...)
+	err = machine.Run()
+	if status, ok := exitStatus(err); ok {
+		if _, werr := fmt.Fprintf(out, "exit status %d\n", status); werr != nil {
+			return werr
+		}
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("VM error: %w", err)
+	}
+	if result := machine.LastPoppedStackItem(); result != nil {
+		_, err = fmt.Fprintln(out, result.Inspect())
+	}
+	return err
+}
+
+// compareRuns calls run twice, capturing the output of each call, and reports to out whether they match.
+// It returns errNondeterministic if they differ, after writing the first line at which they do.
+func compareRuns(out io.Writer, run func(io.Writer) error) error {
+	var first, second bytes.Buffer
+	if err := run(&first); err != nil {
+		return err
+	}
+	if err := run(&second); err != nil {
+		return err
+	}
+
+	if bytes.Equal(first.Bytes(), second.Bytes()) {
+		_, err := fmt.Fprintln(out, "Outputs match: the program is deterministic")
+		return err
+	}
+
+	firstLines := strings.Split(first.String(), "\n")
+	secondLines := strings.Split(second.String(), "\n")
+	line := 0
+	for line < len(firstLines) && line < len(secondLines) && firstLines[line] == secondLines[line] {
+		line++
+	}
+	_, err := fmt.Fprintf(out, "Outputs differ at line %d:\n  first run:  %q\n  second run: %q\n",
+		line+1, lineAt(firstLines, line), lineAt(secondLines, line))
+	if err != nil {
+		return err
+	}
+	return errNondeterministic
+}
+
+// lineAt returns lines[i], or an empty string if the output has fewer lines.
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// checkDeterminism runs the named file, or expr if filename is empty, twice and reports to out
+// whether both runs produced the same output.
+// If the program calls `exit` and the runs match, its exit status is returned as the error.
+func checkDeterminism(filename, expr string, out io.Writer, opts ...vm.Option) error {
+	input, err := readInput(filename, expr)
+	if err != nil {
+		return err
+	}
+
+	var exit error
+	err = compareRuns(out, func(w io.Writer) error {
+		err := runCaptured(input, w, opts...)
+		if _, ok := exitStatus(err); ok {
+			// The status is part of the captured output, so two runs that end differently do not match.
+			exit = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return exit
+}
+
+// benchmarkRuns is the number of times --benchmark runs each benchmark program.
+const benchmarkRuns = 10
+
+// runBenchmarks runs each benchmark program through the whole pipeline the given number of times,
+// and writes the elapsed time and the runs per second of each to out.
+func runBenchmarks(out io.Writer, runs int) error {
+	for _, p := range benchmarks.Programs {
+		start := time.Now()
+		for range runs {
+			err := p.Execute()
+			if err != nil {
+				return fmt.Errorf("benchmark %s failed: %w", p.Name, err)
+			}
+		}
+		elapsed := time.Since(start)
+
+		_, err := fmt.Fprintf(out, "%-12s %d runs in %v (%.2f ops/sec)\n",
+			p.Name, runs, elapsed.Round(time.Millisecond), float64(runs)/elapsed.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileFile compiles a Monkey script file with the given compiler options and writes the serialized bytecode
+// to output, without the constants that the compiled code no longer refers to.
+func compileFile(filename, output string, opts ...compiler.Option) error {
+	//nolint:gosec // The path is provided by the user on purpose
+	content, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	bytecode, err := compileSource(string(content), opts...)
+	if err != nil {
+		return err
+	}
+	bytecode, err = bytecode.CompactConstants()
+	if err != nil {
+		return fmt.Errorf("compilation error: %w", err)
+	}
+
+	data, err := bytecode.Serialize()
+	if err != nil {
+		return fmt.Errorf("serialization error: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Clean(output), data, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing bytecode: %w", err)
+	}
+	return nil
+}
+
+// formatFile parses a Monkey script file and rewrites it as formatted by [ast.Format].
+//
+// As [ast.Format] does not keep comments, a file containing comments is refused rather than rewritten.
+// A file that fails to parse is left untouched, and so is one that is already formatted.
+func formatFile(filename string) error {
+	filename = filepath.Clean(filename)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+	//nolint:gosec // The path is provided by the user on purpose
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return errors.New("parser errors:\n\t" + strings.Join(p.Errors(), "\n\t"))
+	}
+
+	formatted := ast.Format(program)
+	if formatted == string(content) {
+		return nil
+	}
+	if hasComments(string(content)) {
+		return fmt.Errorf("%s contains comments, which formatting would remove; the file is left unchanged", filename)
+	}
+	err = os.WriteFile(filename, []byte(formatted), info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	return nil
+}
+
+// hasComments reports whether src contains a comment: text that is neither whitespace nor part of a token.
+func hasComments(src string) bool {
+	lineStarts := []int{0}
+	for i := range len(src) {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	end := 0
+	for _, tok := range lexer.New(src).Tokens() {
+		start := lineStarts[tok.Line-1] + tok.Column - 1
+		if strings.TrimSpace(src[end:start]) != "" {
+			return true
+		}
+		end = start + tok.Length
+	}
+	return false
+}
+
+// runBytecodeFile loads a bytecode file produced by compileFile and executes it with the given VM options.
+// The program's output, and in debug mode the last popped stack item, is written to out.
+func runBytecodeFile(filename string, out io.Writer, debug bool, opts ...vm.Option) error {
+	//nolint:gosec // The path is provided by the user on purpose
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return fmt.Errorf("error reading bytecode: %w", err)
+	}
+
+	bytecode, err := compiler.Deserialize(data)
+	if err == nil {
+		err = bytecode.Verify()
+	}
+	if err != nil {
+		return fmt.Errorf("error loading bytecode: %w", err)
+	}
+
+	defer object.SetOutput(object.SetOutput(out))
+
+	machine := vm.New(bytecode, opts...)
+	err = runLoadedBytecode(machine)
+	if err != nil {
+		return fmt.Errorf("VM error: %w", err)
+	}
+
+	if debug {
+		stackTop := machine.LastPoppedStackItem()
+		if stackTop != nil {
+			_, err = fmt.Fprintln(out, stackTop.Inspect())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runLoadedBytecode runs bytecode loaded from a file.
+//
+// Verification checks the structure of the bytecode but not the depth of the stack, so a corrupt or crafted
+// file can underflow the stack, which makes the VM panic with a runtime error. The panic is reported
+// as invalid bytecode instead of crashing the process. Bytecode the compiler produced is not run this way,
+// so that bugs in the compiler or the VM are not mistaken for a bad file.
+func runLoadedBytecode(machine *vm.VM) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		re, ok := r.(runtime.Error)
+		if !ok {
+			panic(r)
+		}
+		err = fmt.Errorf("invalid bytecode: %w", re)
+	}()
+	return machine.Run()
+}
+
 // evaluateExpression evaluates a single Monkey expression
-func evaluateExpression(expr string) {
+func evaluateExpression(expr string, compilerOpts []compiler.Option, opts ...vm.Option) {
 	// Parse the expression
 	l := lexer.New(expr)
 	p := parser.New(l)
@@ -197,19 +1056,19 @@ func evaluateExpression(expr string) {
 	}
 
 	// Compile the program
-	comp := compiler.New()
+	comp := compiler.New(compilerOpts...)
 	err := comp.Compile(program)
 	if err != nil {
 		fmt.Printf("Compilation error: %s\n", err)
 		os.Exit(1)
 	}
+	printWarnings(comp.Warnings())
 
 	// Run the bytecode in the VM
-	machine := vm.New(comp.Bytecode())
+	machine := vm.New(comp.Bytecode(), opts...)
 	err = machine.Run()
 	if err != nil {
-		fmt.Printf("VM error: %s\n", err)
-		os.Exit(1)
+		exitOnError(err)
 	}
 
 	// Print the result
@@ -219,6 +1078,32 @@ func evaluateExpression(expr string) {
 	}
 }
 
+// exitOnError ends the process after a program stopped with err. A program that called `exit`
+// ends with the status it asked for, and any other error is printed and ends with status 1.
+func exitOnError(err error) {
+	if status, ok := exitStatus(err); ok {
+		os.Exit(status)
+	}
+	fmt.Printf("VM error: %s\n", err)
+	os.Exit(1)
+}
+
+// exitStatus reports the status a program asked to end with, if it stopped with err by calling `exit`.
+func exitStatus(err error) (int, bool) {
+	var exit *object.Exit
+	if errors.As(err, &exit) {
+		return exit.Code, true
+	}
+	return 0, false
+}
+
+// printWarnings prints compiler warnings to stderr
+func printWarnings(warnings []string) {
+	for _, msg := range warnings {
+		_, _ = fmt.Fprintln(os.Stderr, "Warning: "+msg) // #nosec G705 - false positive.
+	}
+}
+
 // printParserErrors prints parser errors to stderr
 func printParserErrors(errors []string) {
 	_, _ = fmt.Fprintln(os.Stderr, "Parser errors:")
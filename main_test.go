@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dr8co/kong/code"
+	"github.com/dr8co/kong/compiler"
+)
+
+// writeTempFile writes content to a new file in a temporary directory and returns its path.
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("error writing %s: %s", path, err)
+	}
+	return path
+}
+
+// TestCompileAndRunBytecode verifies that a compiled script can be loaded and run from its bytecode file.
+func TestCompileAndRunBytecode(t *testing.T) {
+	script := writeTempFile(t, "script.monkey", `
+	let fibonacci = fn(x) {
+		if (x < 2) { return x; }
+		fibonacci(x - 1) + fibonacci(x - 2)
+	};
+	let results = [fibonacci(10), "done"];
+	results;
+	`)
+	output := filepath.Join(t.TempDir(), "script.kbc")
+
+	err := compileFile(script, output)
+	if err != nil {
+		t.Fatalf("compileFile failed: %s", err)
+	}
+
+	var out bytes.Buffer
+	err = runBytecodeFile(output, &out, true)
+	if err != nil {
+		t.Fatalf("runBytecodeFile failed: %s", err)
+	}
+
+	if out.String() != "[55, done]\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "[55, done]\n", out.String())
+	}
+}
+
+// TestRunBytecodeExit verifies that the status of a program calling exit is recovered from the error it stops with.
+func TestRunBytecodeExit(t *testing.T) {
+	script := writeTempFile(t, "script.monkey", `puts("before"); exit(7); puts("after");`)
+	output := filepath.Join(t.TempDir(), "script.kbc")
+	if err := compileFile(script, output); err != nil {
+		t.Fatalf("compileFile failed: %s", err)
+	}
+
+	var out bytes.Buffer
+	err := runBytecodeFile(output, &out, false)
+	status, ok := exitStatus(err)
+	if !ok || status != 7 {
+		t.Errorf("expected exit status 7, got %d (%t) from error %v", status, ok, err)
+	}
+	if out.String() != "before \n" {
+		t.Errorf("wrong output. want=%q, got=%q", "before \n", out.String())
+	}
+
+	if _, ok := exitStatus(errors.New("VM error: boom")); ok {
+		t.Errorf("expected no exit status for an ordinary error")
+	}
+}
+
+// TestRunBytecodeRejectsInvalidFiles verifies that non-bytecode files are rejected with a clear error.
+func TestRunBytecodeRejectsInvalidFiles(t *testing.T) {
+	path := writeTempFile(t, "script.kbc", "let x = 5;")
+
+	err := runBytecodeFile(path, &bytes.Buffer{}, false)
+	if !errors.Is(err, compiler.ErrNotBytecode) {
+		t.Errorf("expected ErrNotBytecode, got=%v", err)
+	}
+}
+
+// TestRunBytecodeVerifies verifies that well-formed bytecode files with invalid instructions are rejected before running.
+func TestRunBytecodeVerifies(t *testing.T) {
+	data, err := (&compiler.Bytecode{Instructions: code.Make(code.OpJump, 2)}).Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+	path := writeTempFile(t, "bad.kbc", string(data))
+
+	err = runBytecodeFile(path, &bytes.Buffer{}, false)
+	expected := "error loading bytecode: invalid bytecode: at offset 0: jump target 2 is not the start of an instruction"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+// TestRunBytecodeStackUnderflow verifies that bytecode files which pass verification but underflow the stack
+// fail with an error instead of crashing.
+func TestRunBytecodeStackUnderflow(t *testing.T) {
+	tests := []struct {
+		name         string
+		instructions code.Instructions
+	}{
+		{"OpPop", code.Make(code.OpPop)},
+		{"OpAdd", code.Make(code.OpAdd)},
+		{"OpSwap", code.Make(code.OpSwap)},
+		{"OpSetIndex", code.Make(code.OpSetIndex)},
+		{"OpArray", code.Make(code.OpArray, 2)},
+	}
+
+	for _, tt := range tests {
+		data, err := (&compiler.Bytecode{Instructions: tt.instructions}).Serialize()
+		if err != nil {
+			t.Fatalf("%s: serialize error: %s", tt.name, err)
+		}
+		path := writeTempFile(t, "underflow.kbc", string(data))
+
+		err = runBytecodeFile(path, &bytes.Buffer{}, false)
+		if err == nil || !strings.HasPrefix(err.Error(), "VM error: invalid bytecode: runtime error: ") {
+			t.Errorf("%s: wrong error: %v", tt.name, err)
+		}
+	}
+}
+
+// TestCompileFileErrors verifies that parser errors stop compilation and no output is written.
+func TestCompileFileErrors(t *testing.T) {
+	script := writeTempFile(t, "bad.monkey", "let = 5;")
+	output := filepath.Join(t.TempDir(), "bad.kbc")
+
+	err := compileFile(script, output)
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	if _, statErr := os.Stat(output); !os.IsNotExist(statErr) {
+		t.Errorf("expected no output file, got stat error %v", statErr)
+	}
+}
+
+// TestFormatFile verifies that --format rewrites a script in the canonical layout,
+// and that a script with parser errors is left untouched.
+func TestFormatFile(t *testing.T) {
+	source := "let add=fn(a,b){a+b}; puts(add(1,2))"
+	script := writeTempFile(t, "script.monkey", source)
+	expected := "let add = fn(a, b) {\n\ta + b;\n};\n\nputs(add(1, 2));\n"
+
+	err := formatFile(script)
+	if err != nil {
+		t.Fatalf("formatFile failed: %s", err)
+	}
+	content, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", script, err)
+	}
+	if string(content) != expected {
+		t.Errorf("wrong formatted file. want=%q, got=%q", expected, content)
+	}
+
+	// Formatting is idempotent.
+	err = formatFile(script)
+	if err != nil {
+		t.Fatalf("formatFile failed: %s", err)
+	}
+	content, err = os.ReadFile(script)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", script, err)
+	}
+	if string(content) != expected {
+		t.Errorf("formatted file changed on the second run to %q", content)
+	}
+
+	bad := writeTempFile(t, "bad.monkey", "let = 5;")
+	err = formatFile(bad)
+	if err == nil || !strings.HasPrefix(err.Error(), "parser errors:") {
+		t.Errorf("expected parser errors, got=%v", err)
+	}
+	content, err = os.ReadFile(bad)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", bad, err)
+	}
+	if string(content) != "let = 5;" {
+		t.Errorf("file with parser errors was changed to %q", content)
+	}
+}
+
+// TestFormatFileWithComments verifies that --format refuses to rewrite a script whose comments formatting would remove.
+func TestFormatFileWithComments(t *testing.T) {
+	tests := []string{
+		"let x=1; // one\n",
+		"/* header */\nlet x=1;",
+		"let x=/* inline */1;",
+	}
+
+	for _, source := range tests {
+		script := writeTempFile(t, "script.monkey", source)
+
+		err := formatFile(script)
+		if err == nil || !strings.Contains(err.Error(), "contains comments") {
+			t.Errorf("%q: expected an error about comments, got=%v", source, err)
+		}
+		content, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatalf("error reading %s: %s", script, err)
+		}
+		if string(content) != source {
+			t.Errorf("%q: file with comments was changed to %q", source, content)
+		}
+	}
+
+	// Comment markers inside strings are not comments.
+	if hasComments(`let s = "// /* */";` + "\nlet t = \"a\nb\"; 1 / 2;") {
+		t.Errorf("string contents reported as comments")
+	}
+}
+
+// TestDisassemble verifies the disassembly listing of a small program, including function constants.
+func TestDisassemble(t *testing.T) {
+	var out bytes.Buffer
+
+	err := disassembleInput("", `let add = fn(a, b) { a + b }; add(1, "two")`, &out)
+	if err != nil {
+		t.Fatalf("disassembleInput failed: %s", err)
+	}
+
+	expected := `Instructions:
+0000 OpClosure 0 0
+0004 OpSetGlobal 0
+0007 OpGetGlobal 0
+0010 OpConstant 1
+0013 OpConstant 2
+0016 OpCall 2
+0018 OpPop
+
+Constants:
+0000 COMPILED_FUNCTION (parameters: 2, locals: 2)
+     0000 OpGetLocal 0
+     0002 OpGetLocal 1
+     0004 OpAdd
+     0005 OpReturnValue
+0001 INTEGER 1
+0002 STRING "two"
+`
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+// TestReportStats verifies the stats reported for a small program, including the instructions of its function.
+func TestReportStats(t *testing.T) {
+	script := writeTempFile(t, "script.monkey", `let double = fn(a) { a * 2 }; let x = double(3); x;`)
+
+	var out bytes.Buffer
+	err := reportStats(script, "", &out)
+	if err != nil {
+		t.Fatalf("reportStats failed: %s", err)
+	}
+
+	// The function has 7 bytes of instructions and runs 4 of them; the main program has 22 bytes and runs 8.
+	expected := `Tokens:                23
+Statements:            3
+Constants:             3
+Instruction bytes:     29
+Instructions executed: 12
+`
+	if out.String() != expected {
+		t.Errorf("wrong stats.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
+
+// TestReportStatsErrors verifies that errors in any phase are reported.
+func TestReportStatsErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1;", "parser errors:"},
+		{"x;", "compilation error: undefined variable x"},
+		{"1 + true;", "VM error: unsupported operation: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		err := reportStats("", tt.input, &bytes.Buffer{})
+		if err == nil {
+			t.Fatalf("%q: expected error, got none", tt.input)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong error. want prefix %q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestReportStatsExit verifies that a program that calls `exit` still has its stats reported,
+// and that its exit status is returned.
+func TestReportStatsExit(t *testing.T) {
+	var out bytes.Buffer
+	err := reportStats("", `puts("bye"); exit(3); puts("unreachable");`, &out)
+	status, ok := exitStatus(err)
+	if !ok || status != 3 {
+		t.Errorf("expected exit status 3, got %d (%t) from error %v", status, ok, err)
+	}
+	if !strings.HasPrefix(out.String(), "bye \nTokens:") || !strings.Contains(out.String(), "Instructions executed:") {
+		t.Errorf("expected the output followed by the stats, got %q", out.String())
+	}
+}
+
+// TestReportLimits verifies the reported use of the constant pool and the globals store.
+func TestReportLimits(t *testing.T) {
+	// Constants: 1, 2, "a", the function, and 10; the repeated "a" is interned.
+	// Globals: x, y, f, and the redefined x.
+	script := writeTempFile(t, "script.monkey", `
+	let x = 1;
+	let y = [2, "a", "a"];
+	let f = fn(n) { let local = n * 10; local };
+	let x = f(x);
+	`)
+
+	var out bytes.Buffer
+	err := reportLimits(script, "", &out)
+	if err != nil {
+		t.Fatalf("reportLimits failed: %s", err)
+	}
+	expected := "constants: 5/65536\nglobals: 4/65536\n"
+	if out.String() != expected {
+		t.Errorf("wrong report.\nwant=%q\ngot=%q", expected, out.String())
+	}
+
+	err = reportLimits("", "undefined;", &bytes.Buffer{})
+	if err == nil || err.Error() != "compilation error: undefined variable undefined" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+// TestRunBenchmarks verifies that each benchmark program is run and reported with its speed.
+func TestRunBenchmarks(t *testing.T) {
+	var out bytes.Buffer
+	err := runBenchmarks(&out, 1)
+	if err != nil {
+		t.Fatalf("runBenchmarks failed: %s", err)
+	}
+
+	pattern := regexp.MustCompile(`^(fibonacci|array-sum) +1 runs in \S+ \(\d+\.\d\d ops/sec\)$`)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrong number of lines. want=2, got=%d:\n%s", len(lines), out.String())
+	}
+	for _, line := range lines {
+		if !pattern.MatchString(line) {
+			t.Errorf("wrong report line: %q", line)
+		}
+	}
+}
+
+// TestCheckDeterminism verifies that a deterministic program is reported as such, including its result.
+func TestCheckDeterminism(t *testing.T) {
+	script := writeTempFile(t, "script.monkey", `
+	let h = {"b": 2, "a": 1, "c": 3};
+	puts(keys(h));
+	let s = newSet();
+	setAdd(s, 3); setAdd(s, 1); setAdd(s, 2);
+	setToArray(s);
+	`)
+
+	var out bytes.Buffer
+	err := checkDeterminism(script, "", &out)
+	if err != nil {
+		t.Fatalf("checkDeterminism failed: %s\n%s", err, out.String())
+	}
+	expected := "Outputs match: the program is deterministic\n"
+	if out.String() != expected {
+		t.Errorf("wrong report. want=%q, got=%q", expected, out.String())
+	}
+
+	err = checkDeterminism("", "1 + true;", &bytes.Buffer{})
+	if err == nil || !strings.HasPrefix(err.Error(), "VM error:") {
+		t.Errorf("expected a VM error, got=%v", err)
+	}
+}
+
+// TestCheckDeterminismExit verifies that the exit status of a program that calls `exit` is returned
+// when both runs match, and that the status is part of the compared output.
+func TestCheckDeterminismExit(t *testing.T) {
+	var out bytes.Buffer
+	err := checkDeterminism("", `puts("bye"); exit(4);`, &out)
+	status, ok := exitStatus(err)
+	if !ok || status != 4 {
+		t.Errorf("expected exit status 4, got %d (%t) from error %v", status, ok, err)
+	}
+	expected := "Outputs match: the program is deterministic\n"
+	if out.String() != expected {
+		t.Errorf("wrong report. want=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	err = runCaptured(`puts("bye"); exit(5);`, &out)
+	if status, ok := exitStatus(err); !ok || status != 5 {
+		t.Errorf("expected exit status 5, got %d (%t) from error %v", status, ok, err)
+	}
+	if out.String() != "bye \nexit status 5\n" {
+		t.Errorf("wrong captured output. want=%q, got=%q", "bye \nexit status 5\n", out.String())
+	}
+}
+
+// TestCheckDeterminismRandom verifies that an unseeded rand makes a program nondeterministic, and a seeded one does not.
+func TestCheckDeterminismRandom(t *testing.T) {
+	var out bytes.Buffer
+	err := checkDeterminism("", "puts(rand());", &out)
+	if !errors.Is(err, errNondeterministic) {
+		t.Errorf("expected errNondeterministic, got=%v\n%s", err, out.String())
+	}
+
+	err = checkDeterminism("", "seed(1); puts(rand()); rand(10);", &bytes.Buffer{})
+	if err != nil {
+		t.Errorf("seeded program reported as nondeterministic: %s", err)
+	}
+}
+
+// TestCompareRunsDiffer verifies that runs with different output are reported at the first differing line.
+func TestCompareRunsDiffer(t *testing.T) {
+	runs := 0
+	run := func(w io.Writer) error {
+		runs++
+		_, err := fmt.Fprintf(w, "same\nrun %d\n", runs)
+		return err
+	}
+
+	var out bytes.Buffer
+	err := compareRuns(&out, run)
+	if !errors.Is(err, errNondeterministic) {
+		t.Fatalf("expected errNondeterministic, got=%v", err)
+	}
+	expected := "Outputs differ at line 2:\n  first run:  \"run 1\"\n  second run: \"run 2\"\n"
+	if out.String() != expected {
+		t.Errorf("wrong report.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
+
+// TestEmitDot verifies that the AST is written as a DOT digraph with a labeled node per AST node.
+func TestEmitDot(t *testing.T) {
+	var out bytes.Buffer
+
+	err := emitDotInput("", `let x = 1 + 2; puts("a \"b\"", x)`, &out)
+	if err != nil {
+		t.Fatalf("emitDotInput failed: %s", err)
+	}
+	dot := out.String()
+
+	labels := []string{
+		`"Program"`,
+		`"LetStatement"`,
+		`"Identifier\nx"`,
+		`"InfixExpression\n+"`,
+		`"IntegerLiteral\n1"`,
+		`"IntegerLiteral\n2"`,
+		`"CallExpression"`,
+		`"Identifier\nputs"`,
+		`"StringLiteral\n\"a \\\"b\\\"\""`,
+	}
+	for _, label := range labels {
+		if !strings.Contains(dot, "[label="+label+"];") {
+			t.Errorf("missing node labeled %s in:\n%s", label, dot)
+		}
+	}
+
+	// A minimal check of the DOT syntax: a digraph whose statements are node or edge statements.
+	lines := strings.Split(strings.TrimSuffix(dot, "\n"), "\n")
+	if lines[0] != "digraph AST {" || lines[len(lines)-1] != "}" {
+		t.Fatalf("output is not a digraph:\n%s", dot)
+	}
+	statement := regexp.MustCompile(`^\t(node \[shape=box\]|n\d+ \[label="([^"\\]|\\.)*"\]|n\d+ -> n\d+);$`)
+	nodes, edges := 0, 0
+	for _, line := range lines[1 : len(lines)-1] {
+		if !statement.MatchString(line) {
+			t.Errorf("invalid DOT statement: %q", line)
+		}
+		if strings.Contains(line, "[label=") {
+			nodes++
+		} else if strings.Contains(line, "->") {
+			edges++
+		}
+	}
+	// Program, let, x, +, 1, 2, expression statement, call, puts, string, x
+	if nodes != 11 || edges != nodes-1 {
+		t.Errorf("wrong graph size: want 11 nodes and 10 edges, got %d nodes and %d edges", nodes, edges)
+	}
+}
+
+// TestEmitDotParseErrors verifies that parse errors are reported instead of a graph.
+func TestEmitDotParseErrors(t *testing.T) {
+	var out bytes.Buffer
+
+	err := emitDotInput("", "let = 1;", &out)
+	if err == nil || !strings.HasPrefix(err.Error(), "parser errors:") {
+		t.Errorf("expected parser errors, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
+
+// TestDumpAST verifies the indented AST dump of --ast, including the attributes of nodes,
+// and that parse errors are reported instead of a tree.
+func TestDumpAST(t *testing.T) {
+	var out bytes.Buffer
+
+	input := "const double = @memo fn(x) { x * 2 };\nloop: while (true) { break loop; }\nputs(-double(1), h.k)"
+	err := dumpASTInput("", input, &out)
+	if err != nil {
+		t.Fatalf("dumpASTInput failed: %s", err)
+	}
+
+	expected := `Program
+  LetStatement [const]
+    Identifier double
+    FunctionLiteral double [@memo]
+      Identifier x
+      BlockStatement
+        ExpressionStatement
+          InfixExpression *
+            Identifier x
+            IntegerLiteral 2
+  WhileStatement [label=loop]
+    Boolean true
+    BlockStatement
+      BreakStatement [label=loop]
+  ExpressionStatement
+    CallExpression
+      Identifier puts
+      PrefixExpression -
+        CallExpression
+          Identifier double
+          IntegerLiteral 1
+      IndexExpression [dot]
+        Identifier h
+        StringLiteral "k"
+`
+	if out.String() != expected {
+		t.Errorf("wrong AST dump.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	err = dumpASTInput("", "let = 1;", &out)
+	if err == nil || !strings.HasPrefix(err.Error(), "parser errors:") {
+		t.Errorf("expected parser errors, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
+
+// TestDumpTokens verifies the token listing of --tokens, with the position, type and quoted literal of each token
+// up to EOF, and that a file that cannot be read is reported.
+func TestDumpTokens(t *testing.T) {
+	var out bytes.Buffer
+
+	input := "let s = \"a\\\"b\\n\"; // a comment\n\ts += 1 <= 2 # x"
+	err := dumpTokensInput("", input, &out)
+	if err != nil {
+		t.Fatalf("dumpTokensInput failed: %s", err)
+	}
+
+	expected := `1:1	Let	"let"
+1:5	Ident	"s"
+1:7	=	"="
+1:9	String	"a\"b\n"
+1:17	;	";"
+2:2	Ident	"s"
+2:4	+=	"+="
+2:7	Int	"1"
+2:9	<=	"<="
+2:12	Int	"2"
+2:14	Illegal	"#"
+2:16	Ident	"x"
+2:17	EOF	""
+`
+	if out.String() != expected {
+		t.Errorf("wrong tokens.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	err = dumpTokensInput(filepath.Join(t.TempDir(), "missing.monkey"), "", &out)
+	if err == nil || !strings.HasPrefix(err.Error(), "error reading file") {
+		t.Errorf("expected a read error, got %v", err)
+	}
+}
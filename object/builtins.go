@@ -1,6 +1,81 @@
 package object
 
-import "fmt"
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output is the writer that builtins such as `puts` and `print` write to. It defaults to [os.Stdout].
+var Output io.Writer = os.Stdout
+
+// SetOutput makes builtins write to w, and returns the previous [Output] so it can be restored.
+func SetOutput(w io.Writer) io.Writer {
+	previous := Output
+	Output = w
+	return previous
+}
+
+// Input is the reader that the `readline` builtin reads from. It defaults to [os.Stdin].
+var Input io.Reader = os.Stdin
+
+// SetInput makes builtins read from r, and returns the previous [Input] so it can be restored.
+func SetInput(r io.Reader) io.Reader {
+	previous := Input
+	Input = r
+	return previous
+}
+
+// inputLines buffers [Input] for `readline`, so that input read past a line is kept for the next call.
+// It is replaced when [Input] changes.
+var inputLines struct {
+	source io.Reader
+	reader *bufio.Reader
+}
+
+// readLine returns the next line of [Input] without its line ending.
+// It reports false at the end of the input.
+func readLine() (string, bool, error) {
+	if inputLines.source != Input || inputLines.reader == nil {
+		inputLines.source = Input
+		inputLines.reader = bufio.NewReader(Input)
+	}
+
+	line, err := inputLines.reader.ReadString('\n')
+	if errors.Is(err, io.EOF) && line == "" {
+		return "", false, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true, nil
+}
+
+// EnableFileIO allows the `read_file` and `write_file` builtins to access files. It defaults to true;
+// programs embedding the VM to run untrusted code should set it to false, which makes both builtins return an error.
+var EnableFileIO = true
+
+// Random is the source of the `rand` builtin. It is seeded randomly, and reseeded by the `seed` builtin and [Seed].
+//
+//nolint:gosec // Monkey programs use rand for simulations, not for security.
+var Random = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+
+// Seed replaces [Random] with a source seeded with seed, so that `rand` returns the same sequence every run.
+func Seed(seed int64) {
+	//nolint:gosec // The seed is reinterpreted as unsigned on purpose.
+	Random = rand.New(rand.NewPCG(uint64(seed), 0))
+}
 
 // Builtins is a collection of predefined built-in functions available for use within the language.
 var Builtins = []struct {
@@ -43,6 +118,11 @@ var Builtins = []struct {
 						return arg.Elements[0]
 					}
 					return nil
+				case *String:
+					if len(arg.Value) > 0 {
+						return &String{Value: arg.Value[:1]}
+					}
+					return nil
 				default:
 					return newError("argument to `first` not supported, got %s", args[0].Type())
 				}
@@ -65,6 +145,11 @@ var Builtins = []struct {
 						return &Array{Elements: newElements}
 					}
 					return nil
+				case *String:
+					if len(arg.Value) > 0 {
+						return &String{Value: arg.Value[1:]}
+					}
+					return nil
 				default:
 					return newError("argument to `rest` not supported, got %s", args[0].Type())
 				}
@@ -85,6 +170,12 @@ var Builtins = []struct {
 						return arg.Elements[length-1]
 					}
 					return nil
+				case *String:
+					length := len(arg.Value)
+					if length > 0 {
+						return &String{Value: arg.Value[length-1:]}
+					}
+					return nil
 
 				default:
 					return newError("argument to `last` not supported, got %s", args[0].Type())
@@ -120,13 +211,1292 @@ var Builtins = []struct {
 		&Builtin{
 			Fn: func(args ...Object) Object {
 				for _, arg := range args {
-					fmt.Print(arg.Inspect() + " ")
+					_, _ = fmt.Fprint(Output, arg.Inspect()+" ")
 				}
-				fmt.Println()
+				_, _ = fmt.Fprintln(Output)
 				return nil
 			},
 		},
 	},
+	{
+		"memoize",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch args[0].(type) {
+				case *Closure, *Builtin:
+					return memoize(args[0])
+				default:
+					return newError("argument to `memoize` must be a function, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"newBuilder",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return &StringBuilder{}
+			},
+		},
+	},
+	{
+		"append",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				builder, ok := args[0].(*StringBuilder)
+				if !ok {
+					return newError("first argument to `append` must be STRING_BUILDER, got %s", args[0].Type())
+				}
+				str, ok := args[1].(*String)
+				if !ok {
+					return newError("second argument to `append` must be STRING, got %s", args[1].Type())
+				}
+				builder.Builder.WriteString(str.Value)
+				return builder
+			},
+		},
+	},
+	{
+		"build",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				builder, ok := args[0].(*StringBuilder)
+				if !ok {
+					return newError("argument to `build` must be STRING_BUILDER, got %s", args[0].Type())
+				}
+				return &String{Value: builder.Builder.String()}
+			},
+		},
+	},
+	{
+		"newList",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return &List{Elements: []Object{}}
+			},
+		},
+	},
+	{
+		"listPush",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				list, ok := args[0].(*List)
+				if !ok {
+					return newError("first argument to `listPush` must be LIST, got %s", args[0].Type())
+				}
+				list.Elements = append(list.Elements, args[1])
+				return list
+			},
+		},
+	},
+	{
+		"listGet",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				list, index, err := listIndexArgs("listGet", args)
+				if err != nil {
+					return err
+				}
+				if index < 0 || index >= int64(len(list.Elements)) {
+					return nil
+				}
+				return list.Elements[index]
+			},
+		},
+	},
+	{
+		"listSet",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3", len(args))
+				}
+				list, index, err := listIndexArgs("listSet", args)
+				if err != nil {
+					return err
+				}
+				if index < 0 || index >= int64(len(list.Elements)) {
+					return newError("index out of range: %d (list length %d)", index, len(list.Elements))
+				}
+				list.Elements[index] = args[2]
+				return list
+			},
+		},
+	},
+	{
+		"listLen",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				list, ok := args[0].(*List)
+				if !ok {
+					return newError("argument to `listLen` must be LIST, got %s", args[0].Type())
+				}
+				return &Integer{Value: int64(len(list.Elements))}
+			},
+		},
+	},
+	{
+		"toArray",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				list, ok := args[0].(*List)
+				if !ok {
+					return newError("argument to `toArray` must be LIST, got %s", args[0].Type())
+				}
+				elements := make([]Object, len(list.Elements))
+				copy(elements, list.Elements)
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"newSet",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return NewSet()
+			},
+		},
+	},
+	{
+		"setAdd",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				set, key, err := setElementArgs("setAdd", args)
+				if err != nil {
+					return err
+				}
+				set.Add(key, args[1])
+				return set
+			},
+		},
+	},
+	{
+		"setHas",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				set, key, err := setElementArgs("setHas", args)
+				if err != nil {
+					return err
+				}
+				return NativeBoolToBoolean(set.Has(key))
+			},
+		},
+	},
+	{
+		"setRemove",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				set, key, err := setElementArgs("setRemove", args)
+				if err != nil {
+					return err
+				}
+				return NativeBoolToBoolean(set.Remove(key))
+			},
+		},
+	},
+	{
+		"setSize",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				set, ok := args[0].(*Set)
+				if !ok {
+					return newError("argument to `setSize` must be SET, got %s", args[0].Type())
+				}
+				return &Integer{Value: int64(len(set.Elements))}
+			},
+		},
+	},
+	{
+		"setToArray",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				set, ok := args[0].(*Set)
+				if !ok {
+					return newError("argument to `setToArray` must be SET, got %s", args[0].Type())
+				}
+				return &Array{Elements: set.Values()}
+			},
+		},
+	},
+	{
+		"range",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments. got=%d, want=1..3", len(args))
+				}
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					integer, ok := arg.(*Integer)
+					if !ok {
+						return newError("arguments to `range` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+				return integerRange(bounds)
+			},
+		},
+	},
+	{
+		"keys",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+				}
+				pairs := hash.OrderedPairs()
+				elements := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					elements[i] = pair.Key
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"values",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("argument to `values` must be HASH, got %s", args[0].Type())
+				}
+				pairs := hash.OrderedPairs()
+				elements := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					elements[i] = pair.Value
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"map",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) (Object, error) {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args)), nil
+				}
+				array, fn, err := higherOrderArgs("map", args)
+				if err != nil {
+					return err, nil
+				}
+
+				elements := make([]Object, len(array.Elements))
+				for i, el := range array.Elements {
+					result, err := call(fn, el)
+					if err != nil {
+						return nil, err
+					}
+					elements[i] = result
+				}
+				return &Array{Elements: elements}, nil
+			},
+		},
+	},
+	{
+		"filter",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) (Object, error) {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args)), nil
+				}
+				array, fn, err := higherOrderArgs("filter", args)
+				if err != nil {
+					return err, nil
+				}
+
+				elements := []Object{}
+				for _, el := range array.Elements {
+					keep, err := call(fn, el)
+					if err != nil {
+						return nil, err
+					}
+					if isTruthy(keep) {
+						elements = append(elements, el)
+					}
+				}
+				return &Array{Elements: elements}, nil
+			},
+		},
+	},
+	{
+		"reduce",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) (Object, error) {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3", len(args)), nil
+				}
+				array, fn, err := higherOrderArgs("reduce", args)
+				if err != nil {
+					return err, nil
+				}
+
+				acc := args[2]
+				for _, el := range array.Elements {
+					result, err := call(fn, acc, el)
+					if err != nil {
+						return nil, err
+					}
+					acc = result
+				}
+				return acc, nil
+			},
+		},
+	},
+	{
+		"split",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				strs, err := stringArgs("split", args)
+				if err != nil {
+					return err
+				}
+
+				parts := strings.Split(strs[0], strs[1])
+				elements := make([]Object, len(parts))
+				for i, part := range parts {
+					elements[i] = &String{Value: part}
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"join",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				array, ok := args[0].(*Array)
+				if !ok {
+					return newError("first argument to `join` must be ARRAY, got %s", args[0].Type())
+				}
+				sep, ok := args[1].(*String)
+				if !ok {
+					return newError("second argument to `join` must be STRING, got %s", args[1].Type())
+				}
+
+				parts := make([]string, len(array.Elements))
+				for i, el := range array.Elements {
+					str, ok := el.(*String)
+					if !ok {
+						return newError("array elements passed to `join` must be STRING, got %s at index %d", el.Type(), i)
+					}
+					parts[i] = str.Value
+				}
+				return &String{Value: strings.Join(parts, sep.Value)}
+			},
+		},
+	},
+	{
+		"trim",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				strs, err := stringArgs("trim", args)
+				if err != nil {
+					return err
+				}
+				return &String{Value: strings.TrimSpace(strs[0])}
+			},
+		},
+	},
+	{
+		"replace",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3", len(args))
+				}
+				strs, err := stringArgs("replace", args)
+				if err != nil {
+					return err
+				}
+				return &String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+			},
+		},
+	},
+	{
+		"type",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				return &String{Value: string(args[0].Type())}
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *Float:
+					truncated := math.Trunc(arg.Value)
+					if math.IsNaN(truncated) || truncated < math.MinInt64 || truncated >= math.MaxInt64 {
+						return newError("cannot convert %s to INTEGER", arg.Inspect())
+					}
+					return &Integer{Value: int64(truncated)}
+				case *String:
+					value, err := strconv.ParseInt(arg.Value, 10, 64)
+					if err != nil {
+						return newError("cannot parse %q as INTEGER", arg.Value)
+					}
+					return &Integer{Value: value}
+				default:
+					return newError("argument to `int` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Float:
+					return arg
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *String:
+					value, err := strconv.ParseFloat(arg.Value, 64)
+					if err != nil {
+						return newError("cannot parse %q as FLOAT", arg.Value)
+					}
+					return &Float{Value: value}
+				default:
+					return newError("argument to `float` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"str",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if str, ok := args[0].(*String); ok {
+					return str
+				}
+				return &String{Value: args[0].Inspect()}
+			},
+		},
+	},
+	{
+		"print",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				values := make([]string, len(args))
+				for i, arg := range args {
+					values[i] = arg.Inspect()
+				}
+				_, _ = fmt.Fprint(Output, strings.Join(values, " "))
+				return nil
+			},
+		},
+	},
+	{
+		"abs",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Integer:
+					if arg.Value < 0 {
+						return &Integer{Value: -arg.Value}
+					}
+					return arg
+				case *Float:
+					return &Float{Value: math.Abs(arg.Value)}
+				default:
+					return newError("argument to `abs` must be INTEGER or FLOAT, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"min",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return extremum("min", args, func(a, b float64) bool { return a < b })
+			},
+		},
+	},
+	{
+		"max",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return extremum("max", args, func(a, b float64) bool { return a > b })
+			},
+		},
+	},
+	{
+		"pow",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				base, exponent, err := numberArgs("pow", args)
+				if err != nil {
+					return err
+				}
+				// Integers raised to non-negative integer powers stay integers.
+				intBase, baseOK := args[0].(*Integer)
+				intExponent, exponentOK := args[1].(*Integer)
+				if baseOK && exponentOK && intExponent.Value >= 0 {
+					return &Integer{Value: integerPow(intBase.Value, intExponent.Value)}
+				}
+				return &Float{Value: math.Pow(base, exponent)}
+			},
+		},
+	},
+	{
+		"sqrt",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				value, ok := numberValue(args[0])
+				if !ok {
+					return newError("argument to `sqrt` must be INTEGER or FLOAT, got %s", args[0].Type())
+				}
+				if value < 0 {
+					return newError("`sqrt` of negative number %s", args[0].Inspect())
+				}
+				return &Float{Value: math.Sqrt(value)}
+			},
+		},
+	},
+	{
+		"floor",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return roundToInteger("floor", args, math.Floor)
+			},
+		},
+	},
+	{
+		"ceil",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return roundToInteger("ceil", args, math.Ceil)
+			},
+		},
+	},
+	{
+		"rand",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				switch len(args) {
+				case 0:
+					return &Float{Value: Random.Float64()}
+				case 1:
+					n, ok := args[0].(*Integer)
+					if !ok {
+						return newError("argument to `rand` must be INTEGER, got %s", args[0].Type())
+					}
+					if n.Value <= 0 {
+						return newError("argument to `rand` must be positive, got %d", n.Value)
+					}
+					return &Integer{Value: Random.Int64N(n.Value)}
+				default:
+					return newError("wrong number of arguments. got=%d, want=0..1", len(args))
+				}
+			},
+		},
+	},
+	{
+		"seed",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				seed, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `seed` must be INTEGER, got %s", args[0].Type())
+				}
+				Seed(seed.Value)
+				return nil
+			},
+		},
+	},
+	{
+		"now",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return &Integer{Value: time.Now().UnixMilli()}
+			},
+		},
+	},
+	{
+		"sleep",
+		&Builtin{
+			WithContext: func(ctx context.Context, args ...Object) (Object, error) {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args)), nil
+				}
+				ms, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type()), nil
+				}
+				if ms.Value < 0 {
+					return newError("argument to `sleep` must not be negative, got %d", ms.Value), nil
+				}
+
+				timer := time.NewTimer(time.Duration(ms.Value) * time.Millisecond)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+					return nil, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		},
+	},
+	{
+		"delete",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				hash, key, err := hashKeyArgs("delete", args)
+				if err != nil {
+					return err
+				}
+				result := copyHash(hash)
+				result.Delete(key)
+				return result
+			},
+		},
+	},
+	{
+		"set",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3", len(args))
+				}
+				hash, key, err := hashKeyArgs("set", args)
+				if err != nil {
+					return err
+				}
+				result := copyHash(hash)
+				result.Set(key, HashPair{Key: args[1], Value: args[2]})
+				return result
+			},
+		},
+	},
+	{
+		"has",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				hash, key, err := hashKeyArgs("has", args)
+				if err != nil {
+					return err
+				}
+				_, ok := hash.Pairs[key]
+				return NativeBoolToBoolean(ok)
+			},
+		},
+	},
+	{
+		"pop",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return newError("argument to `pop` must be ARRAY, got %s", args[0].Type())
+				}
+				length := len(arr.Elements)
+				if length == 0 {
+					return newError("cannot pop from an empty array")
+				}
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements)
+
+				return &Array{Elements: []Object{&Array{Elements: newElements}, arr.Elements[length-1]}}
+			},
+		},
+	},
+	{
+		"sort",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) (Object, error) {
+				switch len(args) {
+				case 1:
+					array, ok := args[0].(*Array)
+					if !ok {
+						return newError("argument to `sort` must be ARRAY, got %s", args[0].Type()), nil
+					}
+					return sortArray(array, compareValues)
+				case 2:
+					array, fn, err := higherOrderArgs("sort", args)
+					if err != nil {
+						return err, nil
+					}
+					return sortArray(array, func(a, b Object) (int, Object, error) {
+						result, err := call(fn, a, b)
+						if err != nil {
+							return 0, nil, err
+						}
+						order, ok := result.(*Integer)
+						if !ok {
+							return 0, newError("comparator of `sort` must return INTEGER, got %s", result.Type()), nil
+						}
+						return cmp.Compare(order.Value, 0), nil, nil
+					})
+				default:
+					return newError("wrong number of arguments. got=%d, want=1..2", len(args)), nil
+				}
+			},
+		},
+	},
+	{
+		"exit",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				switch len(args) {
+				case 0:
+					return &Exit{Code: 0}
+				case 1:
+					code, ok := args[0].(*Integer)
+					if !ok {
+						return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+					}
+					if code.Value < 0 || code.Value > 255 {
+						return newError("argument to `exit` must be between 0 and 255, got %d", code.Value)
+					}
+					return &Exit{Code: int(code.Value)}
+				default:
+					return newError("wrong number of arguments. got=%d, want=0..1", len(args))
+				}
+			},
+		},
+	},
+	{
+		"readline",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				line, ok, err := readLine()
+				if err != nil {
+					return newError("error reading input: %s", err)
+				}
+				if !ok {
+					return nil
+				}
+				return &String{Value: line}
+			},
+		},
+	},
+	{
+		"read_file",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if !EnableFileIO {
+					return fileIODisabled("read_file")
+				}
+				strs, errObj := stringArgs("read_file", args)
+				if errObj != nil {
+					return errObj
+				}
+
+				//nolint:gosec // Reading the files a program names is the point of the builtin.
+				content, err := os.ReadFile(strs[0])
+				if err != nil {
+					return newError("error reading file: %s", err)
+				}
+				return &String{Value: string(content)}
+			},
+		},
+	},
+	{
+		"write_file",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if !EnableFileIO {
+					return fileIODisabled("write_file")
+				}
+				strs, errObj := stringArgs("write_file", args)
+				if errObj != nil {
+					return errObj
+				}
+
+				//nolint:gosec // Writing the files a program names is the point of the builtin.
+				err := os.WriteFile(strs[0], []byte(strs[1]), 0o644)
+				if err != nil {
+					return newError("error writing file: %s", err)
+				}
+				return &Integer{Value: int64(len(strs[1]))}
+			},
+		},
+	},
+	{
+		"format",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) == 0 {
+					return newError("wrong number of arguments. got=0, want at least 1")
+				}
+				template, ok := args[0].(*String)
+				if !ok {
+					return newError("first argument to `format` must be STRING, got %s", args[0].Type())
+				}
+				return formatTemplate(template.Value, args[1:])
+			},
+		},
+	},
+}
+
+// formatTemplate implements `format`: it replaces each "{}" in template with the next argument as printed by `puts`.
+// "{{" and "}}" stand for literal braces, and any other brace is an error,
+// as is a number of arguments different from the number of placeholders.
+func formatTemplate(template string, args []Object) Object {
+	var out strings.Builder
+	placeholders := 0
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '{' && c != '}' {
+			out.WriteByte(c)
+			continue
+		}
+
+		var next byte
+		if i+1 < len(template) {
+			next = template[i+1]
+		}
+		switch {
+		case c == next:
+			out.WriteByte(c)
+		case c == '{' && next == '}':
+			if placeholders < len(args) {
+				out.WriteString(args[placeholders].Inspect())
+			}
+			placeholders++
+		default:
+			return newError("unmatched `%c` at offset %d of `format` template", c, i)
+		}
+		i++
+	}
+
+	if placeholders != len(args) {
+		return newError("`format` template has %d placeholders, got %d arguments", placeholders, len(args))
+	}
+	return &String{Value: out.String()}
+}
+
+// fileIODisabled returns the error of the named file builtin when [EnableFileIO] is false.
+func fileIODisabled(name string) *Error {
+	return newError("file I/O is disabled, cannot call `%s`", name)
+}
+
+// ordinals names argument positions in error messages.
+var ordinals = []string{"first", "second", "third"}
+
+// stringArgs checks that all arguments of the named builtin are strings, and returns their values.
+func stringArgs(name string, args []Object) ([]string, *Error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*String)
+		if !ok {
+			if len(args) == 1 {
+				return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+			}
+			return nil, newError("%s argument to `%s` must be STRING, got %s", ordinals[i], name, arg.Type())
+		}
+		strs[i] = str.Value
+	}
+	return strs, nil
+}
+
+// higherOrderArgs checks that the first two arguments of the named builtin are an array and a function.
+func higherOrderArgs(name string, args []Object) (*Array, Object, *Error) {
+	array, ok := args[0].(*Array)
+	if !ok {
+		return nil, nil, newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	switch args[1].(type) {
+	case *Closure, *Builtin:
+		return array, args[1], nil
+	default:
+		return nil, nil, newError("second argument to `%s` must be a function, got %s", name, args[1].Type())
+	}
+}
+
+// isTruthy reports whether obj counts as true in a condition: everything except false and null does.
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// MaxRangeLength is the largest number of elements the `range` builtin returns.
+// Longer ranges are an error, rather than exhausting memory.
+const MaxRangeLength = 10_000_000
+
+// integerRange builds the array for range(end), range(start, end) or range(start, end, step).
+// The array runs from start (default 0) up to but not including end, in increments of step (default 1).
+func integerRange(bounds []int64) Object {
+	var start, end, step int64 = 0, bounds[0], 1
+	if len(bounds) > 1 {
+		start, end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+		if step == 0 {
+			return newError("`range` step must not be zero")
+		}
+		if (step > 0 && end < start) || (step < 0 && end > start) {
+			return newError("`range` step %d does not lead from %d to %d", step, start, end)
+		}
+	}
+
+	// The distance and step are unsigned so that ranges spanning the whole int64 range do not overflow.
+	distance, stride := uint64(0), uint64(1)
+	if step > 0 && end > start {
+		distance, stride = uint64(end)-uint64(start), uint64(step)
+	} else if step < 0 && end < start {
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	}
+	length := distance / stride
+	if distance%stride != 0 {
+		length++
+	}
+	if length > MaxRangeLength {
+		return newError("`range` of %d elements exceeds the maximum of %d", length, MaxRangeLength)
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		elements[i] = &Integer{Value: start + int64(i)*step}
+	}
+	return &Array{Elements: elements}
+}
+
+// setElementArgs checks that the arguments of the named set builtin are a set and a hashable element,
+// and returns the element's hash key.
+func setElementArgs(name string, args []Object) (*Set, HashKey, *Error) {
+	set, ok := args[0].(*Set)
+	if !ok {
+		return nil, HashKey{}, newError("first argument to `%s` must be SET, got %s", name, args[0].Type())
+	}
+	element, ok := args[1].(Hashable)
+	if !ok {
+		return nil, HashKey{}, newError("unusable as set element: %s", args[1].Type())
+	}
+	return set, element.HashKey(), nil
+}
+
+// hashKeyArgs checks that the first two arguments of the named hash builtin are a hash and a hashable key,
+// and returns the key's hash key.
+func hashKeyArgs(name string, args []Object) (*Hash, HashKey, *Error) {
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, HashKey{}, newError("first argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return nil, HashKey{}, newError("unusable as hash key: %s", args[1].Type())
+	}
+	return hash, key.HashKey(), nil
+}
+
+// copyHash returns a new hash with the pairs of hash, in the same order.
+func copyHash(hash *Hash) *Hash {
+	pairs := hash.OrderedPairs()
+	result := NewHash(len(pairs))
+	for _, pair := range pairs {
+		result.Set(pair.Key.(Hashable).HashKey(), pair)
+	}
+	return result
+}
+
+// listIndexArgs checks that the first two arguments of the named list builtin are a list and an integer index.
+func listIndexArgs(name string, args []Object) (*List, int64, *Error) {
+	list, ok := args[0].(*List)
+	if !ok {
+		return nil, 0, newError("first argument to `%s` must be LIST, got %s", name, args[0].Type())
+	}
+	index, ok := args[1].(*Integer)
+	if !ok {
+		return nil, 0, newError("second argument to `%s` must be INTEGER, got %s", name, args[1].Type())
+	}
+	return list, index.Value, nil
+}
+
+// numberValue returns the value of an integer or a float as a float64, and reports whether obj is either.
+func numberValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// numberArgs checks that the two arguments of the named builtin are integers or floats, and returns their values.
+func numberArgs(name string, args []Object) (float64, float64, *Error) {
+	var values [2]float64
+	for i, arg := range args[:2] {
+		value, ok := numberValue(arg)
+		if !ok {
+			return 0, 0, newError("%s argument to `%s` must be INTEGER or FLOAT, got %s", ordinals[i], name, arg.Type())
+		}
+		values[i] = value
+	}
+	return values[0], values[1], nil
+}
+
+// extremum implements min and max: it returns the argument, or the element of a single array argument,
+// that is before all others according to before. Integers and floats may be mixed.
+func extremum(name string, args []Object, before func(a, b float64) bool) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+	if array, ok := args[0].(*Array); ok && len(args) == 1 {
+		if len(array.Elements) == 0 {
+			return newError("`%s` of an empty array", name)
+		}
+		args = array.Elements
+	}
+
+	var best Object
+	var bestValue float64
+	for _, arg := range args {
+		value, ok := numberValue(arg)
+		if !ok {
+			return newError("arguments to `%s` must be INTEGER or FLOAT, got %s", name, arg.Type())
+		}
+		if best == nil || before(value, bestValue) {
+			best, bestValue = arg, value
+		}
+	}
+	return best
+}
+
+// sortArray returns a new array with the elements of array in the order given by compare, keeping equal elements
+// in their original order. compare returns the sign of the comparison, or the first error object or error
+// it runs into, which is returned instead of the array.
+func sortArray(array *Array, compare func(a, b Object) (int, Object, error)) (Object, error) {
+	elements := slices.Clone(array.Elements)
+
+	var errObj Object
+	var err error
+	slices.SortStableFunc(elements, func(a, b Object) int {
+		if errObj != nil || err != nil {
+			return 0
+		}
+		var order int
+		order, errObj, err = compare(a, b)
+		return order
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if errObj != nil {
+		return errObj, nil
+	}
+	return &Array{Elements: elements}, nil
+}
+
+// compareValues orders numbers by value and strings lexicographically, for `sort` without a comparator.
+// Integers and floats may be mixed; other values cannot be ordered.
+func compareValues(a, b Object) (int, Object, error) {
+	if a, ok := a.(*String); ok {
+		if b, ok := b.(*String); ok {
+			return strings.Compare(a.Value, b.Value), nil, nil
+		}
+	}
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			return cmp.Compare(a.Value, b.Value), nil, nil
+		}
+	}
+	aValue, aIsNumber := numberValue(a)
+	bValue, bIsNumber := numberValue(b)
+	if aIsNumber && bIsNumber {
+		return cmp.Compare(aValue, bValue), nil, nil
+	}
+	return 0, newError("`sort` cannot order %s and %s without a comparator", a.Type(), b.Type()), nil
+}
+
+// integerPow returns base raised to the non-negative power exponent, by repeated squaring.
+func integerPow(base, exponent int64) int64 {
+	result := int64(1)
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exponent >>= 1
+	}
+	return result
+}
+
+// roundToInteger implements floor and ceil: it rounds a float with round and converts it to an integer.
+// Integers are returned unchanged.
+func roundToInteger(name string, args []Object, round func(float64) float64) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *Float:
+		rounded := round(arg.Value)
+		if math.IsNaN(rounded) || rounded < math.MinInt64 || rounded >= math.MaxInt64 {
+			return newError("cannot convert %s to INTEGER", arg.Inspect())
+		}
+		return &Integer{Value: int64(rounded)}
+	default:
+		return newError("argument to `%s` must be INTEGER or FLOAT, got %s", name, args[0].Type())
+	}
+}
+
+// memoize wraps fn in a builtin that caches its results by argument values.
+// Calls with arguments that are not hashable are passed through uncached.
+// Cached results are returned as is, so an array or hash result is shared by every call that returns it.
+func memoize(fn Object) *Builtin {
+	cache := make(map[string]Object)
+
+	return &Builtin{
+		HigherOrder: func(call CallFunction, args ...Object) (Object, error) {
+			key, ok := memoKey(args)
+			if ok {
+				if result, hit := cache[key]; hit {
+					return result, nil
+				}
+			}
+
+			result, err := call(fn, args...)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				cache[key] = result
+			}
+			return result, nil
+		},
+	}
+}
+
+// memoKey builds a cache key from the types and values of args.
+// It reports false if any argument is not hashable.
+func memoKey(args []Object) (string, bool) {
+	var b strings.Builder
+
+	for _, arg := range args {
+		if _, ok := arg.(Hashable); !ok {
+			return "", false
+		}
+		value := arg.Inspect()
+		_, _ = fmt.Fprintf(&b, "%s:%d:%s;", arg.Type(), len(value), value)
+	}
+	return b.String(), true
 }
 
 func newError(format string, a ...any) *Error {
@@ -0,0 +1,223 @@
+package object
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureOutput returns what f writes to [Output].
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	previous := SetOutput(&out)
+	defer SetOutput(previous)
+
+	f()
+	return out.String()
+}
+
+// TestPrint verifies that print separates its arguments with spaces and adds no newline.
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{[]Object{}, ""},
+		{[]Object{&String{Value: "hello"}}, "hello"},
+		{[]Object{&String{Value: "a"}, &Integer{Value: 1}, True}, "a 1 true"},
+		{[]Object{&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}, &String{Value: "\n"}}, "[1, 2] \n"},
+	}
+
+	printBuiltin := GetBuiltinByName("print")
+	for _, tt := range tests {
+		var result Object
+		out := captureOutput(t, func() {
+			result = printBuiltin.Fn(tt.args...)
+		})
+
+		if out != tt.expected {
+			t.Errorf("wrong output. want=%q, got=%q", tt.expected, out)
+		}
+		if result != nil {
+			t.Errorf("print returned %v, want nil", result)
+		}
+	}
+}
+
+// TestSetOutput verifies that builtins write to the writer set with SetOutput, and that it can be restored.
+func TestSetOutput(t *testing.T) {
+	if Output != os.Stdout {
+		t.Fatalf("Output does not default to os.Stdout. got=%v", Output)
+	}
+
+	var out bytes.Buffer
+	previous := SetOutput(&out)
+	if previous != os.Stdout {
+		t.Errorf("SetOutput did not return the previous writer. got=%v", previous)
+	}
+
+	GetBuiltinByName("puts").Fn(&String{Value: "hello"}, &Integer{Value: 5})
+	GetBuiltinByName("print").Fn(&String{Value: "world"})
+
+	expected := "hello 5 \nworld"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+
+	SetOutput(previous)
+	if Output != os.Stdout {
+		t.Errorf("Output was not restored. got=%v", Output)
+	}
+}
+
+// TestReadline verifies that readline returns the lines of the reader set with SetInput, then null at the end.
+func TestReadline(t *testing.T) {
+	if Input != os.Stdin {
+		t.Fatalf("Input does not default to os.Stdin. got=%v", Input)
+	}
+
+	previous := SetInput(strings.NewReader("first line\r\nsecond\n\nlast"))
+	defer SetInput(previous)
+
+	readline := GetBuiltinByName("readline")
+	for _, expected := range []string{"first line", "second", "", "last"} {
+		str, ok := readline.Fn().(*String)
+		if !ok || str.Value != expected {
+			t.Errorf("wrong line. want=%q, got=%v", expected, str)
+		}
+	}
+	for range 2 {
+		if result := readline.Fn(); result != nil {
+			t.Errorf("expected null at the end of the input, got %v", result)
+		}
+	}
+
+	SetInput(strings.NewReader("other\n"))
+	if str, ok := readline.Fn().(*String); !ok || str.Value != "other" {
+		t.Errorf("readline did not read from the new input. got=%v", str)
+	}
+
+	result, ok := readline.Fn(&Integer{Value: 1}).(*Error)
+	if !ok || result.Message != "wrong number of arguments. got=1, want=0" {
+		t.Errorf("expected an argument count error, got %v", result)
+	}
+}
+
+// TestFileBuiltins verifies that write_file and read_file round-trip a file, and report errors as error objects.
+func TestFileBuiltins(t *testing.T) {
+	readFile := GetBuiltinByName("read_file")
+	writeFile := GetBuiltinByName("write_file")
+	path := filepath.Join(t.TempDir(), "notes.txt")
+
+	written, ok := writeFile.Fn(&String{Value: path}, &String{Value: "héllo\n"}).(*Integer)
+	if !ok || written.Value != 7 {
+		t.Fatalf("write_file returned %v, want 7", written)
+	}
+	content, ok := readFile.Fn(&String{Value: path}).(*String)
+	if !ok || content.Value != "héllo\n" {
+		t.Errorf("read_file returned %v, want %q", content, "héllo\n")
+	}
+
+	writeFile.Fn(&String{Value: path}, &String{Value: ""})
+	if content, ok := readFile.Fn(&String{Value: path}).(*String); !ok || content.Value != "" {
+		t.Errorf("write_file did not replace the contents. got=%v", content)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	errorTests := []struct {
+		builtin  *Builtin
+		args     []Object
+		expected string
+	}{
+		{readFile, []Object{&String{Value: missing}}, "error reading file: open " + missing + ": no such file or directory"},
+		{writeFile, []Object{&String{Value: filepath.Join(missing, "x")}, &String{Value: ""}},
+			"error writing file: open " + filepath.Join(missing, "x") + ": no such file or directory"},
+		{readFile, []Object{&Integer{Value: 1}}, "argument to `read_file` must be STRING, got INTEGER"},
+		{writeFile, []Object{&String{Value: path}, &Integer{Value: 1}}, "second argument to `write_file` must be STRING, got INTEGER"},
+		{writeFile, []Object{&String{Value: path}}, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errorTests {
+		result, ok := tt.builtin.Fn(tt.args...).(*Error)
+		if !ok || result.Message != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, result)
+		}
+	}
+}
+
+// TestFileBuiltinsDisabled verifies that read_file and write_file refuse to access files when EnableFileIO is false.
+func TestFileBuiltinsDisabled(t *testing.T) {
+	defer func(previous bool) { EnableFileIO = previous }(EnableFileIO)
+	EnableFileIO = false
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, ok := GetBuiltinByName("read_file").Fn(&String{Value: path}).(*Error)
+	if !ok || result.Message != "file I/O is disabled, cannot call `read_file`" {
+		t.Errorf("expected read_file to be disabled, got %v", result)
+	}
+
+	result, ok = GetBuiltinByName("write_file").Fn(&String{Value: path}, &String{Value: "changed"}).(*Error)
+	if !ok || result.Message != "file I/O is disabled, cannot call `write_file`" {
+		t.Errorf("expected write_file to be disabled, got %v", result)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "secret" {
+		t.Errorf("write_file changed the file while disabled: %q", content)
+	}
+}
+
+// TestRandSeed verifies that seeding makes rand return the same sequence, and that rand validates its argument.
+func TestRandSeed(t *testing.T) {
+	defer func(previous *rand.Rand) { Random = previous }(Random)
+
+	randBuiltin := GetBuiltinByName("rand")
+	seedBuiltin := GetBuiltinByName("seed")
+
+	if result := seedBuiltin.Fn(&Integer{Value: 42}); result != nil {
+		t.Fatalf("seed returned %v, want nil", result)
+	}
+	expected := []int64{85, 96, 13, 8}
+	for i, want := range expected {
+		got, ok := randBuiltin.Fn(&Integer{Value: 100}).(*Integer)
+		if !ok || got.Value != want {
+			t.Errorf("wrong value %d after seed(42). want=%d, got=%v", i, want, got)
+		}
+	}
+
+	Seed(7)
+	first := randBuiltin.Fn().(*Float).Value
+	Seed(7)
+	second := randBuiltin.Fn().(*Float).Value
+	if first != second {
+		t.Errorf("rand() differs after reseeding with the same seed: %v != %v", first, second)
+	}
+	if first < 0 || first >= 1 {
+		t.Errorf("rand() out of [0, 1): %v", first)
+	}
+
+	errorTests := []struct {
+		builtin  *Builtin
+		args     []Object
+		expected string
+	}{
+		{randBuiltin, []Object{&Integer{Value: 0}}, "argument to `rand` must be positive, got 0"},
+		{randBuiltin, []Object{&Integer{Value: -3}}, "argument to `rand` must be positive, got -3"},
+		{randBuiltin, []Object{&String{Value: "3"}}, "argument to `rand` must be INTEGER, got STRING"},
+		{randBuiltin, []Object{&Integer{Value: 1}, &Integer{Value: 2}}, "wrong number of arguments. got=2, want=0..1"},
+		{seedBuiltin, []Object{}, "wrong number of arguments. got=0, want=1"},
+		{seedBuiltin, []Object{True}, "argument to `seed` must be INTEGER, got BOOLEAN"},
+	}
+	for _, tt := range errorTests {
+		result, ok := tt.builtin.Fn(tt.args...).(*Error)
+		if !ok || result.Message != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, result)
+		}
+	}
+}
@@ -17,8 +17,10 @@
 package object
 
 import (
+	"context"
 	"fmt"
 	"hash/fnv"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -29,6 +31,7 @@ import (
 //nolint:revive
 const (
 	IntegerObj          = "INTEGER"
+	FloatObj            = "FLOAT"
 	BooleanObj          = "BOOLEAN"
 	StringObj           = "STRING"
 	NullObj             = "NULL"
@@ -38,8 +41,12 @@ const (
 	BuiltinObj          = "BUILTIN"
 	ArrayObj            = "ARRAY"
 	HashObj             = "HASH"
-	CompiledFunctionObj = "COMPILED_FUNCTION_OBJ"
+	CompiledFunctionObj = "COMPILED_FUNCTION"
 	ClosureObj          = "CLOSURE"
+	StringBuilderObj    = "STRING_BUILDER"
+	ListObj             = "LIST"
+	SetObj              = "SET"
+	ExitObj             = "EXIT"
 )
 
 // Type represents the type of object.
@@ -66,11 +73,70 @@ func (i *Integer) Type() Type { return IntegerObj }
 // Inspect returns a string representation of the object.
 func (i *Integer) Inspect() string { return strconv.FormatInt(i.Value, 10) }
 
+// The range of integers that [NewInteger] returns shared objects for.
+const (
+	minSmallInteger = -128
+	maxSmallInteger = 255
+)
+
+// smallIntegers holds the shared objects for the integers from minSmallInteger to maxSmallInteger.
+var smallIntegers = func() (ints [maxSmallInteger - minSmallInteger + 1]*Integer) {
+	for i := range ints {
+		ints[i] = &Integer{Value: int64(i + minSmallInteger)}
+	}
+	return ints
+}()
+
+// NewInteger returns an integer object for value.
+// Small integers, from -128 to 255, are shared objects, like [True] and [False], so producing one does not allocate.
+// Integer objects must therefore never be modified.
+func NewInteger(value int64) *Integer {
+	if value >= minSmallInteger && value <= maxSmallInteger {
+		return smallIntegers[value-minSmallInteger]
+	}
+	return &Integer{Value: value}
+}
+
+// Float represents a Monkey floating-point value.
+type Float struct {
+	Value float64
+}
+
+// Type returns the type of the object.
+func (f *Float) Type() Type { return FloatObj }
+
+// Inspect returns a string representation of the object.
+// Whole numbers keep a decimal point, so that they are not mistaken for integers.
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
 // Boolean represents a Monkey boolean value.
 type Boolean struct {
 	Value bool
 }
 
+var (
+	// True is the shared boolean object for `true`.
+	// Booleans are compared by identity, so every true value must be this object.
+	True = &Boolean{Value: true}
+
+	// False is the shared boolean object for `false`.
+	False = &Boolean{Value: false}
+)
+
+// NativeBoolToBoolean returns the shared [True] or [False] object for a Go boolean.
+func NativeBoolToBoolean(value bool) *Boolean {
+	if value {
+		return True
+	}
+	return False
+}
+
 // Type returns the type of the object.
 func (b *Boolean) Type() Type { return BooleanObj }
 
@@ -121,6 +187,22 @@ func (e *Error) Type() Type { return ErrorObj }
 // Inspect returns a string representation of the object.
 func (e *Error) Inspect() string { return "ERROR: " + e.Message }
 
+// Exit is returned by the `exit` builtin to stop the program with a status code.
+// It is never a value of the program: execution engines stop and return it as the error the program ended with,
+// leaving it to the embedding application to exit with Code, or not.
+type Exit struct {
+	Code int
+}
+
+// Type returns the type of the object.
+func (e *Exit) Type() Type { return ExitObj }
+
+// Inspect returns a string representation of the object.
+func (e *Exit) Inspect() string { return fmt.Sprintf("exit(%d)", e.Code) }
+
+// Error returns the message of the error the program ends with.
+func (e *Exit) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
 // Function represents a Monkey function.
 type Function struct {
 	Parameters []*ast.Identifier
@@ -155,9 +237,31 @@ func (f *Function) Inspect() string {
 // BuiltinFunction represents a Monkey builtin function.
 type BuiltinFunction func(args ...Object) Object
 
+// CallFunction calls a Monkey function value (a closure or a builtin) with the given arguments and returns its result.
+// Execution engines supply it to higher-order builtins.
+type CallFunction func(fn Object, args ...Object) (Object, error)
+
+// HigherOrderFunction represents a Monkey builtin function that calls back into Monkey functions through call.
+//
+// An error returned from call (or from the function itself) aborts the program,
+// whereas a returned [Error] object is an ordinary Monkey value.
+type HigherOrderFunction func(call CallFunction, args ...Object) (Object, error)
+
+// ContextFunction represents a Monkey builtin function that blocks, such as `sleep`, and stops once ctx is done.
+// Execution engines pass the context the program runs with, or [context.Background] if it has none.
+//
+// Like for a [HigherOrderFunction], a returned error aborts the program.
+type ContextFunction func(ctx context.Context, args ...Object) (Object, error)
+
 // Builtin represents a Monkey builtin.
 type Builtin struct {
 	Fn BuiltinFunction
+
+	// HigherOrder, when set, is used instead of Fn.
+	HigherOrder HigherOrderFunction
+
+	// WithContext, when set, is used instead of Fn.
+	WithContext ContextFunction
 }
 
 // Type returns the type of the object.
@@ -174,6 +278,25 @@ type Array struct {
 // Type returns the type of the object.
 func (a *Array) Type() Type { return ArrayObj }
 
+// List represents a mutable Monkey list.
+// Unlike an [Array], a list is modified in place by its builtins.
+type List struct {
+	Elements []Object
+}
+
+// Type returns the type of the object.
+func (l *List) Type() Type { return ListObj }
+
+// Inspect returns a string representation of the object.
+func (l *List) Inspect() string {
+	elements := make([]string, len(l.Elements))
+	for i, e := range l.Elements {
+		elements[i] = e.Inspect()
+	}
+
+	return "list[" + strings.Join(elements, ", ") + "]"
+}
+
 // Inspect returns a string representation of the object.
 func (a *Array) Inspect() string {
 	var out strings.Builder
@@ -240,9 +363,126 @@ type HashPair struct {
 	Value Object
 }
 
+// Set represents a Monkey set of hashable values.
+// Elements are kept in insertion order.
+type Set struct {
+	Elements map[HashKey]Object
+
+	// order holds the keys of Elements in insertion order.
+	order []HashKey
+}
+
+// NewSet creates an empty [Set].
+func NewSet() *Set {
+	return &Set{Elements: make(map[HashKey]Object)}
+}
+
+// Add adds obj to the set under the given key, unless an equal element is already present.
+func (s *Set) Add(key HashKey, obj Object) {
+	if _, ok := s.Elements[key]; ok {
+		return
+	}
+	s.Elements[key] = obj
+	s.order = append(s.order, key)
+}
+
+// Has reports whether the set contains an element with the given key.
+func (s *Set) Has(key HashKey) bool {
+	_, ok := s.Elements[key]
+	return ok
+}
+
+// Remove removes the element with the given key from the set, reporting whether it was present.
+func (s *Set) Remove(key HashKey) bool {
+	if _, ok := s.Elements[key]; !ok {
+		return false
+	}
+	delete(s.Elements, key)
+	s.order = slices.DeleteFunc(s.order, func(k HashKey) bool { return k == key })
+	return true
+}
+
+// Values returns the elements of the set in insertion order.
+func (s *Set) Values() []Object {
+	values := make([]Object, len(s.order))
+	for i, key := range s.order {
+		values[i] = s.Elements[key]
+	}
+	return values
+}
+
+// Type returns the type of the object.
+func (s *Set) Type() Type { return SetObj }
+
+// Inspect returns a string representation of the object.
+func (s *Set) Inspect() string {
+	elements := make([]string, len(s.order))
+	for i, key := range s.order {
+		elements[i] = s.Elements[key].Inspect()
+	}
+
+	return "set{" + strings.Join(elements, ", ") + "}"
+}
+
 // Hash represents a Monkey hash.
+// Pairs added with [Hash.Set] are kept in insertion order.
 type Hash struct {
 	Pairs map[HashKey]HashPair
+
+	// order holds the keys of Pairs in insertion order.
+	order []HashKey
+}
+
+// NewHash creates an empty [Hash] with room for size pairs.
+func NewHash(size int) *Hash {
+	return &Hash{
+		Pairs: make(map[HashKey]HashPair, size),
+		order: make([]HashKey, 0, size),
+	}
+}
+
+// Set adds a pair to the hash under the given key.
+// Replacing the value of an existing key keeps the key's original position.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if _, ok := h.Pairs[key]; !ok {
+		h.order = append(h.order, key)
+	}
+	h.Pairs[key] = pair
+}
+
+// Delete removes the pair with the given key from the hash, reporting whether it was present.
+func (h *Hash) Delete(key HashKey) bool {
+	if _, ok := h.Pairs[key]; !ok {
+		return false
+	}
+	delete(h.Pairs, key)
+	h.order = slices.DeleteFunc(h.order, func(k HashKey) bool { return k == key })
+	return true
+}
+
+// OrderedPairs returns the pairs of the hash in insertion order.
+// Pairs stored directly in the Pairs map, bypassing [Hash.Set], follow in unspecified order.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	ordered := make(map[HashKey]bool, len(h.order))
+
+	for _, key := range h.order {
+		if pair, ok := h.Pairs[key]; ok {
+			pairs = append(pairs, pair)
+			ordered[key] = true
+		}
+	}
+	if len(pairs) < len(h.Pairs) {
+		for key, pair := range h.Pairs {
+			if !ordered[key] {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	return pairs
 }
 
 // Type returns the type of the object.
@@ -253,7 +493,7 @@ func (h *Hash) Inspect() string {
 	var out strings.Builder
 
 	pairs := make([]string, 0, len(h.Pairs))
-	for _, pair := range h.Pairs {
+	for _, pair := range h.OrderedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -279,13 +519,33 @@ type CompiledFunction struct {
 
 	// NumParameters specifies the number of parameters accepted by the compiled function.
 	NumParameters int
+
+	// Name is the name the function was bound to with "let", or empty for an anonymous function.
+	Name string
+
+	// SourceMap maps the offsets of the function's instructions to the source code they were compiled from.
+	SourceMap code.SourceMap
+
+	// LocalNames holds the names of the function's local variables, parameters first, indexed by their slot.
+	// It is only recorded when compiling with debugging information, and is empty otherwise.
+	LocalNames []string
 }
 
 // Type returns the object type of the compiled function, which is [CompiledFunctionObj].
 func (c *CompiledFunction) Type() Type { return CompiledFunctionObj }
 
-// Inspect returns a formatted string representation of the CompiledFunction instance, including its memory address.
-func (c *CompiledFunction) Inspect() string { return fmt.Sprintf("CompiledFunction[%p]", c) }
+// Inspect returns the signature of the compiled function: its name, if any, and its number of parameters,
+// like "fn add(2 params)" or "fn(1 param)".
+func (c *CompiledFunction) Inspect() string {
+	params := "params"
+	if c.NumParameters == 1 {
+		params = "param"
+	}
+	if c.Name == "" {
+		return fmt.Sprintf("fn(%d %s)", c.NumParameters, params)
+	}
+	return fmt.Sprintf("fn %s(%d %s)", c.Name, c.NumParameters, params)
+}
 
 // Closure represents a function and its free variables in a virtual machine's execution context.
 type Closure struct {
@@ -294,10 +554,38 @@ type Closure struct {
 
 	// Free holds the objects representing free variables captured by the closure for use during its execution.
 	Free []Object
+
+	// Self is what the closure's function refers to itself as by name: the wrapper of an annotated local function,
+	// such as the builtin returned by `memoize`, so that recursive calls go through it. Nil stands for the closure.
+	Self Object
 }
 
 // Type returns the type of the object, specifically [ClosureObj] for instances of Closure.
 func (c *Closure) Type() Type { return ClosureObj }
 
-// Inspect returns a string representation of the Closure instance, including its memory address.
-func (c *Closure) Inspect() string { return fmt.Sprintf("Closure[%p]", c) }
+// Inspect returns the signature of the closure's function (see [CompiledFunction.Inspect]),
+// followed by the number of free variables it captured, if any, like "fn(1 param) with 2 free variables".
+func (c *Closure) Inspect() string {
+	switch len(c.Free) {
+	case 0:
+		return c.Fn.Inspect()
+	case 1:
+		return c.Fn.Inspect() + " with 1 free variable"
+	default:
+		return fmt.Sprintf("%s with %d free variables", c.Fn.Inspect(), len(c.Free))
+	}
+}
+
+// StringBuilder is a mutable string buffer, used to build long strings
+// in linear time instead of by repeated concatenation.
+type StringBuilder struct {
+	Builder strings.Builder
+}
+
+// Type returns the type of the object.
+func (sb *StringBuilder) Type() Type { return StringBuilderObj }
+
+// Inspect returns a string representation of the object.
+func (sb *StringBuilder) Inspect() string {
+	return fmt.Sprintf("StringBuilder[len=%d]", sb.Builder.Len())
+}
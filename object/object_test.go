@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 // TestStringHashKey verifies the correctness of hash key generation for String objects with identical and different values.
 func TestStringHashKey(t *testing.T) {
@@ -22,3 +25,107 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+// TestHashInsertionOrder verifies that a Hash lists its pairs in insertion order, across updates and deletions.
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash(0)
+	for _, key := range []string{"zebra", "apple", "mango", "kiwi"} {
+		k := &String{Value: key}
+		hash.Set(k.HashKey(), HashPair{Key: k, Value: &Integer{Value: int64(len(key))}})
+	}
+
+	// Replacing a value keeps the key's position.
+	mango := &String{Value: "mango"}
+	hash.Set(mango.HashKey(), HashPair{Key: mango, Value: &Integer{Value: 0}})
+
+	apple := &String{Value: "apple"}
+	if !hash.Delete(apple.HashKey()) {
+		t.Errorf("Delete did not find an existing key")
+	}
+	if hash.Delete(apple.HashKey()) {
+		t.Errorf("Delete found a removed key")
+	}
+
+	expected := "{zebra: 5, mango: 0, kiwi: 4}"
+	for range 10 {
+		if hash.Inspect() != expected {
+			t.Fatalf("wrong hash order. want=%q, got=%q", expected, hash.Inspect())
+		}
+	}
+
+	// Re-adding a deleted key puts it at the end.
+	hash.Set(apple.HashKey(), HashPair{Key: apple, Value: &Integer{Value: 1}})
+	expected = "{zebra: 5, mango: 0, kiwi: 4, apple: 1}"
+	if hash.Inspect() != expected {
+		t.Errorf("wrong hash order. want=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+// TestNewInteger verifies that small integers share one object each, and that other integers are allocated.
+func TestNewInteger(t *testing.T) {
+	for _, value := range []int64{-128, -1, 0, 1, 255} {
+		a, b := NewInteger(value), NewInteger(value)
+		if a != b {
+			t.Errorf("NewInteger(%d) returned different objects", value)
+		}
+		if a.Value != value {
+			t.Errorf("NewInteger(%d) has wrong value. got=%d", value, a.Value)
+		}
+	}
+
+	for _, value := range []int64{-129, 256, math.MaxInt64} {
+		a, b := NewInteger(value), NewInteger(value)
+		if a == b {
+			t.Errorf("NewInteger(%d) returned a shared object", value)
+		}
+		if a.Value != value || b.Value != value {
+			t.Errorf("NewInteger(%d) has wrong value. got=%d, %d", value, a.Value, b.Value)
+		}
+	}
+}
+
+// TestFloatInspect verifies that floats are printed with a decimal point or an exponent.
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{-0.5, "-0.5"},
+		{2.25, "2.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %v. want=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+// TestFunctionInspect verifies that functions and closures are printed as their signatures.
+func TestFunctionInspect(t *testing.T) {
+	named := &CompiledFunction{Name: "add", NumParameters: 2}
+	anonymous := &CompiledFunction{NumParameters: 1}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{named, "fn add(2 params)"},
+		{anonymous, "fn(1 param)"},
+		{&CompiledFunction{}, "fn(0 params)"},
+		{&Closure{Fn: named}, "fn add(2 params)"},
+		{&Closure{Fn: anonymous, Free: []Object{True}}, "fn(1 param) with 1 free variable"},
+		{&Closure{Fn: anonymous, Free: []Object{True, False}}, "fn(1 param) with 2 free variables"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
@@ -12,12 +12,14 @@
 //
 // The main entry point is the [New] function, which creates a new [Parser] instance,
 // and the [Parser.ParseProgram] method, which parses a complete Monkey program and returns
-// an AST.
+// an AST. [Parser.ParseExpression] parses a single expression instead.
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/dr8co/kong/ast"
 	"github.com/dr8co/kong/lexer"
@@ -30,6 +32,9 @@ const (
 	// Lowest represents the lowest possible precedence for parsing expressions in the syntax tree.
 	Lowest
 
+	// Ternary is the precedence for the conditional operator.
+	Ternary // cond ? a : b
+
 	// Equals is the precedence for the equality operator.
 	Equals // ==
 
@@ -52,20 +57,28 @@ const (
 	Index // array[index]
 )
 
+// DefaultMaxDepth is the default maximum nesting depth of expressions and blocks accepted by a [Parser].
+const DefaultMaxDepth = 1000
+
 // precedences maps token types to their respective precedence levels.
 var precedences = map[token.Type]int{
+	token.Question: Ternary,
 	token.Eq:       Equals,
 	token.NotEq:    Equals,
+	token.In:       Equals,
 	token.Lt:       LessGreater,
 	token.Lte:      LessGreater,
 	token.Gt:       LessGreater,
 	token.Gte:      LessGreater,
 	token.Plus:     Sum,
 	token.Minus:    Sum,
+	token.Dec:      Sum,
 	token.Slash:    Product,
 	token.Asterisk: Product,
+	token.Percent:  Product,
 	token.Lparen:   Call,
 	token.Lbracket: Index,
+	token.Dot:      Index,
 }
 
 type (
@@ -83,13 +96,23 @@ type Parser struct {
 
 	prefixParseFns map[token.Type]prefixParseFn
 	infixParseFns  map[token.Type]infixParseFn
+
+	// depth is the current nesting depth of expressions and blocks being parsed.
+	depth int
+
+	// maxDepth is the nesting depth beyond which parsing is abandoned.
+	maxDepth int
+
+	// tooDeep is set once maxDepth has been exceeded, silencing the errors of the unwinding parse.
+	tooDeep bool
 }
 
 // New creates a new [Parser] with the given [lexer.Lexer].
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:        l,
+		errors:   []string{},
+		maxDepth: DefaultMaxDepth,
 	}
 
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
@@ -97,20 +120,26 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.Int, p.parseIntegerLiteral)
 	p.registerPrefix(token.Bang, p.parsePrefixExpression)
 	p.registerPrefix(token.Minus, p.parsePrefixExpression)
+	p.registerPrefix(token.Dec, p.parseDoubleNegation)
 	p.registerPrefix(token.True, p.parseBoolean)
 	p.registerPrefix(token.False, p.parseBoolean)
+	p.registerPrefix(token.Null, p.parseNull)
 	p.registerPrefix(token.Lparen, p.parseGroupedExpression)
 	p.registerPrefix(token.If, p.parseIfExpression)
 	p.registerPrefix(token.Function, p.parseFunctionLiteral)
 	p.registerPrefix(token.String, p.parseStringLiteral)
 	p.registerPrefix(token.Lbracket, p.parseArrayLiteral)
 	p.registerPrefix(token.Lbrace, p.parseHashLiteral)
+	p.registerPrefix(token.At, p.parseAnnotatedFunction)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
 	p.registerInfix(token.Plus, p.parseInfixExpression)
 	p.registerInfix(token.Minus, p.parseInfixExpression)
+	p.registerInfix(token.In, p.parseInfixExpression)
+	p.registerInfix(token.Dec, p.parseNegatedSubtraction)
 	p.registerInfix(token.Slash, p.parseInfixExpression)
 	p.registerInfix(token.Asterisk, p.parseInfixExpression)
+	p.registerInfix(token.Percent, p.parseInfixExpression)
 	p.registerInfix(token.Eq, p.parseInfixExpression)
 	p.registerInfix(token.NotEq, p.parseInfixExpression)
 	p.registerInfix(token.Lt, p.parseInfixExpression)
@@ -119,6 +148,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.Gte, p.parseInfixExpression)
 	p.registerInfix(token.Lparen, p.parseCallExpression)
 	p.registerInfix(token.Lbracket, p.parseIndexExpression)
+	p.registerInfix(token.Dot, p.parseDotExpression)
+	p.registerInfix(token.Question, p.parseTernaryExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -143,12 +174,25 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.currentToken, Value: p.currentTokenIs(token.True)}
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.currentToken}
+}
+
+// SetMaxDepth sets the maximum nesting depth of expressions and blocks.
+// Deeper input is rejected with an error instead of exhausting the stack.
+func (p *Parser) SetMaxDepth(depth int) {
+	p.maxDepth = depth
+}
+
 // Errors return the list of errors encountered during parsing.
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
 func (p *Parser) peekError(t token.Type) {
+	if p.tooDeep {
+		return
+	}
 	msg := fmt.Sprintf("Expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
@@ -184,7 +228,6 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.currentTokenIs(token.EOF) {
-		//nolint:staticcheck
 		if stmt := p.parseStatement(); stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -194,19 +237,215 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
-//nolint:staticcheck
+// ParseExpression parses the input as a single expression, for hosts that evaluate expressions
+// rather than whole programs. The expression may be followed by a semicolon, but by nothing else.
+//
+// The returned error combines all the parsing errors, including one for any trailing tokens.
+func (p *Parser) ParseExpression() (ast.Expression, error) {
+	expr := p.parseExpression(Lowest)
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	if len(p.errors) == 0 && !p.peekTokenIs(token.EOF) {
+		msg := fmt.Sprintf("unexpected %s after expression", p.peekToken.Type)
+		p.errors = append(p.errors, msg)
+	}
+
+	if len(p.errors) != 0 {
+		return nil, errors.New("parser errors:\n\t" + strings.Join(p.errors, "\n\t"))
+	}
+	return expr, nil
+}
+
+// parseStatement parses the statement starting at the current token.
+// It returns a nil interface, never a typed nil, if the statement is malformed.
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
-	case token.Let:
+	case token.Let, token.Const:
 		return p.parseLetStatement()
 	case token.Return:
 		return p.parseReturnStatement()
+	case token.While:
+		return p.parseWhileStatement()
+	case token.For:
+		return p.parseForStatement()
+	case token.Break:
+		return p.parseBreakStatement()
+	case token.Continue:
+		return p.parseContinueStatement()
+	case token.Ident:
+		if p.peekTokenIs(token.Colon) {
+			return p.parseLabeledStatement()
+		}
+		if isAssignment(p.peekToken.Type) {
+			return p.parseAssignStatement()
+		}
+		if p.peekTokenIs(token.Inc) || p.peekTokenIs(token.Dec) {
+			return p.parseIncDecStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+// isAssignment reports whether t is the assignment operator or a compound assignment operator.
+func isAssignment(t token.Type) bool {
+	switch t {
+	case token.Assign, token.PlusAssign, token.MinusAssign, token.AsteriskAssign, token.SlashAssign, token.PercentAssign:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Parser) parseAssignStatement() *ast.AssignStatement {
+	name := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.nextToken()
+
+	stmt := &ast.AssignStatement{Token: p.currentToken, Name: name}
+	p.nextToken()
+	stmt.Value = p.parseExpression(Lowest)
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseIncDecStatement() *ast.IncDecStatement {
+	name := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.nextToken()
+
+	stmt := &ast.IncDecStatement{Token: p.currentToken, Name: name}
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.Lparen) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(Lowest)
+
+	if !p.expectPeek(token.Rparen) {
+		return nil
+	}
+	if !p.expectPeek(token.Lbrace) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+// parseForStatement parses "for (<init>; <condition>; <post>) { <body> }",
+// where each of the three header parts may be left empty.
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.Lparen) {
+		return nil
+	}
+
+	p.nextToken()
+	if !p.currentTokenIs(token.Semicolon) {
+		stmt.Init = p.parseStatement()
+		if !p.currentTokenIs(token.Semicolon) && !p.expectPeek(token.Semicolon) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.currentTokenIs(token.Semicolon) {
+		stmt.Condition = p.parseExpression(Lowest)
+		if !p.expectPeek(token.Semicolon) {
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(token.Rparen) {
+		p.nextToken()
+	} else {
+		p.nextToken()
+		stmt.Post = p.parseStatement()
+		if !p.expectPeek(token.Rparen) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.Lbrace) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+// parseLabeledStatement parses "<label>: <loop>", where the loop is a while or for statement.
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.nextToken()
+	p.nextToken()
+
+	switch p.currentToken.Type {
+	case token.While:
+		stmt := p.parseWhileStatement()
+		if loop, ok := stmt.(*ast.WhileStatement); ok {
+			loop.Label = label
+		}
+		return stmt
+	case token.For:
+		stmt := p.parseForStatement()
+		if loop, ok := stmt.(*ast.ForStatement); ok {
+			loop.Label = label
+		}
+		return stmt
+	default:
+		msg := fmt.Sprintf("label %s must precede a while or for loop, got %s", label.Value, p.currentToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+// parseJumpLabel parses the optional label after "break" or "continue".
+// The label must be on the same line, since the semicolon ending the statement may be left out.
+func (p *Parser) parseJumpLabel() *ast.Identifier {
+	if !p.peekTokenIs(token.Ident) || p.peekToken.Line != p.currentToken.Line {
+		return nil
+	}
+	p.nextToken()
+	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.currentToken}
+	stmt.Label = p.parseJumpLabel()
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.currentToken}
+	stmt.Label = p.parseJumpLabel()
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.currentToken}
 
 	if !p.expectPeek(token.Ident) {
@@ -259,11 +498,30 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// parseExpressionStatement parses an expression used as a statement,
+// or an assignment to an index expression such as "arr[0] = 1".
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.currentToken}
 
 	stmt.Expression = p.parseExpression(Lowest)
 
+	if index, ok := stmt.Expression.(*ast.IndexExpression); ok && isAssignment(p.peekToken.Type) {
+		return p.parseIndexAssignStatement(index)
+	}
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseIndexAssignStatement(index *ast.IndexExpression) *ast.IndexAssignStatement {
+	p.nextToken()
+
+	stmt := &ast.IndexAssignStatement{Token: p.currentToken, Left: index.Left, Index: index.Index}
+	p.nextToken()
+	stmt.Value = p.parseExpression(Lowest)
+
 	if p.peekTokenIs(token.Semicolon) {
 		p.nextToken()
 	}
@@ -271,9 +529,17 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.depth > p.maxDepth {
+		p.nestingTooDeep("expression")
+		return nil
+	}
+
 	prefix := p.prefixParseFns[p.currentToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.currentToken.Type)
+		p.noPrefixParseFnError(p.currentToken)
 		return nil
 	}
 	leftExp := prefix()
@@ -291,6 +557,12 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.currentToken}
+	if isLeadingZeroDecimal(p.currentToken.Literal) {
+		msg := fmt.Sprintf("Could not parse %q as integer: decimal literals cannot have leading zeros, use the 0o prefix for octal",
+			p.currentToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("Could not parse %q as integer", p.currentToken.Literal)
@@ -298,9 +570,32 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 		return nil
 	}
 	lit.Value = value
+	lit.Base = integerBase(p.currentToken.Literal)
 	return lit
 }
 
+// integerBase returns the base of an integer literal, following the prefixes accepted by [strconv.ParseInt].
+func integerBase(literal string) int {
+	if len(literal) < 2 || literal[0] != '0' {
+		return 10
+	}
+	switch literal[1] {
+	case 'x', 'X':
+		return 16
+	case 'b', 'B':
+		return 2
+	default:
+		// "0o17"; "017" is rejected by isLeadingZeroDecimal
+		return 8
+	}
+}
+
+// isLeadingZeroDecimal reports whether literal is a decimal literal with a leading zero, like "0123".
+// [strconv.ParseInt] would read it as octal, which is rarely what was meant, so it is rejected instead.
+func isLeadingZeroDecimal(literal string) bool {
+	return len(literal) > 1 && literal[0] == '0' && '0' <= literal[1] && literal[1] <= '9'
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.currentToken,
@@ -313,8 +608,58 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
-func (p *Parser) noPrefixParseFnError(t token.Type) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
+// parseDoubleNegation parses "--x" outside of a decrement statement as "-(-x)",
+// the same as if the two minus signs were separated by a space.
+func (p *Parser) parseDoubleNegation() ast.Expression {
+	first, second := splitDec(p.currentToken)
+	expression := &ast.PrefixExpression{Token: first, Operator: "-"}
+
+	p.currentToken = second
+	expression.Right = p.parseExpression(Prefix)
+	return expression
+}
+
+// parseNegatedSubtraction parses "a--b" outside of a decrement statement as "a - (-b)",
+// the same as if the two minus signs were separated by a space.
+func (p *Parser) parseNegatedSubtraction(left ast.Expression) ast.Expression {
+	first, second := splitDec(p.currentToken)
+	expression := &ast.InfixExpression{Token: first, Operator: "-", Left: left}
+
+	p.currentToken = second
+	expression.Right = p.parseExpression(Sum)
+	return expression
+}
+
+// splitDec splits a "--" token into the two "-" tokens it is made of.
+func splitDec(tok token.Token) (token.Token, token.Token) {
+	first := token.Token{Type: token.Minus, Literal: "-", Line: tok.Line, Column: tok.Column, Length: 1}
+	second := first
+	if second.Line > 0 {
+		second.Column++
+	}
+	return first, second
+}
+
+// nestingTooDeep records the nesting error for the kind of construct that is too deep, and skips the rest
+// of the input, so that the enclosing parse functions unwind without further recursion.
+func (p *Parser) nestingTooDeep(kind string) {
+	p.errors = append(p.errors, kind+" too deeply nested")
+	p.tooDeep = true
+
+	for !p.currentTokenIs(token.EOF) {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) noPrefixParseFnError(t token.Token) {
+	if p.tooDeep {
+		return
+	}
+	msg := fmt.Sprintf("no prefix parse function for %s found", t.Type)
+	if t.Type == token.Illegal {
+		// The lexer describes what is wrong with the input in the literal of an illegal token.
+		msg = "illegal token: " + t.Literal
+	}
 	p.errors = append(p.errors, msg)
 }
 
@@ -332,16 +677,92 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseTernaryExpression parses a conditional expression "condition ? consequence : alternative".
+// The operator is right-associative, so "a ? b : c ? d : e" is "a ? b : (c ? d : e)".
+func (p *Parser) parseTernaryExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.TernaryExpression{Token: p.currentToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(Lowest)
+
+	if !p.expectPeek(token.Colon) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(Ternary - 1)
+
+	return expression
+}
+
+// parseGroupedExpression parses a parenthesized expression, or an arrow function "(a, b) => a + b".
+// A parenthesized identifier or list of identifiers is the parameter list of an arrow function
+// if the closing parenthesis is followed by "=>".
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.currentToken
+
+	if p.peekTokenIs(token.Rparen) {
+		p.nextToken()
+		if !p.expectPeek(token.Arrow) {
+			return nil
+		}
+		return p.parseArrowFunction(lparen, nil)
+	}
+
 	p.nextToken()
 	exp := p.parseExpression(Lowest)
 
+	if ident, ok := exp.(*ast.Identifier); ok && p.peekTokenIs(token.Comma) {
+		parameters := []*ast.Identifier{ident}
+		for p.peekTokenIs(token.Comma) {
+			p.nextToken()
+			if !p.expectPeek(token.Ident) {
+				return nil
+			}
+			parameters = append(parameters, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+		}
+		if !p.expectPeek(token.Rparen) || !p.expectPeek(token.Arrow) {
+			return nil
+		}
+		return p.parseArrowFunction(lparen, parameters)
+	}
+
 	if !p.expectPeek(token.Rparen) {
 		return nil
 	}
+
+	if ident, ok := exp.(*ast.Identifier); ok && p.peekTokenIs(token.Arrow) {
+		p.nextToken()
+		return p.parseArrowFunction(lparen, []*ast.Identifier{ident})
+	}
+	if infix, ok := exp.(*ast.InfixExpression); ok {
+		infix.Parenthesized = true
+	}
 	return exp
 }
 
+// parseArrowFunction parses the body of an arrow function, after its "=>", into a function literal
+// with the given parameters. A body that starts with "{" is a block, like the body of an "fn" literal;
+// any other body is a single expression, whose value the function returns.
+func (p *Parser) parseArrowFunction(lparen token.Token, parameters []*ast.Identifier) ast.Expression {
+	lit := &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.Function, Literal: "fn", Line: lparen.Line, Column: lparen.Column, Length: lparen.Length},
+		Parameters: parameters,
+	}
+
+	if p.peekTokenIs(token.Lbrace) {
+		p.nextToken()
+		lit.Body = p.parseBlockStatement()
+		return lit
+	}
+
+	lit.Body = &ast.BlockStatement{Token: p.currentToken}
+	p.nextToken()
+	stmt := &ast.ExpressionStatement{Token: p.currentToken, Expression: p.parseExpression(Lowest)}
+	lit.Body.Statements = []ast.Statement{stmt}
+	return lit
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.currentToken}
 
@@ -365,6 +786,15 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.Else) {
 		p.nextToken()
 
+		if p.peekTokenIs(token.If) {
+			p.nextToken()
+			expression.Alternative = p.parseElseIf()
+			if expression.Alternative == nil {
+				return nil
+			}
+			return expression
+		}
+
 		if !p.expectPeek(token.Lbrace) {
 			return nil
 		}
@@ -373,15 +803,41 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseElseIf parses the "if" expression following an "else" into an alternative block
+// holding only that expression. The block takes the "if" token, which marks it as an "else if".
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	tok := p.currentToken
+
+	nested := p.parseIfExpression()
+	if nested == nil {
+		return nil
+	}
+
+	return &ast.BlockStatement{
+		Token:      tok,
+		Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: nested}},
+	}
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currentToken}
 	block.Statements = []ast.Statement{}
 
+	// Loop bodies nest statements without going through parseExpression, so blocks count towards the depth too.
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.depth > p.maxDepth {
+		p.nestingTooDeep("block")
+		return block
+	}
+
 	p.nextToken()
 
 	for !p.currentTokenIs(token.Rbrace) && !p.currentTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		block.Statements = append(block.Statements, stmt)
+		if stmt := p.parseStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
 		p.nextToken()
 	}
 	return block
@@ -404,6 +860,33 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// parseAnnotatedFunction parses one or more annotations (e.g. "@memoize")
+// and attaches them to the function literal that follows.
+func (p *Parser) parseAnnotatedFunction() ast.Expression {
+	var annotations []string
+
+	for p.currentTokenIs(token.At) {
+		if !p.expectPeek(token.Ident) {
+			return nil
+		}
+		annotations = append(annotations, p.currentToken.Literal)
+		p.nextToken()
+	}
+
+	if !p.currentTokenIs(token.Function) {
+		msg := fmt.Sprintf("annotations must precede a function literal, got %s", p.currentToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	lit.Annotations = annotations
+	return lit
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	var identifiers []*ast.Identifier
 
@@ -470,16 +953,55 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 	return list
 }
 
+// parseDotExpression parses a method call "receiver.method(arguments)",
+// or a field access "left.name", which is the same as the index expression left["name"].
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	dot := p.currentToken
+	if !p.expectPeek(token.Ident) {
+		return nil
+	}
+	name := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekTokenIs(token.Lparen) {
+		p.nextToken()
+		exp := &ast.MethodCallExpression{Token: dot, Receiver: left, Method: name}
+		exp.Arguments = p.parseExpressionList(token.Rparen)
+		return exp
+	}
+
+	key := &ast.StringLiteral{Token: name.Token, Value: name.Value}
+	return &ast.IndexExpression{Token: dot, Left: left, Index: key}
+}
+
+// parseIndexExpression parses an index expression "left[index]",
+// or a slice expression "left[low:high]" with optional bounds.
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
+	tok := p.currentToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.Colon) {
+		p.nextToken()
+		index = p.parseExpression(Lowest)
+	}
 
+	if !p.peekTokenIs(token.Colon) {
+		if !p.expectPeek(token.Rbracket) {
+			return nil
+		}
+		return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+	}
 	p.nextToken()
-	exp.Index = p.parseExpression(Lowest)
+
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: index}
+	if !p.peekTokenIs(token.Rbracket) {
+		p.nextToken()
+		slice.High = p.parseExpression(Lowest)
+	}
 
 	if !p.expectPeek(token.Rbracket) {
 		return nil
 	}
-	return exp
+	return slice
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -497,6 +1019,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(Lowest)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peekTokenIs(token.Rbrace) && !p.expectPeek(token.Comma) {
 			return nil
 		}
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/dr8co/kong/ast"
@@ -42,6 +44,37 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatement(t *testing.T) {
+	input := "const x = 5;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("statement not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false for %q", input)
+	}
+	if stmt.Name.Value != "x" {
+		t.Errorf("stmt.Name.Value got %s, want x", stmt.Name.Value)
+	}
+	if !testLiteralExpression(t, stmt.Value, 5) {
+		return
+	}
+	if stmt.String() != input {
+		t.Errorf("stmt.String() got %q, want %q", stmt.String(), input)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -180,6 +213,61 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBase(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue int64
+		expectedBase  int
+	}{
+		{"255", 255, 10},
+		{"0", 0, 10},
+		{"0xff", 255, 16},
+		{"0XFF", 255, 16},
+		{"0b101", 5, 2},
+		{"0o17", 15, 8},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expectedValue {
+			t.Errorf("literal.Value of %q not %d. got=%d", tt.input, tt.expectedValue, literal.Value)
+		}
+		if literal.Base != tt.expectedBase {
+			t.Errorf("literal.Base of %q not %d. got=%d", tt.input, tt.expectedBase, literal.Base)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"0xfg", `Could not parse "0xfg" as integer`},
+		{"0123", `Could not parse "0123" as integer: decimal literals cannot have leading zeros, use the 0o prefix for octal`},
+		{"00", `Could not parse "00" as integer: decimal literals cannot have leading zeros, use the 0o prefix for octal`},
+		{"09", `Could not parse "09" as integer: decimal literals cannot have leading zeros, use the 0o prefix for octal`},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) != 1 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%q", tt.input, p.Errors())
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -255,6 +343,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"foobar in barfoo;", "foobar", "in", "barfoo"},
 	}
 
 	for _, tt := range infixTests {
@@ -290,6 +379,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a + 1 in b",
+			"((a + 1) in b)",
+		},
+		{
+			"a in b == c in d",
+			"(((a in b) == c) in d)",
+		},
+		{
+			"a < b in c",
+			"((a < b) in c)",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -310,6 +411,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b / c",
 			"((a * b) / c)",
 		},
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
 		{
 			"a + b / c",
 			"(a + (b / c))",
@@ -390,6 +499,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a.b * c.d(1) + -e.f",
+			"(((a[b]) * c.d(1)) + (-(e[f])))",
+		},
+		{
+			"a.b.c(x.y)[0]",
+			"((a[b]).c((x[y]))[0])",
+		},
+		{
+			"a > b ? 1 : 2",
+			"((a > b) ? 1 : 2)",
+		},
+		{
+			"a ? b + 1 : c * 2",
+			"(a ? (b + 1) : (c * 2))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"(a ? b : c) + 1",
+			"((a ? b : c) + 1)",
+		},
+		{
+			"f(a == b ? x : y, z)[a ? 0 : 1]",
+			"(f(((a == b) ? x : y), z)[(a ? 0 : 1)])",
+		},
 	}
 
 	for _, tt := range tests {
@@ -405,6 +546,32 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+// TestParenthesizedInfixExpressions verifies that infix expressions written in parentheses are marked as such.
+func TestParenthesizedInfixExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		parenthesized []bool // of the expression, then of its left operand
+	}{
+		{"a < b < c", []bool{false, false}},
+		{"(a < b) < c", []bool{false, true}},
+		{"((a < b)) < c", []bool{false, true}},
+		{"(a + b < c)", []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+		left := exp.Left.(*ast.InfixExpression)
+		if exp.Parenthesized != tt.parenthesized[0] || left.Parenthesized != tt.parenthesized[1] {
+			t.Errorf("%q: wrong Parenthesized. want=%v, got=[%t %t]",
+				tt.input, tt.parenthesized, exp.Parenthesized, left.Parenthesized)
+		}
+	}
+}
+
 func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	integer, ok := il.(*ast.IntegerLiteral)
 	if !ok {
@@ -528,6 +695,31 @@ func TestBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestNullLiteral(t *testing.T) {
+	l := lexer.New("let x = null;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if _, ok := stmt.Value.(*ast.NullLiteral); !ok {
+		t.Fatalf("stmt.Value not *ast.NullLiteral. got=%T", stmt.Value)
+	}
+	if program.String() != "let x = null;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
 func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 	bo, ok := exp.(*ast.Boolean)
 	if !ok {
@@ -655,6 +847,68 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		elseIfs  int
+	}{
+		{"if (x < 1) { 1 } else if (x < 2) { 2 }", "if(x < 1) 1else if(x < 2) 2", 1},
+		{"if (x < 1) { 1 } else if (x < 2) { 2 } else { 3 }", "if(x < 1) 1else if(x < 2) 2else 3", 1},
+		{
+			"if (x < 1) { 1 } else if (x < 2) { 2 } else if (x < 3) { 3 } else { 4 }",
+			"if(x < 1) 1else if(x < 2) 2else if(x < 3) 3else 4",
+			2,
+		},
+		// A nested if in an else block is not an else if.
+		{"if (x < 1) { 1 } else { if (x < 2) { 2 } }", "if(x < 1) 1else if(x < 2) 2", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+		}
+
+		elseIfs := 0
+		for nested := exp.ElseIf(); nested != nil; nested = nested.ElseIf() {
+			elseIfs++
+			exp = nested
+		}
+		if elseIfs != tt.elseIfs {
+			t.Errorf("%q: wrong number of else ifs. want=%d, got=%d", tt.input, tt.elseIfs, elseIfs)
+		}
+	}
+}
+
+func TestElseIfExpressionErrors(t *testing.T) {
+	l := lexer.New("if (a) { 1 } else if b { 2 }")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	expected := "Expected next token to be (, got Ident instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error message. want %q, got=%q", expected, errors[0])
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -732,6 +986,108 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestArrowFunctions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expected       string
+	}{
+		{"(x) => x", []string{"x"}, "fn(x)x"},
+		{"() => 5", []string{}, "fn()5"},
+		{"(a, b) => a + b", []string{"a", "b"}, "fn(a, b)(a + b)"},
+		{"(a, b) => { let c = a; c * b }", []string{"a", "b"}, "fn(a, b)let c = a;(c * b)"},
+		{"(x) => (y) => x + y", []string{"x"}, "fn(x)fn(y)(x + y)"},
+		{"(x) => x > 0 ? x : -x", []string{"x"}, "fn(x)((x > 0) ? x : (-x))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement for %q. got=%d", tt.input, len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral for %q. got=%T", tt.input, stmt.Expression)
+		}
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong for %q. want %d, got=%d", tt.input,
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+		if function.String() != tt.expected {
+			t.Errorf("function.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, function.String())
+		}
+	}
+
+	// Parenthesized expressions are unaffected.
+	l := lexer.New("(x); (x + 1) * 2")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if program.String() != "x((x + 1) * 2)" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestArrowFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"()", "Expected next token to be =>, got EOF instead"},
+		{"(a, b)", "Expected next token to be =>, got EOF instead"},
+		{"(a, 1) => a", "Expected next token to be Ident, got Int instead"},
+		{"(x + 1) => x", "no prefix parse function for => found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong first error for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors()[0])
+		}
+	}
+}
+
+// TestIllegalTokenErrors verifies that the error for an illegal token gives the lexer's description of it.
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "\xZZ";`, `illegal token: invalid escape sequence \xZ: want 2 hex digits`},
+		{`puts("no end`, "illegal token: unterminated string"},
+		{"1 + $", "illegal token: $"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong first error for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors()[0])
+		}
+	}
+}
+
 func TestFunctionLiteralWithName(t *testing.T) {
 	input := `let myFunction = fn() { };`
 
@@ -757,6 +1113,64 @@ func TestFunctionLiteralWithName(t *testing.T) {
 	}
 }
 
+func TestAnnotatedFunctionLiteral(t *testing.T) {
+	tests := []struct {
+		input               string
+		expectedAnnotations []string
+		expectedName        string
+	}{
+		{"let fib = @memoize fn(n) { n };", []string{"memoize"}, "fib"},
+		{"@first @second fn() { 1 };", []string{"first", "second"}, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var value ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			value = stmt.Value
+		case *ast.ExpressionStatement:
+			value = stmt.Expression
+		}
+
+		function, ok := value.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("value is not ast.FunctionLiteral. got=%T", value)
+		}
+		if function.Name != tt.expectedName {
+			t.Errorf("function literal name wrong. want %q, got=%q", tt.expectedName, function.Name)
+		}
+		if len(function.Annotations) != len(tt.expectedAnnotations) {
+			t.Fatalf("wrong number of annotations. want %d, got=%d",
+				len(tt.expectedAnnotations), len(function.Annotations))
+		}
+		for i, a := range tt.expectedAnnotations {
+			if function.Annotations[i] != a {
+				t.Errorf("annotation %d wrong. want %q, got=%q", i, a, function.Annotations[i])
+			}
+		}
+	}
+}
+
+func TestAnnotationWithoutFunction(t *testing.T) {
+	l := lexer.New("@memoize 5;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	expected := "annotations must precede a function literal, got Int"
+	if errors[0] != expected {
+		t.Errorf("wrong error message. want %q, got=%q", expected, errors[0])
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -942,39 +1356,187 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
-func TestParsingHashLiteralsStringKeys(t *testing.T) {
-	input := `{"one": 1, "two": 2, "three": 3}`
+func TestParsingMethodCallExpression(t *testing.T) {
+	input := "rect.scale(2, factor)"
 
 	l := lexer.New(input)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
 	}
-
-	if len(hash.Pairs) != 3 {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	exp, ok := stmt.Expression.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MethodCallExpression. got=%T", stmt.Expression)
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	if !testIdentifier(t, exp.Receiver, "rect") {
+		return
+	}
+	if !testIdentifier(t, exp.Method, "scale") {
+		return
 	}
+	if len(exp.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 2)
+	testIdentifier(t, exp.Arguments[1], "factor")
+}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
-		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
-		}
+func TestParsingFieldAccess(t *testing.T) {
+	input := "rect.width"
 
-		expectedValue := expected[literal.String()]
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "rect") {
+		return
+	}
+	key, ok := indexExp.Index.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("indexExp.Index is not ast.StringLiteral. got=%T", indexExp.Index)
+	}
+	if key.Value != "width" {
+		t.Errorf("key.Value not %q. got=%q", "width", key.Value)
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		low      interface{}
+		high     interface{}
+		expected string
+	}{
+		{"myArray[1:3]", 1, 3, "(myArray[1:3])"},
+		{"myArray[:2]", nil, 2, "(myArray[:2])"},
+		{"myArray[2:]", 2, nil, "(myArray[2:])"},
+		{"myArray[:]", nil, nil, "(myArray[:])"},
+		{"myArray[a:b]", "a", "b", "(myArray[a:b])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "myArray") {
+			return
+		}
+		for _, bound := range []struct {
+			name     string
+			expected interface{}
+			actual   ast.Expression
+		}{{"Low", tt.low, sliceExp.Low}, {"High", tt.high, sliceExp.High}} {
+			if bound.expected == nil {
+				if bound.actual != nil {
+					t.Errorf("sliceExp.%s is not nil. got=%s", bound.name, bound.actual)
+				}
+				continue
+			}
+			if !testLiteralExpression(t, bound.actual, bound.expected) {
+				return
+			}
+		}
+
+		if sliceExp.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, sliceExp.String())
+		}
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+		}
+
+		expectedValue := expected[literal.String()]
 		testIntegerLiteral(t, value, expectedValue)
 	}
+
+	var keys []string
+	for _, key := range hash.Keys {
+		keys = append(keys, key.String())
+	}
+	if !reflect.DeepEqual(keys, []string{"one", "two", "three"}) {
+		t.Errorf("hash.Keys not in source order. got=%q", keys)
+	}
+	if hash.String() != "{one:1, two:2, three:3}" {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
+}
+
+// TestParsingHashLiteralDuplicateKeys verifies that the parser keeps every pair of a hash literal
+// with a repeated key, leaving the duplicate for the compiler to report.
+func TestParsingHashLiteralDuplicateKeys(t *testing.T) {
+	p := New(lexer.New(`{1: "a", 1: "b"}`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 2 || len(hash.Keys) != 2 {
+		t.Fatalf("expected 2 pairs, got %d pairs and %d keys", len(hash.Pairs), len(hash.Keys))
+	}
+	testStringLiteral := func(exp ast.Expression, value string) {
+		if str, ok := exp.(*ast.StringLiteral); !ok || str.Value != value {
+			t.Errorf("expected string literal %q, got=%s", value, exp)
+		}
+	}
+	testStringLiteral(hash.Pairs[hash.Keys[0]], "a")
+	testStringLiteral(hash.Pairs[hash.Keys[1]], "b")
 }
 
 func TestParsingEmptyHashLiteral(t *testing.T) {
@@ -1113,3 +1675,513 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+// TestDeeplyNestedExpressions verifies that expressions and blocks nested beyond the maximum depth
+// are rejected with a single error instead of exhausting the stack.
+func TestDeeplyNestedExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected string
+	}{
+		{strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100), DefaultMaxDepth, ""},
+		{strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000), DefaultMaxDepth, "expression too deeply nested"},
+		{strings.Repeat("-", 100000) + "1", DefaultMaxDepth, "expression too deeply nested"},
+		{strings.Repeat("[", 100000), DefaultMaxDepth, "expression too deeply nested"},
+		// The condition of the innermost loop is one level deeper than the blocks around it.
+		{strings.Repeat("while (false) {", 100000), DefaultMaxDepth, "expression too deeply nested"},
+		{strings.Repeat("for (;;) {", 100000), DefaultMaxDepth, "block too deeply nested"},
+		{strings.Repeat("{", 100000), DefaultMaxDepth, "expression too deeply nested"},
+		{strings.Repeat("while (false) {", 100) + strings.Repeat("}", 100), DefaultMaxDepth, ""},
+		// The function, its body, the if expression, its block, the array and its element, and two groups.
+		{"fn() { if (true) { [((1))] } }", 8, ""},
+		{"fn() { if (true) { [((1))] } }", 7, "expression too deeply nested"},
+		{"while (true) { while (true) { 1 } }", 2, "expression too deeply nested"},
+		{"for (;;) { for (;;) { } }", 1, "block too deeply nested"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.SetMaxDepth(tt.maxDepth)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expected == "" {
+			checkParserErrors(t, p)
+			continue
+		}
+
+		if len(errors) != 1 {
+			t.Fatalf("expected exactly 1 error, got=%d: %q", len(errors), errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignStatement(t *testing.T) {
+	l := lexer.New(`x = x + 1;`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.AssignStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "x" {
+		t.Errorf("stmt.Name.Value not 'x'. got=%q", stmt.Name.Value)
+	}
+	if !testInfixExpression(t, stmt.Value, "x", "+", 1) {
+		return
+	}
+}
+
+func TestCompoundAssignStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		expected string
+	}{
+		{"x += 1;", "+=", "x += 1;"},
+		{"x -= y * 2", "-=", "x -= (y * 2);"},
+		{"x *= 3;", "*=", "x *= 3;"},
+		{"x /= 4;", "/=", "x /= 4;"},
+		{"x %= 2;", "%=", "x %= 2;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.AssignStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Token.Literal != tt.operator {
+			t.Errorf("stmt.Token.Literal not %q. got=%q", tt.operator, stmt.Token.Literal)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestIncDecStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		expected string
+	}{
+		{"i++;", "++", "i++;"},
+		{"i--", "--", "i--;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.IncDecStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.IncDecStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Token.Literal != tt.operator {
+			t.Errorf("stmt.Token.Literal not %q. got=%q", tt.operator, stmt.Token.Literal)
+		}
+		if stmt.Name.Value != "i" {
+			t.Errorf("stmt.Name.Value not 'i'. got=%q", stmt.Name.Value)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+// TestDoubleMinus verifies that "--" outside of a decrement statement still means two minus signs.
+func TestDoubleMinus(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"--5", "(-(-5))"},
+		{"let y = a--b * c;", "let y = (a - ((-b) * c));"},
+		{"for (let i = 9; i > 0; i--) { --i }", "for (let i = 9; (i > 0); i--) (-(-i))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestIndexAssignStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		expected string
+	}{
+		{"arr[1] = 5;", "=", "arr[1] = 5;"},
+		{"counts[word] += 1", "+=", "counts[word] += 1;"},
+		{"grid[i][j + 1] *= 2;", "*=", "(grid[i])[(j + 1)] *= 2;"},
+		{"f()[0] = x", "=", "f()[0] = x;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.IndexAssignStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.IndexAssignStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Token.Literal != tt.operator {
+			t.Errorf("stmt.Token.Literal not %q. got=%q", tt.operator, stmt.Token.Literal)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	l := lexer.New(`while (x < 10) { x = x + 1; break; continue; }`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body does not contain 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[0].(*ast.AssignStatement); !ok {
+		t.Errorf("body.Statements[0] is not ast.AssignStatement. got=%T", stmt.Body.Statements[0])
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"for (let i = 0; i < 10; i = i + 1) { puts(i); }",
+			"for (let i = 0; (i < 10); i = (i + 1)) puts(i)",
+		},
+		{
+			"for (i = 0; i < 10; i = i + 1) { }",
+			"for (i = 0; (i < 10); i = (i + 1)) ",
+		},
+		{
+			"for (; i < 10;) { i = i + 1 }",
+			"for (; (i < 10); ) i = (i + 1);",
+		},
+		{
+			"for (;;) { break }",
+			"for (; ; ) break;",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong for statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"outer: while (x) { while (y) { break outer; } }",
+			"outer: whilex whiley break outer;",
+		},
+		{
+			"loop: for (;;) { continue loop }",
+			"loop: for (; ; ) continue loop;",
+		},
+		{
+			// A label must be on the same line as its break or continue.
+			"while (x) { break\nx }",
+			"whilex break;x",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong labeled loop. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("outer: x"))
+	p.ParseProgram()
+	expected := "label outer must precede a while or for loop, got Ident"
+	if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+		t.Errorf("wrong parser errors. want first %q, got=%q", expected, p.Errors())
+	}
+}
+
+func TestParsingTernaryExpression(t *testing.T) {
+	input := "x < y ? x : y"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.TernaryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TernaryExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if !testIdentifier(t, exp.Consequence, "x") {
+		return
+	}
+	testIdentifier(t, exp.Alternative, "y")
+}
+
+func TestTernaryExpressionMissingColon(t *testing.T) {
+	l := lexer.New("a ? b")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	expected := "Expected next token to be :, got EOF instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error message. want %q, got=%q", expected, errors[0])
+	}
+}
+
+// TestParseExpression verifies that ParseExpression parses a single expression and rejects anything after it.
+func TestParseExpression(t *testing.T) {
+	for _, input := range []string{"a + b * c", "a + b * c;"} {
+		p := New(lexer.New(input))
+		exp, err := p.ParseExpression()
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", input, err)
+		}
+		if exp.String() != "(a + (b * c))" {
+			t.Errorf("%q: wrong expression. want %q, got=%q", input, "(a + (b * c))", exp.String())
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 3", "unexpected Int after expression"},
+		{"x; y", "unexpected Ident after expression"},
+		{"let x = 1", "no prefix parse function for Let found"},
+		{"(1 + 2", "Expected next token to be ), got EOF instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		exp, err := p.ParseExpression()
+		if err == nil {
+			t.Errorf("%q: expected error, got expression %s", tt.input, exp)
+			continue
+		}
+		if exp != nil {
+			t.Errorf("%q: expected no expression with an error, got %s", tt.input, exp)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong error. want substring %q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestFormatRoundTrip verifies that formatting a parsed program gives source that parses to the same program
+// and formats to itself.
+func TestFormatRoundTrip(t *testing.T) {
+	input := `
+	let compose = fn(f, g) { fn(x) { f(g(x)) } };
+	let data = {"b": [1, 2 * (3 + 4), [5]], "a": {"nested": fn(n) { n - -1 }, 1: null}, false: []};
+	outer: for (let i = 0; i < 3; i++) {
+		while (true) { if (i == 1) { continue outer; } else if (i > 1) { break outer } else { break; } }
+	}
+	let t = x > 0 ? "pos\t\"q\"" : x < 0 ? -x : (a ? b : c)[0];
+	data["b"][0] += data.a.nested(2);
+	let m = data.a.nested(1)[1:] + [1, 2][:1];
+	const add = @memoize fn(a, b) { a + b };
+	let inc = (n) => n + 1;
+	if (x in data) { puts(0x1f) };
+	-1;
+	`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	formatted := ast.Format(program)
+
+	p = New(lexer.New(formatted))
+	reparsed := p.ParseProgram()
+	checkParserErrors(t, p)
+	if !reflect.DeepEqual(nodeShapes(reparsed), nodeShapes(program)) {
+		t.Errorf("formatted source parses to a different program:\n%s", formatted)
+	}
+	if again := ast.Format(reparsed); again != formatted {
+		t.Errorf("formatting is not idempotent.\nfirst =%q\nsecond=%q", formatted, again)
+	}
+	if !strings.Contains(formatted, "outer: for (let i = 0; i < 3; i++) {\n\twhile (true) {\n\t\tif (i == 1) {\n") {
+		t.Errorf("unexpected layout of nested blocks:\n%s", formatted)
+	}
+}
+
+// nodeShapes lists the type of every node under node, in the order [ast.Walk] visits them,
+// along with the operator of operator expressions and the text of leaves.
+func nodeShapes(node ast.Node) []string {
+	var shapes []string
+	ast.Walk(node, func(n ast.Node) bool {
+		shape := fmt.Sprintf("%T", n)
+		switch n := n.(type) {
+		case *ast.InfixExpression:
+			shape += " " + n.Operator
+		case *ast.PrefixExpression:
+			shape += " " + n.Operator
+		default:
+			if len(ast.Children(n)) == 0 {
+				shape += " " + n.String()
+			}
+		}
+		shapes = append(shapes, shape)
+		return true
+	})
+	return shapes
+}
+
+// FuzzParser verifies that the parser returns on any input without panicking,
+// and that a program parsed without errors can be printed.
+func FuzzParser(f *testing.F) {
+	seeds := []string{
+		"",
+		`let add = fn(x, y) { x + y; }; add(1, 2);`,
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };`,
+		`for (let i = 0; i < 10; i++) { if (i == 5) { break; } continue; }`,
+		`{"a": [1, 2][0], true: fn() {}}["a"]`,
+		`(x) => x + 1; a ? b : c; x in [1]; arr[1:2]; const c = null;`,
+		"((((((((((1",
+		"let = ; fn( { [ : } ] )",
+		"------1 a--b",
+		"while (false) { while (false) { for (;;) { while (x) {",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
+
+// TestMalformedStatementsAreDropped verifies that statements that fail to parse are left out of the program
+// and of blocks, rather than kept as nil statements.
+func TestMalformedStatementsAreDropped(t *testing.T) {
+	inputs := []string{
+		"let = 5; let y = 1;",
+		"while x { } let y = 1;",
+		"for x { } let y = 1;",
+		"if (true) { let = 5; let y = 1; }",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+		ast.Walk(program, func(node ast.Node) bool {
+			for _, child := range ast.Children(node) {
+				if child == nil || reflect.ValueOf(child).IsNil() {
+					t.Errorf("%q: %T has a nil child", input, node)
+				}
+			}
+			return true
+		})
+	}
+}
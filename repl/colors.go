@@ -0,0 +1,52 @@
+package repl
+
+import "io"
+
+// Color enables colored output: results, error messages and the prompt are colored with ANSI codes.
+// Even when enabled, output is only colored when it goes to a terminal.
+//
+// The prompt is only dimmed when lines are read without line editing,
+// since the line editor does not accept escape sequences in the prompt.
+var Color = true
+
+// ANSI escape sequences used by [colors].
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+	ansiRed   = "\x1b[31m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// colors wraps text written by the REPL in ANSI codes, or leaves it as is when disabled.
+// The zero value is disabled.
+type colors struct {
+	enabled bool
+}
+
+// newColors returns the colors to use for out: enabled if [Color] is set and out is a terminal.
+func newColors(out io.Writer) colors {
+	return colors{enabled: Color && isTerminal(out)}
+}
+
+// paint wraps s in the escape sequence code and a reset, if c is enabled.
+func (c colors) paint(code, s string) string {
+	if !c.enabled || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// result colors the value printed for an input.
+func (c colors) result(s string) string {
+	return c.paint(ansiCyan, s)
+}
+
+// failure colors an error message.
+func (c colors) failure(s string) string {
+	return c.paint(ansiRed, s)
+}
+
+// prompt dims a prompt.
+func (c colors) prompt(s string) string {
+	return c.paint(ansiDim, s)
+}
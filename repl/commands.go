@@ -0,0 +1,116 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dr8co/kong/compiler"
+)
+
+// commandHelp describes the meta-commands understood by the REPL, in the order :help lists them.
+var commandHelp = []struct {
+	name        string
+	description string
+}{
+	{":help", "Show this list of commands"},
+	{":env", "List the global variables defined in this session"},
+	{":type", "Evaluate an expression and print the type of its value, as in :type [1, 2]"},
+	{":save", "Write the inputs of this session to a file, as in :save session.monkey"},
+	{":load", "Run a Monkey script file in this session, as in :load session.monkey"},
+	{":reset", "Forget all definitions and start a fresh session"},
+}
+
+// runCommand runs a REPL meta-command, a line starting with ':'.
+func (s *session) runCommand(out io.Writer, line string) {
+	fields := strings.Fields(line)
+
+	var err error
+	switch fields[0] {
+	case ":help":
+		err = printHelp(out)
+	case ":env":
+		err = s.printEnv(out)
+	case ":type":
+		err = s.printType(out, strings.TrimSpace(strings.TrimPrefix(line, fields[0])))
+	case ":save", ":load":
+		err = s.runFileCommand(out, fields)
+	case ":reset":
+		s.reset()
+		_, err = fmt.Fprintln(out, "Session reset.")
+	default:
+		_, err = fmt.Fprintln(out, s.colors.failure("unknown command "+fields[0]+" (type :help for a list of commands)"))
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// printHelp prints the available meta-commands.
+func printHelp(out io.Writer) error {
+	for _, cmd := range commandHelp {
+		_, err := fmt.Fprintf(out, "  %-8s %s\n", cmd.name, cmd.description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printType evaluates input in the session and prints the type of the result instead of its value.
+// Errors are reported as for any input.
+func (s *session) printType(out io.Writer, input string) error {
+	if input == "" {
+		_, err := fmt.Fprintln(out, "usage: :type <expression>")
+		return err
+	}
+
+	result := s.run(out, input)
+	if result == nil {
+		return nil
+	}
+	_, err := fmt.Fprintln(out, result.Type())
+	return err
+}
+
+// runFileCommand runs :save or :load with the file named by its argument, and reports the outcome.
+func (s *session) runFileCommand(out io.Writer, fields []string) error {
+	if len(fields) != 2 {
+		_, err := fmt.Fprintf(out, "usage: %s <file>\n", fields[0])
+		return err
+	}
+
+	filename := fields[1]
+	var err error
+	var done string
+	switch fields[0] {
+	case ":save":
+		err = s.save(filename)
+		done = "Saved"
+	case ":load":
+		err = s.load(filename)
+		done = "Loaded"
+	}
+	if err != nil {
+		_, err = fmt.Fprintln(out, s.colors.failure(err.Error()))
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s %s.\n", done, filename)
+	return err
+}
+
+// printEnv prints the global variables of the session with their current values, in definition order.
+func (s *session) printEnv(out io.Writer) error {
+	for _, symbol := range s.symbolTable.Symbols(compiler.GlobalScope) {
+		line := symbol.Name
+		if value := s.globals[symbol.Index]; value != nil {
+			line += " = " + value.Inspect()
+		}
+		_, err := fmt.Fprintln(out, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
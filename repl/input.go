@@ -0,0 +1,129 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/peterh/liner"
+)
+
+// HistoryFile is the name of the file in the user's home directory that keeps REPL history across sessions.
+const HistoryFile = ".kong_history"
+
+// lineReader reads lines of input for the REPL.
+type lineReader interface {
+	// readLine displays the prompt and returns the next line of input.
+	// It returns false when there is no more input.
+	readLine(prompt string) (string, bool)
+
+	// addHistory records a line in the input history.
+	addHistory(line string)
+
+	// close releases the reader and persists its history, if any.
+	close()
+}
+
+// newLineReader returns a line editor with persistent history when both in and out are terminals,
+// and a plain line scanner otherwise (e.g. for piped input), which keeps no history.
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if isTerminal(in) && isTerminal(out) && liner.TerminalSupported() {
+		return newEditorReader()
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out, colors: newColors(out)}
+}
+
+// isTerminal reports whether v is a file connected to a terminal.
+func isTerminal(v any) bool {
+	f, ok := v.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// historyPath returns the path of the history file, or an empty string if the home directory is unknown.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, HistoryFile)
+}
+
+// scannerReader reads lines from a plain [io.Reader].
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	colors  colors
+}
+
+func (r *scannerReader) readLine(prompt string) (string, bool) {
+	_, err := fmt.Fprint(r.out, r.colors.prompt(prompt))
+	if err != nil {
+		panic(err)
+	}
+	if !r.scanner.Scan() {
+		return "", false
+	}
+	return r.scanner.Text(), true
+}
+
+func (r *scannerReader) addHistory(string) {}
+
+func (r *scannerReader) close() {}
+
+// editorReader reads lines from the terminal with line editing, history recall (up/down arrows),
+// and reverse history search (Ctrl-R).
+type editorReader struct {
+	state *liner.State
+	path  string
+}
+
+// newEditorReader creates an editorReader and loads any history saved by previous sessions.
+func newEditorReader() *editorReader {
+	r := &editorReader{state: liner.NewLiner(), path: historyPath()}
+	r.state.SetCtrlCAborts(true)
+
+	if r.path != "" {
+		//nolint:gosec // The history file lives in the user's home directory
+		if f, err := os.Open(r.path); err == nil {
+			_, _ = r.state.ReadHistory(f)
+			_ = f.Close()
+		}
+	}
+	return r
+}
+
+func (r *editorReader) readLine(prompt string) (string, bool) {
+	line, err := r.state.Prompt(prompt)
+	if err != nil {
+		// io.EOF (Ctrl+D) and liner.ErrPromptAborted (Ctrl+C) both end the session.
+		if !errors.Is(err, io.EOF) && !errors.Is(err, liner.ErrPromptAborted) {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		return "", false
+	}
+	return line, true
+}
+
+func (r *editorReader) addHistory(line string) {
+	r.state.AppendHistory(line)
+}
+
+func (r *editorReader) close() {
+	if r.path != "" {
+		if f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600); err == nil {
+			_, _ = r.state.WriteHistory(f)
+			_ = f.Close()
+		}
+	}
+	_ = r.state.Close()
+}
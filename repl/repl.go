@@ -9,7 +9,8 @@
 //
 // The REPL operates in a continuous loop that:
 //
-//  1. Reads a line of input from the user
+//  1. Reads a line of input from the user (with line editing and history in a terminal),
+//     and further lines while the input is incomplete
 //  2. Lexes and parses the input into an abstract syntax tree (AST)
 //  3. Compiles the AST into bytecode instructions
 //  4. Executes the bytecode in the virtual machine
@@ -26,6 +27,14 @@
 //
 // This allows users to define variables and functions in one input and reference them
 // in subsequent inputs, creating a natural interactive programming experience.
+// [StartWithInit] runs a script in the session before the first input, to preload definitions.
+//
+// # Meta-Commands
+//
+// Lines starting with ':' are handled by the REPL itself: ":help" lists the commands,
+// ":env" lists the global variables, ":type" prints the type of an expression's value,
+// ":save" writes the source of the session's inputs to a file, ":load" runs a file in the session
+// and ":reset" discards all state.
 //
 // # Error Handling
 //
@@ -37,105 +46,342 @@
 //
 // When an error occurs, the REPL displays the error message and continues running,
 // allowing users to correct their input and try again without restarting the session.
+//
+// # Colors
+//
+// In a terminal, results are printed in cyan, error messages in red, and the prompt is dimmed.
+// Set [Color] to false to print plain text; output that is not a terminal is never colored.
 package repl
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/dr8co/kong/ast"
 	"github.com/dr8co/kong/compiler"
 	"github.com/dr8co/kong/lexer"
 	"github.com/dr8co/kong/object"
 	"github.com/dr8co/kong/parser"
+	"github.com/dr8co/kong/token"
 	"github.com/dr8co/kong/vm"
 )
 
 // Prompt is the string used to prompt the user for input.
 const Prompt = ">> "
 
+// ContinuationPrompt is the string used to prompt for the next line of an incomplete input.
+const ContinuationPrompt = ".. "
+
+// Indent is added to [ContinuationPrompt] for each brace left open by the input so far.
+const Indent = "    "
+
 // Start starts the REPL and runs the interactive loop.
+//
+// When in and out are terminals, input lines can be edited and recalled from a history
+// that persists across sessions in [HistoryFile]. Otherwise, lines are read as-is.
+// Output of builtins such as `puts` goes to out while the REPL runs.
+// Output to a terminal is colored, unless [Color] is false.
+// An input that calls the `exit` builtin ends the REPL.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	var constants []object.Object
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
+	_ = StartWithInit(in, out, "")
+}
 
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+// StartWithInit is like [Start], but first runs the Monkey script initFile in the session,
+// so that its definitions are available from the first input on. An empty initFile runs nothing.
+//
+// If the script cannot be read, parsed, compiled or run, the error is returned
+// and the interactive loop is not started.
+func StartWithInit(in io.Reader, out io.Writer, initFile string) error {
+	defer object.SetOutput(object.SetOutput(out))
+
+	s := newSession()
+	s.colors = newColors(out)
+	if initFile != "" {
+		if err := s.load(initFile); err != nil {
+			return err
+		}
 	}
 
+	reader := newLineReader(in, out)
+	defer reader.close()
+
 	for {
-		_, err := fmt.Fprint(out, Prompt)
-		if err != nil {
-			panic(err)
-		}
-		scanned := scanner.Scan()
-		if !scanned {
+		input, ok := readInput(reader)
+		if !ok {
 			if out == os.Stdout || out == os.Stderr {
 				_, _ = fmt.Fprintln(out, "\rBye!👋")
 			}
-			return
+			return nil
 		}
 
-		line := scanner.Text()
-		if line == "" {
+		if input == "" {
 			continue
 		}
 
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
-			continue
+		if strings.HasPrefix(input, ":") {
+			s.runCommand(out, input)
+		} else {
+			s.eval(out, input)
+		}
+		if s.exited {
+			return nil
 		}
+	}
+}
+
+// session holds the state that persists across the inputs of a REPL session.
+type session struct {
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err = comp.Compile(program)
+	// source holds the inputs and loaded scripts that ran successfully, in order, for :save.
+	source []string
+
+	// exited is set once an input calls the `exit` builtin, which ends the session.
+	exited bool
+
+	// colors colors results and error messages; it is disabled in sessions created by newSession.
+	colors colors
+}
+
+// newSession creates a session with no user definitions.
+func newSession() *session {
+	s := &session{}
+	s.reset()
+	return s
+}
+
+// reset discards all constants and global definitions, leaving only the builtins defined.
+func (s *session) reset() {
+	s.constants = nil
+	s.source = nil
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	s.symbolTable = compiler.NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		s.symbolTable.DefineBuiltin(i, v.Name)
+	}
+}
+
+// eval compiles and runs a complete input, printing its result or errors to out.
+func (s *session) eval(out io.Writer, input string) {
+	lastPopped := s.run(out, input)
+
+	if lastPopped != nil {
+		_, err := io.WriteString(out, s.colors.result(lastPopped.Inspect())+"\n")
 		if err != nil {
-			_, err2 := fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
-			if err2 != nil {
-				panic(err2)
-			}
-			continue
+			panic(err)
 		}
+	}
+}
 
-		code := comp.Bytecode()
-		constants = code.Constants
+// run compiles and runs a complete input in the session, and returns the last value it popped off the stack.
+// Errors are printed to out, and nil is returned.
+func (s *session) run(out io.Writer, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
 
-		machine := vm.NewWithGlobalsStore(code, globals)
-		err = machine.Run()
-		if err != nil {
-			_, err2 := fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
-			if err2 != nil {
-				panic(err2)
-			}
-			continue
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(out, s.colors, p.Errors())
+		return nil
+	}
+
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	err := comp.Compile(program)
+	if err != nil {
+		_, err2 := fmt.Fprintln(out, s.colors.failure(fmt.Sprintf("Woops! Compilation failed:\n %s", err)))
+		if err2 != nil {
+			panic(err2)
 		}
+		return nil
+	}
 
-		lastPopped := machine.LastPoppedStackItem()
+	code := comp.Bytecode()
+	s.constants = code.Constants
 
-		if lastPopped != nil {
-			_, err = io.WriteString(out, lastPopped.Inspect()+"\n")
-			if err != nil {
-				panic(err)
+	machine := vm.NewWithGlobalsStore(code, s.globals)
+	err = machine.Run()
+	var exit *object.Exit
+	if errors.As(err, &exit) {
+		s.exited = true
+		return nil
+	}
+	if err != nil {
+		_, err2 := fmt.Fprintln(out, s.colors.failure(fmt.Sprintf("Woops! Executing bytecode failed:\n %s", err)))
+		if err2 != nil {
+			panic(err2)
+		}
+		return nil
+	}
+
+	s.record(input, program)
+	return machine.LastPoppedStackItem()
+}
+
+// record adds the source of a program that ran successfully to the session's source.
+// A program ending with an expression statement is ended with a semicolon,
+// so that the source recorded next cannot continue the expression, as in "if (x) { f }" followed by "(1)".
+func (s *session) record(src string, program *ast.Program) {
+	src = strings.TrimSpace(src)
+	if len(program.Statements) == 0 {
+		return
+	}
+
+	_, isExpression := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	if _, _, last := scanInput(src); isExpression && last != token.Semicolon {
+		if lastLine := src[strings.LastIndex(src, "\n")+1:]; strings.Contains(lastLine, "//") {
+			// The semicolon would be part of a comment.
+			src += "\n"
+		}
+		src += ";"
+	}
+	s.source = append(s.source, src)
+}
+
+// save writes the source recorded in the session to filename, one input after another.
+func (s *session) save(filename string) error {
+	var content strings.Builder
+	for _, src := range s.source {
+		content.WriteString(src)
+		content.WriteString("\n")
+	}
+
+	err := os.WriteFile(filepath.Clean(filename), []byte(content.String()), 0o644) //nolint:gosec // A source file is not secret.
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
+
+// load runs the Monkey script in filename in the session without printing its result.
+func (s *session) load(filename string) error {
+	//nolint:gosec // The path is provided by the user on purpose
+	content, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("failed to parse %s:\n\t%s", filename, strings.Join(p.Errors(), "\n\t"))
+	}
+
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	err = comp.Compile(program)
+	if err != nil {
+		return fmt.Errorf("failed to compile %s: %w", filename, err)
+	}
+
+	code := comp.Bytecode()
+	s.constants = code.Constants
+
+	err = vm.NewWithGlobalsStore(code, s.globals).Run()
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", filename, err)
+	}
+
+	s.record(string(content), program)
+	return nil
+}
+
+// readInput reads one complete input, which may span several lines:
+// while the lines read so far are not a complete statement, it keeps reading with [ContinuationPrompt],
+// indented by the depth of the open braces.
+// It returns false when there is no more input.
+func readInput(reader lineReader) (string, bool) {
+	var lines []string
+	prompt := Prompt
+
+	for {
+		line, ok := reader.readLine(prompt)
+		if !ok {
+			// Evaluate what was read so far, so that its errors are reported.
+			return strings.Join(lines, "\n"), len(lines) > 0
+		}
+
+		if len(lines) == 0 && (line == "" || strings.HasPrefix(line, ":")) {
+			if line != "" {
+				reader.addHistory(line)
 			}
+			return line, true
+		}
+		if line != "" {
+			reader.addHistory(line)
+		}
+
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if isComplete(input) {
+			return input, true
+		}
+		prompt = continuationPrompt(input)
+	}
+}
+
+// isComplete reports whether src can be evaluated as is, or needs more lines.
+// Input is incomplete while it has unclosed parentheses, brackets or braces,
+// or when it ends with an operator. Delimiters inside string literals and comments are ignored.
+func isComplete(src string) bool {
+	depth, _, last := scanInput(src)
+	if depth > 0 {
+		return false
+	}
+
+	switch last {
+	case token.Assign, token.Plus, token.Minus, token.Asterisk, token.Slash, token.Percent, token.Bang,
+		token.Lt, token.Lte, token.Gt, token.Gte, token.Eq, token.NotEq,
+		token.PlusAssign, token.MinusAssign, token.AsteriskAssign, token.SlashAssign, token.PercentAssign,
+		token.Comma, token.Colon, token.At, token.Dot, token.Question, token.In, token.Arrow:
+		return false
+	}
+	return true
+}
+
+// continuationPrompt returns the prompt for the line that follows the incomplete input src:
+// [ContinuationPrompt], followed by an [Indent] for each brace that src leaves open.
+func continuationPrompt(src string) string {
+	_, braces, _ := scanInput(src)
+	return ContinuationPrompt + strings.Repeat(Indent, max(braces, 0))
+}
+
+// scanInput lexes src and returns the number of parentheses, brackets and braces it leaves open,
+// the number of those that are braces, and the type of its last token.
+func scanInput(src string) (depth, braces int, last token.Type) {
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.Lbrace:
+			braces++
+			depth++
+		case token.Rbrace:
+			braces--
+			depth--
+		case token.Lparen, token.Lbracket:
+			depth++
+		case token.Rparen, token.Rbracket:
+			depth--
 		}
+		last = tok.Type
 	}
+	return depth, braces, last
 }
 
-// printParseErrors prints a list of parse errors to the given output stream.
-func printParseErrors(out io.Writer, errors []string) {
-	_, err := io.WriteString(out, "parser errors:\n")
+// printParseErrors prints a list of parse errors to the given output stream, in the colors c.
+func printParseErrors(out io.Writer, c colors, errors []string) {
+	_, err := io.WriteString(out, c.failure("parser errors:")+"\n")
 	if err != nil {
 		panic(err)
 	}
 
 	for _, msg := range errors {
-		_, err = io.WriteString(out, "\t"+msg+"\n") // #nosec G705 - false positive.
+		_, err = io.WriteString(out, "\t"+c.failure(msg)+"\n") // #nosec G705 - false positive.
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,383 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStartWithPipedInput tests that piped input is evaluated line by line without keeping history.
+func TestStartWithPipedInput(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = 5;\n\nx * 2\n"), &out)
+
+	expected := Prompt + "5\n" + Prompt + Prompt + "10\n" + Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+
+	_, err := os.Stat(filepath.Join(home, HistoryFile))
+	if !os.IsNotExist(err) {
+		t.Errorf("expected no history file for piped input, got stat error %v", err)
+	}
+}
+
+// TestIsComplete tests the detection of input that continues on the next line.
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", true},
+		{"", true},
+		{"fn(x) {", false},
+		{"fn(x) {\nx + 1 }", true},
+		{"let f = fn(x) {\nif (x > 1) {", false},
+		{"let f = fn(x) {\nif (x > 1) {\nx }\n};", true},
+		{"[1, 2,", false},
+		{"[1, 2,\n3]", true},
+		{"puts(", false},
+		{"let x = 1 +", false},
+		{"let x =", false},
+		{`"{"`, true},
+		{`"(" + `, false},
+		{`let s = "}";`, true},
+		{"{ // }", false},
+		{"}", true},
+		{"while (true) { break; }", true},
+	}
+
+	for _, tt := range tests {
+		if got := isComplete(tt.input); got != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestStartWithMultiLineInput tests that incomplete input is continued on the next lines before being evaluated.
+func TestStartWithMultiLineInput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	Start(strings.NewReader("fn(x) {\nx + 1 }(2)\nlet y = [1,\n\n2];\nlen(y)\nlen(\n"), &out)
+
+	expected := Prompt + ContinuationPrompt + Indent + "3\n" +
+		Prompt + ContinuationPrompt + ContinuationPrompt + "[1, 2]\n" +
+		Prompt + "2\n" +
+		Prompt + ContinuationPrompt +
+		"parser errors:\n\tno prefix parse function for EOF found\n\tExpected next token to be ), got EOF instead\n" + Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// TestContinuationPromptIndent tests that the continuation prompt is indented by the depth of the open braces.
+func TestContinuationPromptIndent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	Start(strings.NewReader("fn(x) {\nif (x > 1) {\n\"}\"\n} else { (\n0) }\n}(2)\n"), &out)
+
+	expected := Prompt +
+		ContinuationPrompt + Indent +
+		ContinuationPrompt + Indent + Indent +
+		ContinuationPrompt + Indent + Indent +
+		ContinuationPrompt + Indent + Indent +
+		ContinuationPrompt + Indent +
+		"}\n" + Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() {", ContinuationPrompt + Indent},
+		{"fn() { {", ContinuationPrompt + Indent + Indent},
+		{"fn() { { }", ContinuationPrompt + Indent},
+		{"[1,", ContinuationPrompt},
+		{"1 +", ContinuationPrompt},
+		{"}}", ContinuationPrompt},
+	}
+	for _, tt := range tests {
+		if got := continuationPrompt(tt.input); got != tt.expected {
+			t.Errorf("continuationPrompt(%q) wrong. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestMetaCommands tests the REPL meta-commands and that unknown ones do not end the session.
+func TestMetaCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	input := strings.Join([]string{
+		":env",
+		"let x = 5;",
+		"let greet = \"hi\";",
+		"let x = 6;",
+		":env",
+		":nope",
+		":reset",
+		":env",
+		"x",
+		"let y = 1;",
+		":env",
+	}, "\n")
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := Prompt +
+		Prompt + "5\n" +
+		Prompt + "hi\n" +
+		Prompt + "6\n" +
+		Prompt + "greet = hi\nx = 6\n" +
+		Prompt + "unknown command :nope (type :help for a list of commands)\n" +
+		Prompt + "Session reset.\n" +
+		Prompt +
+		Prompt + "Woops! Compilation failed:\n undefined variable x\n" +
+		Prompt + "1\n" +
+		Prompt + "y = 1\n" +
+		Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestTypeCommand tests that :type prints the type of an expression's value, and reports errors like other inputs.
+func TestTypeCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	input := strings.Join([]string{
+		":type [1,2]",
+		":type 1 + 2",
+		`:type "a" + "b"`,
+		"let f = fn(x) { x };",
+		":type f",
+		":type f(null)",
+		":type {}",
+		":type len",
+		":type",
+		":type 1 +",
+		":type missing",
+		":type 1 / 0",
+	}, "\n")
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := Prompt + "ARRAY\n" +
+		Prompt + "INTEGER\n" +
+		Prompt + "STRING\n" +
+		Prompt + "fn f(1 param)\n" +
+		Prompt + "CLOSURE\n" +
+		Prompt + "NULL\n" +
+		Prompt + "HASH\n" +
+		Prompt + "BUILTIN\n" +
+		Prompt + "usage: :type <expression>\n" +
+		Prompt + "parser errors:\n\tno prefix parse function for EOF found\n" +
+		Prompt + "Woops! Compilation failed:\n undefined variable missing\n" +
+		Prompt + "Woops! Executing bytecode failed:\n division by zero\n" +
+		Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestSaveAndLoadCommands tests that :save writes the inputs that ran successfully,
+// and that :load runs the saved file in a fresh session.
+func TestSaveAndLoadCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	file := filepath.Join(t.TempDir(), "session.monkey")
+
+	input := strings.Join([]string{
+		"let square = fn(x) {",
+		"x * x };",
+		"let n = square(3)",
+		"missing",
+		"if (n > 5) { puts(\"big\") }",
+		"let m = n + 1; // one more",
+		"m // ten",
+		":save " + file,
+	}, "\n")
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if !strings.HasSuffix(out.String(), "Saved "+file+".\n"+Prompt) {
+		t.Fatalf("wrong output of :save. got=%q", out.String())
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let square = fn(x) {\nx * x };\n" +
+		"let n = square(3)\n" +
+		"if (n > 5) { puts(\"big\") };\n" +
+		"let m = n + 1; // one more\n" +
+		"m // ten\n;\n"
+	if string(content) != expected {
+		t.Errorf("wrong saved source.\nwant=%q\ngot= %q", expected, string(content))
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":load "+file+"\n[m, square(m)]\n:load\n:load "+file+".missing\n"), &out)
+	expectedOutput := Prompt + "big \nLoaded " + file + ".\n" +
+		Prompt + "[10, 100]\n" +
+		Prompt + "usage: :load <file>\n" +
+		Prompt + "failed to read " + file + ".missing: open " + file + ".missing: no such file or directory\n" +
+		Prompt
+	if out.String() != expectedOutput {
+		t.Errorf("wrong output of :load.\nwant=%q\ngot= %q", expectedOutput, out.String())
+	}
+}
+
+// TestExitEndsSession tests that calling exit ends the REPL, without reading further input.
+func TestExitEndsSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	Start(strings.NewReader("1\nexit(2)\nputs(\"unreachable\")\n"), &out)
+
+	expected := Prompt + "1\n" + Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// TestHelpCommand tests that :help lists every meta-command.
+func TestHelpCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	Start(strings.NewReader(":help\n"), &out)
+
+	for _, cmd := range commandHelp {
+		if !strings.Contains(out.String(), cmd.name) {
+			t.Errorf(":help output does not mention %s. got=%q", cmd.name, out.String())
+		}
+	}
+}
+
+// TestBuiltinOutput tests that the output of builtins goes to the REPL's writer.
+func TestBuiltinOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	Start(strings.NewReader("puts(\"hello\", 1)\nprint(\"no newline\")\n"), &out)
+
+	expected := Prompt + "hello 1 \nnull\n" + Prompt + "no newlinenull\n" + Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// TestStartWithInit tests that the definitions of an init file are usable from the first input.
+func TestStartWithInit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	initFile := filepath.Join(t.TempDir(), "init.monkey")
+	err := os.WriteFile(initFile, []byte("let square = fn(x) { x * x };\nputs(\"loaded\");\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = StartWithInit(strings.NewReader("square(4)\n"), &out, initFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := "loaded \n" + Prompt + "16\n" + Prompt
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// TestStartWithInitErrors tests that a broken init file is reported without starting the REPL.
+func TestStartWithInitErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"let x = ;", "failed to parse"},
+		{"y;", "failed to compile"},
+		{"1 + true;", "failed to run"},
+	}
+
+	for _, tt := range tests {
+		initFile := filepath.Join(dir, "init.monkey")
+		err := os.WriteFile(initFile, []byte(tt.content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		err = StartWithInit(strings.NewReader("1\n"), &out, initFile)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error starting with %q, got %v", tt.content, tt.expected, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%q: expected no output, got %q", tt.content, out.String())
+		}
+	}
+
+	err := StartWithInit(strings.NewReader("1\n"), &bytes.Buffer{}, filepath.Join(dir, "missing.monkey"))
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to read") {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+// TestNoColorWhenNotTerminal tests that no ANSI codes are written when the output is not a terminal,
+// even with colors enabled, for results, errors and prompts alike.
+func TestNoColorWhenNotTerminal(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	Start(strings.NewReader("1 + 2\nlet\nundefined\n[1][\"a\"]\n:nope\n"), &out)
+
+	if !strings.Contains(out.String(), "3\n") {
+		t.Fatalf("expected the result to be printed, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("expected no ANSI codes in output, got %q", out.String())
+	}
+}
+
+// TestColors tests the colors used for results, errors and prompts, and that disabled colors leave text as is.
+func TestColors(t *testing.T) {
+	c := colors{enabled: true}
+	tests := []struct {
+		got, want string
+	}{
+		{c.result("3"), "\x1b[36m3\x1b[0m"},
+		{c.failure("oops"), "\x1b[31moops\x1b[0m"},
+		{c.prompt(Prompt), "\x1b[2m" + Prompt + "\x1b[0m"},
+		{c.result(""), ""},
+		{colors{}.result("3"), "3"},
+		{colors{}.failure("oops"), "oops"},
+		{colors{}.prompt(Prompt), Prompt},
+	}
+
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("tests[%d] - wrong text. want=%q, got=%q", i, tt.want, tt.got)
+		}
+	}
+
+	Color = false
+	t.Cleanup(func() { Color = true })
+	if newColors(os.Stdout).enabled {
+		t.Errorf("expected colors to be disabled when Color is false")
+	}
+}
@@ -25,6 +25,16 @@ type Token struct {
 
 	// Literal specifies the exact string value of the token as it appears in the source code.
 	Literal string
+
+	// Line is the line of the token's first byte in the source code, starting at 1.
+	// It is zero for tokens that were not produced by a lexer.
+	Line int
+
+	// Column is the column of the token's first byte within its line, starting at 1.
+	Column int
+
+	// Length is the number of bytes the token spans in the source code.
+	Length int
 }
 
 const (
@@ -67,6 +77,9 @@ const (
 	// Slash represents the division operator "/".
 	Slash = "/"
 
+	// Percent represents the modulo operator "%".
+	Percent = "%"
+
 	// Lt represents the less-than comparison operator "<".
 	Lt = "<"
 
@@ -85,6 +98,27 @@ const (
 	// NotEq represents the inequality comparison operator "!=".
 	NotEq = "!="
 
+	// PlusAssign represents the compound addition assignment operator "+=".
+	PlusAssign = "+="
+
+	// MinusAssign represents the compound subtraction assignment operator "-=".
+	MinusAssign = "-="
+
+	// AsteriskAssign represents the compound multiplication assignment operator "*=".
+	AsteriskAssign = "*="
+
+	// SlashAssign represents the compound division assignment operator "/=".
+	SlashAssign = "/="
+
+	// PercentAssign represents the compound remainder assignment operator "%=".
+	PercentAssign = "%="
+
+	// Inc represents the increment operator "++".
+	Inc = "++"
+
+	// Dec represents the decrement operator "--".
+	Dec = "--"
+
 	// Delimiters
 
 	// Comma represents the comma delimiter ",".
@@ -114,6 +148,18 @@ const (
 	// Rbracket represents the right bracket delimiter "]".
 	Rbracket = "]"
 
+	// At represents the annotation marker "@".
+	At = "@"
+
+	// Dot represents the field access and method call operator ".".
+	Dot = "."
+
+	// Question represents the "?" of a conditional expression "cond ? a : b".
+	Question = "?"
+
+	// Arrow represents the "=>" of an arrow function "(x) => x + 1".
+	Arrow = "=>"
+
 	// Keywords
 
 	// Function represents the "fn" keyword for function declarations.
@@ -122,12 +168,18 @@ const (
 	// Let represents the "let" keyword for variable declarations.
 	Let = "Let"
 
+	// Const represents the "const" keyword for declarations of variables that cannot be reassigned.
+	Const = "Const"
+
 	// True represents the "true" boolean literal keyword.
 	True = "True"
 
 	// False represents the "false" boolean literal keyword.
 	False = "False"
 
+	// Null represents the "null" literal keyword.
+	Null = "Null"
+
 	// If represents the "if" keyword for conditional expressions.
 	If = "If"
 
@@ -136,17 +188,39 @@ const (
 
 	// Return represents the "return" keyword for returning values from functions.
 	Return = "Return"
+
+	// While represents the "while" keyword for condition-controlled loops.
+	While = "While"
+
+	// For represents the "for" keyword for counter-controlled loops.
+	For = "For"
+
+	// Break represents the "break" keyword for leaving a loop.
+	Break = "Break"
+
+	// Continue represents the "continue" keyword for skipping to the next loop iteration.
+	Continue = "Continue"
+
+	// In represents the "in" keyword, the membership operator.
+	In = "In"
 )
 
 // keywords is a map of reserved keywords to their corresponding token types.
 var keywords = map[string]Type{
-	"fn":     Function,
-	"let":    Let,
-	"true":   True,
-	"false":  False,
-	"if":     If,
-	"else":   Else,
-	"return": Return,
+	"fn":       Function,
+	"let":      Let,
+	"const":    Const,
+	"true":     True,
+	"false":    False,
+	"null":     Null,
+	"if":       If,
+	"else":     Else,
+	"return":   Return,
+	"while":    While,
+	"for":      For,
+	"break":    Break,
+	"continue": Continue,
+	"in":       In,
 }
 
 // LookupIdent checks if the given identifier is a keyword.
@@ -47,7 +47,8 @@
 //   - [MaxFrames]: Maximum call stack depth (1024 frames)
 //
 // These limits prevent runaway programs from consuming excessive memory and help
-// detect infinite recursion.
+// detect infinite recursion: exceeding them stops the program with a "stack overflow"
+// or "maximum call depth exceeded" error.
 //
 // # Built-in Values
 //
@@ -59,8 +60,12 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/dr8co/kong/code"
 	"github.com/dr8co/kong/compiler"
@@ -80,10 +85,10 @@ const (
 
 var (
 	// True is a predefined boolean object representing the value `true`.
-	True = &object.Boolean{Value: true}
+	True = object.True
 
 	// False is a predefined boolean object representing the value `false`.
-	False = &object.Boolean{Value: false}
+	False = object.False
 
 	// Null is a predefined object representing the `null` value. It indicates the absence of a meaningful value.
 	Null = &object.Null{}
@@ -101,13 +106,59 @@ type VM struct {
 	sp int
 
 	// globals stores global objects accessible across the virtual machine's context during execution.
-	globals []object.Object
+	// It holds exactly [GlobalsSize] globals, so the two-byte operands of OpGetGlobal and OpSetGlobal
+	// always index it in range, and Go does not check the bounds.
+	globals *[GlobalsSize]object.Object
+
+	// globalsErr is the error that running reports when the store passed to [NewWithGlobalsStore] is too small.
+	globalsErr error
 
 	// Holds the active frames for managing execution contexts in the virtual machine.
 	frames []*Frame
 
 	// framesIndex tracks the current active frame in the stack of execution frames for the virtual machine.
 	framesIndex int
+
+	// maxLoopIterations caps the number of loop iterations, counted by backward jumps; zero means no limit.
+	maxLoopIterations int
+
+	// loopIterations counts the backward jumps taken so far.
+	loopIterations int
+
+	// instructionsExecuted counts the instructions executed so far.
+	instructionsExecuted int
+
+	// instructionLimit stops execution once instructionsExecuted exceeds it; zero means no limit.
+	instructionLimit int
+
+	// ctx, if set, is checked every contextCheckInterval instructions to cancel execution.
+	ctx context.Context
+
+	// timeout bounds the wall-clock time of [VM.Run]; zero means no limit.
+	timeout time.Duration
+}
+
+// contextCheckInterval is the number of instructions executed between checks of the context passed to [VM.RunContext].
+const contextCheckInterval = 1024
+
+// Option configures optional behavior of a [VM].
+type Option func(*VM)
+
+// WithMaxLoopIterations limits the total number of loop iterations a program may run to n.
+// Each jump back to the start of a loop counts as one iteration, and a program that exceeds
+// the limit stops with an error. A limit of zero, the default, means no limit.
+func WithMaxLoopIterations(n int) Option {
+	return func(vm *VM) {
+		vm.maxLoopIterations = n
+	}
+}
+
+// WithTimeout limits the wall-clock time [VM.Run] may take to d. A program that runs longer
+// stops with an "execution timed out" error. A timeout of zero, the default, means no limit.
+func WithTimeout(d time.Duration) Option {
+	return func(vm *VM) {
+		vm.timeout = d
+	}
 }
 
 // makeFrames initializes a slice of frames with the main frame created from the provided bytecode.
@@ -120,32 +171,34 @@ func makeFrames(bytecode *compiler.Bytecode) []*Frame {
 	return frames
 }
 
-// New initializes and returns a new instance of the [VM] using the given bytecode.
-func New(bytecode *compiler.Bytecode) *VM {
-	frames := makeFrames(bytecode)
-
-	return &VM{
-		constants:   bytecode.Constants,
-		stack:       make([]object.Object, StackSize),
-		sp:          0,
-		globals:     make([]object.Object, GlobalsSize),
-		frames:      frames,
-		framesIndex: 1,
-	}
+// New initializes and returns a new instance of the [VM] using the given bytecode and options.
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize), opts...)
 }
 
-// NewWithGlobalsStore creates a new [VM] instance with the provided bytecode and a pre-allocated globals store.
-func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+// NewWithGlobalsStore creates a new [VM] instance with the provided bytecode, a pre-allocated globals store
+// and options.
+// The store must hold at least [GlobalsSize] globals, of which the VM uses the first [GlobalsSize];
+// running with a smaller store fails with an error before any instruction runs.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object, opts ...Option) *VM {
 	frames := makeFrames(bytecode)
 
-	return &VM{
+	vm := &VM{
 		constants:   bytecode.Constants,
 		stack:       make([]object.Object, StackSize),
 		sp:          0,
-		globals:     s,
 		frames:      frames,
 		framesIndex: 1,
 	}
+	if len(s) >= GlobalsSize {
+		vm.globals = (*[GlobalsSize]object.Object)(s)
+	} else {
+		vm.globalsErr = fmt.Errorf("globals store holds %d globals, want %d", len(s), GlobalsSize)
+	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
 }
 
 // LastPoppedStackItem retrieves and returns the last item popped off the virtual machine's stack without modifying the stack.
@@ -153,17 +206,87 @@ func (vm *VM) LastPoppedStackItem() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// StackDepth returns the number of objects currently on the virtual machine's stack,
+// including the arguments and local variables of the active function calls.
+func (vm *VM) StackDepth() int {
+	return vm.sp
+}
+
+// InstructionsExecuted returns the number of instructions the virtual machine has executed so far,
+// including those of nested calls made by builtins.
+func (vm *VM) InstructionsExecuted() int {
+	return vm.instructionsExecuted
+}
+
 // Run executes the instructions of the virtual machine,
 // managing the program counter and stack during execution.
+// If the VM was created with [WithTimeout], it stops with an error once the timeout passes.
+func (vm *VM) Run() error {
+	if vm.timeout <= 0 {
+		return vm.runProgram()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vm.timeout)
+	defer cancel()
+	err := vm.RunContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.New("execution timed out")
+	}
+	return err
+}
+
+// RunWithLimit executes the instructions of the virtual machine like [VM.Run],
+// but stops with an error once more than maxSteps instructions have been executed.
+// Instructions run by nested calls from builtins count towards the same budget.
+// A maxSteps of zero or less means no limit.
+func (vm *VM) RunWithLimit(maxSteps int) error {
+	if maxSteps <= 0 {
+		return vm.Run()
+	}
+	vm.instructionLimit = vm.instructionsExecuted + maxSteps
+	defer func() { vm.instructionLimit = 0 }()
+	return vm.runProgram()
+}
+
+// RunContext executes the instructions of the virtual machine like [VM.Run],
+// but stops with the context's error once ctx is canceled or its deadline passes.
+// The context is checked every 1024 instructions, so cancellation is not immediate.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.ctx = ctx
+	defer func() { vm.ctx = nil }()
+	return vm.runProgram()
+}
+
+// runProgram runs the program to completion.
+func (vm *VM) runProgram() error {
+	if vm.globalsErr != nil {
+		return vm.globalsErr
+	}
+	return vm.run(0)
+}
+
+// run executes instructions until the main frame runs out of instructions
+// or the call stack shrinks to minFrames frames.
+//
+// A minFrames of zero runs the program to completion; a higher value
+// runs a nested call until its frame returns (see [VM.callFunction]).
 //
 //nolint:gocyclo
-func (vm *VM) Run() error {
+func (vm *VM) run(minFrames int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > minFrames && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
+		vm.instructionsExecuted++
+		if vm.instructionLimit > 0 && vm.instructionsExecuted > vm.instructionLimit {
+			return errors.New("instruction limit exceeded")
+		}
+		if vm.ctx != nil && vm.instructionsExecuted%contextCheckInterval == 0 {
+			if err := vm.ctx.Err(); err != nil {
+				return err
+			}
+		}
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
@@ -177,13 +300,21 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpAddImmediate:
+			value := int64(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			err := vm.executeAddImmediate(value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpLessEqual, code.OpGreaterEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -218,6 +349,13 @@ func (vm *VM) Run() error {
 
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
+			if pos <= ip {
+				// Only loops jump backward.
+				err := vm.countLoopIteration()
+				if err != nil {
+					return err
+				}
+			}
 			vm.currentFrame().ip = pos - 1
 
 		case code.OpJumpNotTruthy:
@@ -284,7 +422,34 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpDup:
+			count := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			for _, obj := range vm.stack[vm.sp-count : vm.sp] {
+				err := vm.push(obj)
+				if err != nil {
+					return err
+				}
+			}
+
+		case code.OpSwap:
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+
 		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return errors.New("return outside function")
+			}
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -294,6 +459,9 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpReturnValue:
+			if vm.framesIndex == 1 {
+				return errors.New("return outside function")
+			}
 			returnValue := vm.pop()
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
@@ -312,6 +480,15 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			err := vm.executeTailCall(numArgs)
+			if err != nil {
+				return err
+			}
+
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip++
@@ -352,6 +529,9 @@ func (vm *VM) Run() error {
 			freeIndex := int(code.ReadUint8(ins[ip+1:]))
 			vm.currentFrame().ip++
 			currentClosure := vm.currentFrame().cl
+			if freeIndex >= len(currentClosure.Free) {
+				return fmt.Errorf("free variable %d out of range (%d free variables)", freeIndex, len(currentClosure.Free))
+			}
 
 			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
@@ -359,8 +539,39 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpCurrentClosure:
-			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure)
+			var self object.Object = vm.currentFrame().cl
+			if wrapper := vm.currentFrame().cl.Self; wrapper != nil {
+				self = wrapper
+			}
+			err := vm.push(self)
+			if err != nil {
+				return err
+			}
+
+		case code.OpBindSelf:
+			wrapper := vm.pop()
+			cl, ok := vm.stack[vm.sp-1].(*object.Closure)
+			if !ok {
+				return fmt.Errorf("cannot bind a wrapper to %s", vm.stack[vm.sp-1].Type())
+			}
+			cl.Self = wrapper
+			vm.stack[vm.sp-1] = wrapper
+
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSliceExpression(left, low, high)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIn:
+			collection := vm.pop()
+			value := vm.pop()
+
+			err := vm.executeIn(value, collection)
 			if err != nil {
 				return err
 			}
@@ -369,6 +580,18 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+// countLoopIteration records one loop iteration, failing once the iteration limit is exceeded.
+func (vm *VM) countLoopIteration() error {
+	if vm.maxLoopIterations <= 0 {
+		return nil
+	}
+	vm.loopIterations++
+	if vm.loopIterations > vm.maxLoopIterations {
+		return fmt.Errorf("loop exceeded %d iterations", vm.maxLoopIterations)
+	}
+	return nil
+}
+
 // isTruthy determines the truthiness of an object based on its type and value.
 //
 // Returns true for non-null, non-boolean false objects, and false otherwise.
@@ -416,9 +639,76 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 		return vm.executeBinaryIntegerOperation(op, left, right)
 	case leftType == object.StringObj && rightType == object.StringObj:
 		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType == object.ArrayObj && rightType == object.ArrayObj:
+		return vm.executeBinaryArrayOperation(op, left, right)
+	default:
+		if leftValue, rightValue, ok := floatOperands(left, right); ok {
+			return vm.executeBinaryFloatOperation(op, leftValue, rightValue)
+		}
+		return unsupportedOperation(op, left, right)
+	}
+}
+
+// floatOperands returns the values of left and right as floats if both are numbers and at least one is a float,
+// so that an operation mixing an integer with a float is carried out on floats.
+func floatOperands(left, right object.Object) (float64, float64, bool) {
+	_, leftFloat := left.(*object.Float)
+	_, rightFloat := right.(*object.Float)
+	if !leftFloat && !rightFloat {
+		return 0, 0, false
+	}
+	leftValue, leftOk := floatValue(left)
+	rightValue, rightOk := floatValue(right)
+	return leftValue, rightValue, leftOk && rightOk
+}
+
+// floatValue returns the value of an integer or a float as a float64, and reports whether obj is either.
+func floatValue(obj object.Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value), true
+	case *object.Float:
+		return obj.Value, true
 	default:
-		return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
+		return 0, false
+	}
+}
+
+// binaryOperators maps the opcodes of binary operations to their operators, for error messages.
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpIn:           "in",
+}
+
+// unsupportedOperation returns the error for a binary operation that does not support the types of its operands,
+// such as "unsupported operation: STRING - INTEGER".
+func unsupportedOperation(op code.Opcode, left, right object.Object) error {
+	return fmt.Errorf("unsupported operation: %s %s %s", left.Type(), binaryOperators[op], right.Type())
+}
+
+// executeAddImmediate adds value to the integer at the top of the stack, replacing it with the sum.
+// Other values are added as by OpAdd, which reports the error for unsupported types.
+func (vm *VM) executeAddImmediate(value int64) error {
+	if left, ok := vm.stack[vm.sp-1].(*object.Integer); ok {
+		vm.stack[vm.sp-1] = object.NewInteger(left.Value + value)
+		return nil
+	}
+
+	err := vm.push(object.NewInteger(value))
+	if err != nil {
+		return err
 	}
+	return vm.executeBinaryOperation(code.OpAdd)
 }
 
 // executeBinaryIntegerOperation performs a binary operation on two integer objects based on the given opcode.
@@ -436,19 +726,56 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftVal * rightVal
 	case code.OpDiv:
+		if rightVal == 0 {
+			return errors.New("division by zero")
+		}
 		result = leftVal / rightVal
+	case code.OpMod:
+		if rightVal == 0 {
+			return errors.New("modulo by zero")
+		}
+		result = leftVal % rightVal
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(object.NewInteger(result))
+}
+
+// executeBinaryFloatOperation performs a binary operation on two float values based on the given opcode.
+// Like integer operations, dividing by zero is an error rather than an infinity.
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, leftVal, rightVal float64) error {
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv:
+		if rightVal == 0 {
+			return errors.New("division by zero")
+		}
+		result = leftVal / rightVal
+	case code.OpMod:
+		if rightVal == 0 {
+			return errors.New("modulo by zero")
+		}
+		result = math.Mod(leftVal, rightVal)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
 }
 
 // executeBinaryStringOperation performs binary string operations,
 // currently supporting only addition (concatenation) of strings.
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
-		return fmt.Errorf("unknown string operator: %d", op)
+		return unsupportedOperation(op, left, right)
 	}
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
@@ -456,6 +783,22 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	return vm.push(&object.String{Value: leftValue + rightValue})
 }
 
+// executeBinaryArrayOperation performs binary array operations,
+// currently supporting only addition, which concatenates the arrays into a new one.
+func (vm *VM) executeBinaryArrayOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return unsupportedOperation(op, left, right)
+	}
+	leftElements := left.(*object.Array).Elements
+	rightElements := right.(*object.Array).Elements
+
+	elements := make([]object.Object, 0, len(leftElements)+len(rightElements))
+	elements = append(elements, leftElements...)
+	elements = append(elements, rightElements...)
+
+	return vm.push(&object.Array{Elements: elements})
+}
+
 // executeComparison evaluates a comparison operation between two operands and pushes the result onto the stack.
 //
 // Returns an error if an unknown operator is encountered or execution fails.
@@ -466,14 +809,131 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	if left.Type() == object.IntegerObj && right.Type() == object.IntegerObj {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if leftValue, rightValue, ok := floatOperands(left, right); ok {
+		return vm.executeFloatComparison(op, leftValue, rightValue)
+	}
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(objectsEqual(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!objectsEqual(left, right)))
 	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+		return unsupportedOperation(op, left, right)
+	}
+}
+
+// objectsEqual reports whether left and right are equal.
+// Numbers, booleans and strings are compared by value, with an integer equal to the float of the same value,
+// and null equals only null.
+// Arrays are equal if they have the same length and equal elements, and hashes if they have
+// equal values under the same keys, in any order. Other objects are equal only if they are the same object.
+func objectsEqual(left, right object.Object) bool {
+	return equalObjects(left, right, nil)
+}
+
+// objectPair is a pair of arrays or hashes being compared.
+type objectPair struct {
+	left, right object.Object
+}
+
+// equalObjects implements [objectsEqual]. The comparison of scalars does not allocate.
+//
+// The arrays and hashes being compared are recorded in comparing, allocated on demand, so that comparing
+// collections that contain themselves terminates: a pair already being compared is assumed equal.
+func equalObjects(left, right object.Object, comparing map[objectPair]bool) bool {
+	switch left := left.(type) {
+	case *object.Integer:
+		switch right := right.(type) {
+		case *object.Integer:
+			return left.Value == right.Value
+		case *object.Float:
+			return float64(left.Value) == right.Value
+		default:
+			return false
+		}
+	case *object.Float:
+		rightValue, ok := floatValue(right)
+		return ok && left.Value == rightValue
+	case *object.Boolean:
+		right, ok := right.(*object.Boolean)
+		return ok && left.Value == right.Value
+	case *object.String:
+		right, ok := right.(*object.String)
+		return ok && left.Value == right.Value
+	case *object.Null:
+		_, ok := right.(*object.Null)
+		return ok
+	case *object.Array:
+		right, ok := right.(*object.Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		if left == right || comparing[objectPair{left, right}] {
+			return true
+		}
+		if comparing == nil {
+			comparing = make(map[objectPair]bool)
+		}
+		comparing[objectPair{left, right}] = true
+		for i, element := range left.Elements {
+			if !equalObjects(element, right.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		right, ok := right.(*object.Hash)
+		if !ok || len(left.Pairs) != len(right.Pairs) {
+			return false
+		}
+		if left == right || comparing[objectPair{left, right}] {
+			return true
+		}
+		if comparing == nil {
+			comparing = make(map[objectPair]bool)
+		}
+		comparing[objectPair{left, right}] = true
+		for key, pair := range left.Pairs {
+			other, ok := right.Pairs[key]
+			if !ok || !equalObjects(pair.Key, other.Key, comparing) || !equalObjects(pair.Value, other.Value, comparing) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
+
+// executeIn pushes whether value is in collection: an element of an array, a key of a hash,
+// or a substring of a string.
+//
+// Returns an error if the collection does not support membership tests, or the value cannot be in it.
+func (vm *VM) executeIn(value, collection object.Object) error {
+	switch collection := collection.(type) {
+	case *object.Array:
+		for _, element := range collection.Elements {
+			if objectsEqual(value, element) {
+				return vm.push(True)
+			}
+		}
+		return vm.push(False)
+	case *object.Hash:
+		key, ok := value.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", value.Type())
+		}
+		_, ok = collection.Pairs[key.HashKey()]
+		return vm.push(nativeBoolToBooleanObject(ok))
+	case *object.String:
+		str, ok := value.(*object.String)
+		if !ok {
+			return unsupportedOperation(code.OpIn, value, collection)
+		}
+		return vm.push(nativeBoolToBooleanObject(strings.Contains(collection.Value, str.Value)))
+	default:
+		return unsupportedOperation(code.OpIn, value, collection)
 	}
 }
 
@@ -500,6 +960,33 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+// executeFloatComparison compares two float values, or an integer converted to a float with a float,
+// and pushes the result onto the stack.
+func (vm *VM) executeFloatComparison(op code.Opcode, leftValue, rightValue float64) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -522,15 +1009,18 @@ func (vm *VM) executeBangOperator() error {
 	}
 }
 
-// executeMinusOperator negates the integer value at the top of the VM stack and pushes the result back onto the stack.
+// executeMinusOperator negates the integer or float value at the top of the VM stack and pushes the result back onto the stack.
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.IntegerObj {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(object.NewInteger(-operand.Value))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
 }
 
 // buildArray creates a new array object from the VM's stack within the specified startIndex and endIndex range.
@@ -545,11 +1035,11 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 }
 
 // buildHash constructs a hash object from stack elements between startIndex and endIndex,
-// treating pairs as key-value entries.
+// treating pairs as key-value entries. The pairs keep the order in which they are on the stack.
 //
 // Returns a hash object or an error if a key is not hashable.
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash((endIndex - startIndex) / 2)
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
@@ -561,10 +1051,10 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey.HashKey(), pair)
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 // executeIndexExpression processes index expressions on supported types like arrays and hashes within the VM.
@@ -572,6 +1062,8 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ArrayObj && index.Type() == object.IntegerObj:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.StringObj && index.Type() == object.IntegerObj:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HashObj:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -579,19 +1071,117 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	}
 }
 
+// executeSetIndex stores value at the given index of an array, or under the given key of a hash.
+// A negative array index counts from the end of the array.
+// The collection is modified in place, so the change is visible through every reference to it.
+//
+// Returns an error if the collection does not support index assignment, or if an array index is out of range.
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		i, ok := resolveIndex(integer.Value, len(left.Elements))
+		if !ok {
+			return fmt.Errorf("index out of range: %d", integer.Value)
+		}
+		left.Elements[i] = value
+		return nil
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key.HashKey(), object.HashPair{Key: index, Value: value})
+		return nil
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+}
+
 // executeArrayIndex retrieves the element at the given index from the array and pushes it onto the stack or null if out of bounds.
+// A negative index counts from the end of the array.
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
 
-	maxElems := int64(len(arrayObject.Elements) - 1)
-	if i < 0 || i > maxElems {
+	i, ok := resolveIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+	if !ok {
 		return vm.push(Null)
 	}
 
 	return vm.push(arrayObject.Elements[i])
 }
 
+// executeStringIndex pushes the single-character string at the given index of the string, or null if out of bounds.
+// A negative index counts from the end of the string.
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	value := str.(*object.String).Value
+
+	i, ok := resolveIndex(index.(*object.Integer).Value, len(value))
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: value[i : i+1]})
+}
+
+// resolveIndex turns a possibly negative index into an offset into a collection of the given length.
+// It reports false if the index is out of range.
+func resolveIndex(index int64, length int) (int64, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+	return index, true
+}
+
+// executeSliceExpression pushes the part of an array or string between the low and high bounds.
+// Bounds are clamped to the collection, and a null bound stands for its start or end.
+func (vm *VM) executeSliceExpression(left, low, high object.Object) error {
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len(left.Value)
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	start, err := sliceBound(low, 0, length)
+	if err != nil {
+		return err
+	}
+	end, err := sliceBound(high, length, length)
+	if err != nil {
+		return err
+	}
+	end = max(end, start)
+
+	if array, ok := left.(*object.Array); ok {
+		elements := make([]object.Object, end-start)
+		copy(elements, array.Elements[start:end])
+		return vm.push(&object.Array{Elements: elements})
+	}
+	return vm.push(&object.String{Value: left.(*object.String).Value[start:end]})
+}
+
+// sliceBound returns the integer value of a slice bound clamped to [0, length], or def if the bound is null.
+func sliceBound(bound object.Object, def, length int) (int, error) {
+	if bound == Null {
+		return def, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, fmt.Errorf("slice bound must be INTEGER, got %s", bound.Type())
+	}
+	return int(min(max(integer.Value, 0), int64(length))), nil
+}
+
 // executeHashIndex retrieves a value from a hash using a hashable key and pushes it onto the stack.
 //
 // Returns an error if the key is not hashable or if value retrieval fails.
@@ -629,12 +1219,20 @@ func (vm *VM) popFrame() *Frame {
 
 // callClosure executes a given Closure object by creating a new frame and adjusting the stack pointer accordingly.
 //
-// Returns an error if the number of arguments does not match the expected count.
+// Returns an error if the number of arguments does not match the expected count,
+// if the call would nest deeper than [MaxFrames] frames, or if its locals do not fit on the stack.
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
+	if vm.framesIndex >= MaxFrames {
+		return errors.New("maximum call depth exceeded")
+	}
+	if vm.sp-numArgs+cl.Fn.NumLocals > StackSize {
+		return errors.New("stack overflow")
+	}
+
 	frame := NewFrame(cl, vm.sp-numArgs)
 	vm.pushFrame(frame)
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
@@ -647,6 +1245,9 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 //
 // numArgs specifies the number of arguments passed to the function.
 func (vm *VM) executeCall(numArgs int) error {
+	if numArgs >= vm.sp-vm.currentFrame().basePointer {
+		return fmt.Errorf("call with %d arguments has no callee", numArgs)
+	}
 	callee := vm.stack[vm.sp-1-numArgs]
 
 	switch callee := callee.(type) {
@@ -659,11 +1260,62 @@ func (vm *VM) executeCall(numArgs int) error {
 	}
 }
 
+// executeTailCall executes a call whose result the current function returns right away.
+// A call of the current closure with the right number of arguments reuses the current frame,
+// so that tail recursion runs in constant space, and counts as a loop iteration.
+// Other calls are executed as by OpCall.
+func (vm *VM) executeTailCall(numArgs int) error {
+	frame := vm.currentFrame()
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || callee != frame.cl || numArgs != callee.Fn.NumParameters {
+		return vm.executeCall(numArgs)
+	}
+
+	err := vm.countLoopIteration()
+	if err != nil {
+		return err
+	}
+
+	// The arguments replace the parameters, and the closure below the frame is already the callee.
+	copy(vm.stack[frame.basePointer:], vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = frame.basePointer + callee.Fn.NumLocals
+	frame.ip = -1
+	return nil
+}
+
 // callBuiltin invokes a builtin function with the provided arguments and handles the [VM.stack] manipulation for the result.
+// An [object.Error] returned by the builtin is not pushed, but aborts execution with its message,
+// and an [object.Exit] aborts execution with the [object.Exit] itself as the error.
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result := builtin.Fn(args...)
+	var result object.Object
+	switch {
+	case builtin.HigherOrder != nil:
+		var err error
+		result, err = builtin.HigherOrder(vm.callFunction, args...)
+		if err != nil {
+			return err
+		}
+	case builtin.WithContext != nil:
+		ctx := vm.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var err error
+		result, err = builtin.WithContext(ctx, args...)
+		if err != nil {
+			return err
+		}
+	default:
+		result = builtin.Fn(args...)
+	}
+	switch result := result.(type) {
+	case *object.Error:
+		return errors.New(result.Message)
+	case *object.Exit:
+		return result
+	}
 	vm.sp = vm.sp - numArgs - 1
 
 	var err error
@@ -676,6 +1328,39 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return err
 }
 
+// callFunction calls fn with args from within a running builtin and returns the result.
+//
+// The function and its arguments are pushed above the caller's stack, and closures are
+// executed by a nested run loop that returns as soon as the callee's frame is popped.
+// This lets higher-order builtins (see [object.HigherOrderFunction]) call back into compiled code.
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	err := vm.push(fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		err = vm.push(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	framesIndex := vm.framesIndex
+	err = vm.executeCall(len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	if vm.framesIndex > framesIndex {
+		err = vm.run(framesIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return vm.pop(), nil
+}
+
 // pushClosure creates a closure from a compiled function and its free variables, then pushes it onto the [VM.stack].
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constObj := vm.constants[constIndex]
@@ -683,6 +1368,10 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	if !ok {
 		return fmt.Errorf("not a function: %+v", constObj)
 	}
+	if numFree > vm.sp-vm.currentFrame().basePointer {
+		return fmt.Errorf("closure with %d free variables has only %d values on the stack",
+			numFree, vm.sp-vm.currentFrame().basePointer)
+	}
 	free := make([]object.Object, numFree)
 
 	for i := range numFree {
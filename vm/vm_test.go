@@ -1,10 +1,15 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/dr8co/kong/ast"
+	"github.com/dr8co/kong/code"
 	"github.com/dr8co/kong/compiler"
 	"github.com/dr8co/kong/lexer"
 	"github.com/dr8co/kong/object"
@@ -48,6 +53,16 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+
+		// Errors returned by builtins abort execution instead of being pushed.
+		if expected, ok := tt.expected.(*object.Error); ok {
+			if err == nil {
+				t.Errorf("%q: expected VM error %q but resulted in none", tt.input, expected.Message)
+			} else if err.Error() != expected.Message {
+				t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, expected.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -57,6 +72,24 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	}
 }
 
+// runProgram compiles and runs input, returning the last popped stack item.
+func runProgram(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return vm.LastPoppedStackItem()
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 
@@ -102,6 +135,24 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 			}
 		}
 
+	case []string:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array: %T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong number of elements. got=%d, want=%d", len(array.Elements), len(expected))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testStringObject(expectedElem, array.Elements[i])
+			if err != nil {
+				t.Errorf("testStringObject failed: %s", err)
+			}
+		}
+
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
@@ -179,6 +230,11 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 / 2", -3},
+		{"2 + 10 % 4 * 3", 8},
 	}
 	runVmTests(t, tests)
 }
@@ -217,6 +273,103 @@ func TestBooleanExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestEquality verifies that == and != compare integers, booleans, strings and null by value,
+// and that values of different types are never equal.
+func TestEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = 1; let b = 1; a == b`, true},
+		{`let a = 1; let b = 2; a != b`, true},
+		{`let a = true; let b = 1 < 2; a == b`, true},
+		{`let a = true; let b = 1 > 2; a != b`, true},
+		{`let a = "ab"; let b = "a" + "b"; a == b`, true},
+		{`let a = "ab"; let b = "a" + "b"; a != b`, false},
+		{`let a = "ab"; let b = "ba"; a == b`, false},
+		{`let a = if (false) { 1 }; let b = if (false) { 2 }; a == b`, true},
+		{`let a = if (false) { 1 }; a == false`, false},
+		{`let a = if (false) { 1 }; a != 0`, true},
+		{`let a = 1; a == true`, false},
+		{`let a = 1; a == "1"`, false},
+		{`let a = "true"; a == true`, false},
+		{`let a = [1]; a == a`, true},
+		{`let a = fn() { 1 }; a != a`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestNullLiteral(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"let x = null; x", Null},
+		{"null == null", true},
+		{"null != null", false},
+		{"let x = null; x == if (false) { 1 }", true},
+		{"null == false", false},
+		{"!null", true},
+		{"if (null) { 1 } else { 2 }", 2},
+		{"let x = null; x = 5; x", 5},
+		{"[null, 1][0]", Null},
+		{`{"a": null}["a"]`, Null},
+		{"fn() { null }()", Null},
+	}
+	runVmTests(t, tests)
+}
+
+// TestStructuralEquality verifies that arrays and hashes are compared by their contents.
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[] == []`, true},
+		{`[1, "a", true, if (false) { 1 }] == [1, "a", true, if (false) { 1 }]`, true},
+		{`[[1, 2], [3, [4]]] == [[1, 2], [3, [4]]]`, true},
+		{`[[1, 2], [3, [4]]] == [[1, 2], [3, [5]]]`, false},
+		{`[1] == {1: 1}`, false},
+		{`[1] == 1`, false},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"a": 1, "b": 3}`, false},
+		{`{"a": 1, "b": 2} == {"a": 1, "c": 2}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{} == {}`, true},
+		{`{"a": [1, {"b": [2]}]} == {"a": [1, {"b": [2]}]}`, true},
+		{`{"a": [1, {"b": [2]}]} != {"a": [1, {"b": [3]}]}`, true},
+		{`{1: "one", true: "yes"} == {true: "yes", 1: "one"}`, true},
+		{`let a = [1]; a[0] = a; a == a`, true},
+		{`let a = [0]; let b = [0]; a[0] = b; b[0] = a; a == b`, true},
+		{`let f = fn() { 1 }; [f] == [f]`, true},
+		{`[fn() { 1 }] == [fn() { 1 }]`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []vmTestCase{
+		{"2 in [1, 2, 3]", true},
+		{"4 in [1, 2, 3]", false},
+		{"1 in []", false},
+		{`"1" in [1, 2]`, false},
+		{"[1, 2] in [[1, 2], [3]]", true},
+		{"[2, 1] in [[1, 2], [3]]", false},
+		{`{"a": 1} in [{"a": 1}]`, true},
+		{"null in [1, null]", true},
+		{`"a" in {"a": 1, "b": 2}`, true},
+		{`"c" in {"a": 1, "b": 2}`, false},
+		{`1 in {1: "one"}`, true},
+		{`true in {true: "yes"}`, true},
+		{`false in {true: "yes"}`, false},
+		{`let h = {}; h["k"] = null; "k" in h`, true},
+		{`"ell" in "hello"`, true},
+		{`"" in "hello"`, true},
+		{`"olleh" in "hello"`, false},
+		{`!(4 in [1, 2]) == true`, true},
+		{`[1] in {}`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`1 in "123"`, &object.Error{Message: "unsupported operation: INTEGER in STRING"}},
+		{`1 in 123`, &object.Error{Message: "unsupported operation: INTEGER in INTEGER"}},
+	}
+	runVmTests(t, tests)
+}
+
 // TestConditionals verifies the evaluation of conditional expressions within the virtual machine.
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
@@ -229,6 +382,12 @@ func TestConditionals(t *testing.T) {
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 > 2) { 10 }", Null},
 		{"if (false) { 10 }", Null},
+		{"let x = 5; if (x < 3) { 10 } else if (x < 7) { 20 } else { 30 }", 20},
+		{"let x = 1; if (x < 3) { 10 } else if (x < 7) { 20 } else { 30 }", 10},
+		{"let x = 9; if (x < 3) { 10 } else if (x < 7) { 20 } else { 30 }", 30},
+		{"let x = 9; if (x < 3) { 10 } else if (x < 7) { 20 }", Null},
+		{"let f = fn(x) { if (x == 1) { return 10 } else if (x == 2) { return 20 }; 30 }; [f(1), f(2), f(3)]",
+			[]int{10, 20, 30}},
 	}
 	runVmTests(t, tests)
 }
@@ -287,7 +446,17 @@ func TestHashLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
-// TestIndexExpressions tests the evaluation of index expressions on arrays and hashes in the virtual machine.
+// TestSharedStringConstants tests that interned string constants work as hash keys and values.
+func TestSharedStringConstants(t *testing.T) {
+	tests := []vmTestCase{
+		{`let h = {"name": "name"}; h["name"]`, "name"},
+		{`let a = {"k": 1}; let b = {"k": 2}; a["k"] + b["k"]`, 3},
+		{`let f = fn() { {"k": "k"} }; f()["k"] + f()["k"]`, "kk"},
+	}
+	runVmTests(t, tests)
+}
+
+// TestIndexExpressions tests the evaluation of index expressions on arrays, strings and hashes in the virtual machine.
 func TestIndexExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"[1, 2, 3][1]", 2},
@@ -295,7 +464,17 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1, 1, 1]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1][-1]", 1},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", Null},
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[3]`, Null},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-3]`, "a"},
+		{`"abc"[-4]`, Null},
+		{`""[0]`, Null},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
@@ -304,6 +483,29 @@ func TestIndexExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestSliceExpressions tests slicing arrays and strings, including clamping of out-of-range bounds.
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][1 + 1:10]", []int{3, 4}},
+		{"[1, 2, 3, 4][-2:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][5:]", []int{}},
+		{"[][:]", []int{}},
+		{"let a = [1, 2, 3]; let b = a[:]; a == b", true},
+		{"let a = [1, 2, 3]; let b = a[:]; b[0] = 9; a", []int{1, 2, 3}},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[:3]`, "mon"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[2:100]`, "nkey"},
+		{`"monkey"[4:2]`, ""},
+	}
+	runVmTests(t, tests)
+}
+
 // TestCallingFunctionsWithoutArguments tests the execution of functions without arguments and ensures the expected output is returned.
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
@@ -585,6 +787,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`puts("hello", "world!")`, Null},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, Null},
+		{`first("abc")`, "a"},
+		{`first("")`, Null},
 		{`first(1)`,
 			&object.Error{
 				Message: "argument to `first` not supported, got INTEGER",
@@ -592,6 +796,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		},
 		{`last([1, 2, 3])`, 3},
 		{`last([])`, Null},
+		{`last("abc")`, "c"},
+		{`last("")`, Null},
 		{`last(1)`,
 			&object.Error{
 				Message: "argument to `last` not supported, got INTEGER",
@@ -599,6 +805,15 @@ func TestBuiltinFunctions(t *testing.T) {
 		},
 		{`rest([1, 2, 3])`, []int{2, 3}},
 		{`rest([])`, Null},
+		{`rest("abc")`, "bc"},
+		{`rest("a")`, ""},
+		{`rest("")`, Null},
+		// Strings are sequences of bytes, so the string builtins split multi-byte characters.
+		{`len("é")`, 2},
+		{`first("é")`, "\xc3"},
+		{`last("é")`, "\xa9"},
+		{`rest("é")`, "\xa9"},
+		{`first("é") + rest("é") == "é"`, true},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`,
 			&object.Error{
@@ -609,6 +824,353 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestStringBuiltins verifies split, join, trim and replace, including their argument errors.
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,c", ",")`, []string{"a", "b", "c"}},
+		{`split("a, b", ", ")`, []string{"a", "b"}},
+		{`split("abc", "")`, []string{"a", "b", "c"}},
+		{`split("né", "")`, []string{"n", "é"}},
+		{`split("", ",")`, []string{""}},
+		{`split("abc", ",")`, []string{"abc"}},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([], ",")`, ""},
+		{`join(split("1 2 3", " "), "+")`, "1+2+3"},
+		{`trim("  hello 	
+")`, "hello"},
+		{`trim("")`, ""},
+		{`replace("banana", "a", "o")`, "bonono"},
+		{`replace("banana", "x", "o")`, "banana"},
+		{`split(1, ",")`, &object.Error{Message: "first argument to `split` must be STRING, got INTEGER"}},
+		{`split("a", 1)`, &object.Error{Message: "second argument to `split` must be STRING, got INTEGER"}},
+		{`split("a")`, &object.Error{Message: "wrong number of arguments. got=1, want=2"}},
+		{`join("a", ",")`, &object.Error{Message: "first argument to `join` must be ARRAY, got STRING"}},
+		{`join(["a"], 1)`, &object.Error{Message: "second argument to `join` must be STRING, got INTEGER"}},
+		{`join(["a", 1], ",")`, &object.Error{Message: "array elements passed to `join` must be STRING, got INTEGER at index 1"}},
+		{`trim(1)`, &object.Error{Message: "argument to `trim` must be STRING, got INTEGER"}},
+		{`trim("a", "b")`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+		{`replace("a", "b", 1)`, &object.Error{Message: "third argument to `replace` must be STRING, got INTEGER"}},
+		{`replace("a", "b")`, &object.Error{Message: "wrong number of arguments. got=2, want=3"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestTypeBuiltin verifies the type names reported by the type builtin.
+func TestTypeBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{`type(1)`, "INTEGER"},
+		{`type(true)`, "BOOLEAN"},
+		{`type("a")`, "STRING"},
+		{`type(if (false) { 1 })`, "NULL"},
+		{`type([1])`, "ARRAY"},
+		{`type({1: 2})`, "HASH"},
+		{`type(fn(x) { x })`, "CLOSURE"},
+		{`let y = 1; type(fn() { y })`, "CLOSURE"},
+		{`type(len)`, "BUILTIN"},
+		{`type(memoize(fn(x) { x }))`, "BUILTIN"},
+		{`type(newBuilder())`, "STRING_BUILDER"},
+		{`type(newList())`, "LIST"},
+		{`type(newSet())`, "SET"},
+		{`type(len(1))`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`type(type(1))`, "STRING"},
+		{`type()`, &object.Error{Message: "wrong number of arguments. got=0, want=1"}},
+		{`type(1, 2)`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestConversionBuiltins verifies int, float and str, including round trips between them and parse errors.
+func TestConversionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`int(42)`, 42},
+		{`int("-17")`, -17},
+		{`int(float("2.9"))`, 2},
+		{`int(float("-2.9"))`, -2},
+		{`int(str(12345))`, 12345},
+		{`int(float(int("7")))`, 7},
+		{`type(float(3))`, "FLOAT"},
+		{`str(float(3))`, "3.0"},
+		{`str(float("2.5"))`, "2.5"},
+		{`str(float(str(float("0.125"))))`, "0.125"},
+		{`str(float("1e3"))`, "1000.0"},
+		{`str("already")`, "already"},
+		{`str(1) + str(true)`, "1true"},
+		{`str([1, "a", [2]])`, "[1, a, [2]]"},
+		{`str(if (false) { 1 })`, "null"},
+		{`int("abc")`, &object.Error{Message: `cannot parse "abc" as INTEGER`}},
+		{`int("1.5")`, &object.Error{Message: `cannot parse "1.5" as INTEGER`}},
+		{`int("")`, &object.Error{Message: `cannot parse "" as INTEGER`}},
+		{`int(float("NaN"))`, &object.Error{Message: "cannot convert NaN to INTEGER"}},
+		{`int(float("1e300"))`, &object.Error{Message: "cannot convert 1e+300 to INTEGER"}},
+		{`int(float("-1e19"))`, &object.Error{Message: "cannot convert -1e+19 to INTEGER"}},
+		{`int(float("Inf"))`, &object.Error{Message: "cannot convert +Inf to INTEGER"}},
+		{`int(float("-9.2e18"))`, -9200000000000000000},
+		{`int(true)`, &object.Error{Message: "argument to `int` not supported, got BOOLEAN"}},
+		{`float("x")`, &object.Error{Message: `cannot parse "x" as FLOAT`}},
+		{`float([1])`, &object.Error{Message: "argument to `float` not supported, got ARRAY"}},
+		{`str()`, &object.Error{Message: "wrong number of arguments. got=0, want=1"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestMathBuiltins verifies abs, min, max, pow, sqrt, floor and ceil, including their errors.
+func TestMathBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`abs(-5)`, 5},
+		{`abs(5)`, 5},
+		{`str(abs(float("-2.5")))`, "2.5"},
+		{`min(3, 1, 2)`, 1},
+		{`max(3, 1, 2)`, 3},
+		{`min([4, -2, 7])`, -2},
+		{`max([4, -2, 7])`, 7},
+		{`min(5)`, 5},
+		{`str(min(2, float("1.5")))`, "1.5"},
+		{`max(2, float("1.5"))`, 2},
+		{`pow(2, 10)`, 1024},
+		{`pow(-3, 3)`, -27},
+		{`pow(7, 0)`, 1},
+		{`str(pow(2, -1))`, "0.5"},
+		{`str(pow(float("2.25"), float("0.5")))`, "1.5"},
+		{`str(sqrt(16))`, "4.0"},
+		{`str(sqrt(float("2.25")))`, "1.5"},
+		{`floor(float("2.7"))`, 2},
+		{`floor(float("-2.2"))`, -3},
+		{`ceil(float("2.2"))`, 3},
+		{`ceil(float("-2.7"))`, -2},
+		{`floor(4)`, 4},
+		{`type(ceil(float("1.5")))`, "INTEGER"},
+		{`abs("a")`, &object.Error{Message: "argument to `abs` must be INTEGER or FLOAT, got STRING"}},
+		{`abs()`, &object.Error{Message: "wrong number of arguments. got=0, want=1"}},
+		{`min()`, &object.Error{Message: "wrong number of arguments. got=0, want at least 1"}},
+		{`max([])`, &object.Error{Message: "`max` of an empty array"}},
+		{`min(1, "a")`, &object.Error{Message: "arguments to `min` must be INTEGER or FLOAT, got STRING"}},
+		{`max([1, [2]])`, &object.Error{Message: "arguments to `max` must be INTEGER or FLOAT, got ARRAY"}},
+		{`pow(2)`, &object.Error{Message: "wrong number of arguments. got=1, want=2"}},
+		{`pow(2, true)`, &object.Error{Message: "second argument to `pow` must be INTEGER or FLOAT, got BOOLEAN"}},
+		{`sqrt(-4)`, &object.Error{Message: "`sqrt` of negative number -4"}},
+		{`sqrt("4")`, &object.Error{Message: "argument to `sqrt` must be INTEGER or FLOAT, got STRING"}},
+		{`floor(float("NaN"))`, &object.Error{Message: "cannot convert NaN to INTEGER"}},
+		{`ceil(float("Inf"))`, &object.Error{Message: "cannot convert +Inf to INTEGER"}},
+		{`floor("1.5")`, &object.Error{Message: "argument to `floor` must be INTEGER or FLOAT, got STRING"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestStringBuilder verifies that a string builder produces the same string as repeated concatenation.
+func TestStringBuilder(t *testing.T) {
+	tests := []vmTestCase{
+		{`build(newBuilder())`, ""},
+		{`let b = newBuilder(); append(b, "mon"); append(b, "key"); build(b)`, "monkey"},
+		{`build(append(append(newBuilder(), "a"), "b"))`, "ab"},
+		{`append(newBuilder(), 1)`, &object.Error{Message: "second argument to `append` must be STRING, got INTEGER"}},
+		{`append("a", "b")`, &object.Error{Message: "first argument to `append` must be STRING_BUILDER, got STRING"}},
+		{`build("a")`, &object.Error{Message: "argument to `build` must be STRING_BUILDER, got STRING"}},
+		{`newBuilder(1)`, &object.Error{Message: "wrong number of arguments. got=1, want=0"}},
+	}
+	runVmTests(t, tests)
+
+	built := runProgram(t, `
+		let b = newBuilder();
+		for (let i = 0; i < 2000; i = i + 1) { append(b, "ab"); }
+		build(b)
+	`)
+	concatenated := runProgram(t, `
+		let s = "";
+		for (let i = 0; i < 2000; i = i + 1) { s = s + "ab"; }
+		s
+	`)
+
+	err := testStringObject(concatenated.Inspect(), built)
+	if err != nil {
+		t.Errorf("builder and concatenation disagree: %s", err)
+	}
+	if len(concatenated.Inspect()) != 4000 {
+		t.Errorf("wrong length of concatenated string. want=4000, got=%d", len(concatenated.Inspect()))
+	}
+}
+
+// TestLists verifies the mutable list builtins.
+func TestLists(t *testing.T) {
+	tests := []vmTestCase{
+		{`toArray(newList())`, []int{}},
+		{`let l = newList(); listPush(l, 1); listPush(l, 2); toArray(l)`, []int{1, 2}},
+		{`let l = listPush(listPush(newList(), 1), 2); listLen(l)`, 2},
+		{`let l = listPush(newList(), 1); listGet(l, 0)`, 1},
+		{`let l = listPush(newList(), 1); listGet(l, 1)`, Null},
+		{`let l = listPush(newList(), 1); listGet(l, -1)`, Null},
+		{`let l = listPush(newList(), 1); listSet(l, 0, 5); toArray(l)`, []int{5}},
+		{
+			// toArray copies, so later changes to the list do not affect the array.
+			`let l = listPush(newList(), 1); let a = toArray(l); listSet(l, 0, 2); a`,
+			[]int{1},
+		},
+		{
+			`
+			let l = newList();
+			for (let i = 0; i < 10000; i = i + 1) { listPush(l, i * 2); }
+			let a = toArray(l);
+			[len(a), listLen(l), a[9999], listGet(l, 5000)]
+			`,
+			[]int{10000, 10000, 19998, 10000},
+		},
+		{`listSet(newList(), 0, 1)`, &object.Error{Message: "index out of range: 0 (list length 0)"}},
+		{`listPush([], 1)`, &object.Error{Message: "first argument to `listPush` must be LIST, got ARRAY"}},
+		{`listGet(newList(), "a")`, &object.Error{Message: "second argument to `listGet` must be INTEGER, got STRING"}},
+		{`listLen([])`, &object.Error{Message: "argument to `listLen` must be LIST, got ARRAY"}},
+		{`toArray([])`, &object.Error{Message: "argument to `toArray` must be LIST, got ARRAY"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestSets verifies the set builtins.
+func TestSets(t *testing.T) {
+	tests := []vmTestCase{
+		{`setSize(newSet())`, 0},
+		{`let s = newSet(); setAdd(s, 1); setAdd(s, 2); setSize(s)`, 2},
+		{`let s = newSet(); setAdd(s, 1); setAdd(s, 1); setAdd(s, 1); setSize(s)`, 1},
+		{`let s = setAdd(newSet(), "a"); setHas(s, "a")`, true},
+		{`let s = setAdd(newSet(), "a"); setHas(s, "b")`, false},
+		{`let s = setAdd(newSet(), 1); setHas(s, "1")`, false},
+		{`let s = setAdd(newSet(), true); setRemove(s, true)`, true},
+		{`let s = setAdd(newSet(), true); setRemove(s, true); setHas(s, true)`, false},
+		{`let s = setAdd(newSet(), true); setRemove(s, true); setSize(s)`, 0},
+		{`let s = setAdd(newSet(), 1); setRemove(s, 2)`, false},
+		{`let s = setAdd(newSet(), 1); setHas(s, 1) == true`, true},
+		{`let s = setAdd(newSet(), 1); if (setHas(s, 2)) { 1 } else { 2 }`, 2},
+		{`let s = setAdd(setAdd(setAdd(newSet(), 3), 1), 2); setRemove(s, 1); setAdd(s, 3); setToArray(s)`, []int{3, 2}},
+		{
+			`
+			let s = newSet();
+			for (let i = 0; i < 100; i = i + 1) { setAdd(s, i / 10); }
+			setToArray(s)
+			`,
+			[]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{`setAdd(newSet(), [1])`, &object.Error{Message: "unusable as set element: ARRAY"}},
+		{`setHas(newSet(), fn() {})`, &object.Error{Message: "unusable as set element: CLOSURE"}},
+		{`setAdd([], 1)`, &object.Error{Message: "first argument to `setAdd` must be SET, got ARRAY"}},
+		{`setSize([])`, &object.Error{Message: "argument to `setSize` must be SET, got ARRAY"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestRange verifies the range builtin.
+func TestRange(t *testing.T) {
+	tests := []vmTestCase{
+		{`range(3)`, []int{0, 1, 2}},
+		{`range(0)`, []int{}},
+		{`range(-2)`, []int{}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(5, 2)`, []int{}},
+		{`range(0, 10, 2)`, []int{0, 2, 4, 6, 8}},
+		{`range(0, 9, 3)`, []int{0, 3, 6}},
+		{`range(5, 0, -2)`, []int{5, 3, 1}},
+		{`range(3, 3, -1)`, []int{}},
+		{`len(range(0, 20000001, 1000))`, 20001},
+		{`range(9223372036854775806, 9223372036854775807, 5)`, []int{9223372036854775806}},
+		{`let sum = 0; let r = range(1, 101); for (let i = 0; i < len(r); i = i + 1) { sum = sum + r[i]; } sum`, 5050},
+		{`range()`, &object.Error{Message: "wrong number of arguments. got=0, want=1..3"}},
+		{`range(1, 2, 3, 4)`, &object.Error{Message: "wrong number of arguments. got=4, want=1..3"}},
+		{`range("3")`, &object.Error{Message: "arguments to `range` must be INTEGER, got STRING"}},
+		{`range(0, 10, 0)`, &object.Error{Message: "`range` step must not be zero"}},
+		{`range(0, 10, -1)`, &object.Error{Message: "`range` step -1 does not lead from 0 to 10"}},
+		{`range(10, 0, 1)`, &object.Error{Message: "`range` step 1 does not lead from 10 to 0"}},
+		{`range(10000001)`, &object.Error{Message: "`range` of 10000001 elements exceeds the maximum of 10000000"}},
+		{
+			`range(-9223372036854775807, 9223372036854775807)`,
+			&object.Error{Message: "`range` of 18446744073709551614 elements exceeds the maximum of 10000000"},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// TestPopBuiltin verifies that pop returns the array without its last element along with that element,
+// leaving the original unchanged.
+func TestPopBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{`pop([1, 2, 3])[0]`, []int{1, 2}},
+		{`pop([1, 2, 3])[1]`, 3},
+		{`pop(["a"])[0]`, []int{}},
+		{`pop(["a"])[1]`, "a"},
+		{`let a = [1, 2]; pop(a); a`, []int{1, 2}},
+		{`let stack = push(push([], 1), 2); let top = pop(stack); pop(top[0])[1] + top[1]`, 3},
+		{`pop([])`, &object.Error{Message: "cannot pop from an empty array"}},
+		{`pop("abc")`, &object.Error{Message: "argument to `pop` must be ARRAY, got STRING"}},
+		{`pop([1], [2])`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestDeleteBuiltin verifies that delete returns a copy of the hash without the key and leaves the original unchanged.
+func TestDeleteBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys(delete({"a": 1, "b": 2, "c": 3}, "b"))`, []string{"a", "c"}},
+		{`values(delete({"a": 1, "b": 2, "c": 3}, "b"))`, []int{1, 3}},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); keys(h)`, []string{"a", "b"}},
+		{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); "a" in d`, false},
+		{`let h = {1: "x", true: "y"}; len(keys(delete(delete(h, 1), true)))`, 0},
+		{`let h = {"a": 1}; let d = delete(h, "missing"); h == d`, true},
+		{`delete([1], 0)`, &object.Error{Message: "first argument to `delete` must be HASH, got ARRAY"}},
+		{`delete({}, [1])`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`delete({})`, &object.Error{Message: "wrong number of arguments. got=1, want=2"}},
+	}
+	runVmTests(t, tests)
+
+	// Deleting a missing key returns a copy, not the hash itself.
+	result := runProgram(t, `let h = {"a": 1}; let d = delete(h, "missing"); d["b"] = 2; h`)
+	if result.Inspect() != "{a: 1}" {
+		t.Errorf("original hash was modified. want=%q, got=%q", "{a: 1}", result.Inspect())
+	}
+}
+
+// TestSetAndHasBuiltins verifies that set returns a copy of the hash with the pair inserted or overwritten,
+// leaving the original unchanged, and that has reports whether a key is present.
+func TestSetAndHasBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`let h = set({"a": 1}, "b", 2); [h["a"], h["b"]]`, []int{1, 2}},
+		{`keys(set({"a": 1, "b": 2}, "c", 3))`, []string{"a", "b", "c"}},
+		{`values(set({"a": 1, "b": 2}, "a", 10))`, []int{10, 2}},
+		{`keys(set({"a": 1, "b": 2}, "a", 10))`, []string{"a", "b"}},
+		{`let h = {"a": 1}; set(h, "a", 5); set(h, "b", 2); h == {"a": 1}`, true},
+		{`set({}, 1, "one")[1]`, "one"},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": null}, "a")`, true},
+		{`has(set({}, true, 0), true)`, true},
+		{`has(delete({"a": 1}, "a"), "a")`, false},
+		{`set([], 0, 1)`, &object.Error{Message: "first argument to `set` must be HASH, got ARRAY"}},
+		{`set({}, {}, 1)`, &object.Error{Message: "unusable as hash key: HASH"}},
+		{`set({}, "a")`, &object.Error{Message: "wrong number of arguments. got=2, want=3"}},
+		{`has("a", "a")`, &object.Error{Message: "first argument to `has` must be HASH, got STRING"}},
+		{`has({}, fn() {})`, &object.Error{Message: "unusable as hash key: CLOSURE"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestHashOrder verifies that hashes, and the keys and values builtins, iterate in insertion order.
+func TestHashOrder(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys({})`, []int{}},
+		{`keys({1: 10, 2: 20, 3: 30, 4: 40, 5: 50})`, []int{1, 2, 3, 4, 5}},
+		{`values({1: 10, 2: 20, 3: 30, 4: 40, 5: 50})`, []int{10, 20, 30, 40, 50}},
+		{`let h = {"a": 1, "b": 2, "c": 3}; values(h)`, []int{1, 2, 3}},
+		{`keys([])`, &object.Error{Message: "argument to `keys` must be HASH, got ARRAY"}},
+		{`values(1)`, &object.Error{Message: "argument to `values` must be HASH, got INTEGER"}},
+	}
+	runVmTests(t, tests)
+
+	// Map iteration order is random, so a hash that does not keep its order
+	// would almost certainly print differently across runs.
+	input := `{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 8}`
+	expected := "{a: 1, b: 2, c: 3, d: 4, e: 5, f: 6, g: 7, h: 8}"
+	for range 20 {
+		result := runProgram(t, input)
+		if result.Inspect() != expected {
+			t.Fatalf("wrong hash order. want=%q, got=%q", expected, result.Inspect())
+		}
+	}
+}
+
 // TestClosures verifies the functionality of closures and nested functions in the virtual machine.
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
@@ -688,6 +1250,126 @@ func TestClosures(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestClosuresInHashes verifies that functions stored in hashes can be retrieved and called like methods.
+func TestArrowFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let inc = (x) => x + 1; inc(1)", 2},
+		{"let five = () => 5; five()", 5},
+		{"let add = (a, b) => a + b; add(2, 3)", 5},
+		{"map([1, 2, 3], (x) => x * x)", []int{1, 4, 9}},
+		{"filter([1, 2, 3, 4], (x) => x > 2)", []int{3, 4}},
+		{"reduce([1, 2, 3], (acc, x) => acc + x, 0)", 6},
+		{"let adder = (x) => (y) => x + y; adder(2)(3)", 5},
+		{"let f = (x) => { let y = x * 2; y + 1 }; f(4)", 9},
+		{"let fact = (n) => n < 2 ? 1 : n * fact(n - 1); fact(5)", 120},
+	}
+	runVmTests(t, tests)
+}
+
+// TestFunctionInspect verifies that named, anonymous and capturing functions print their signatures.
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let add = fn(a, b) { a + b }; add`, "fn add(2 params)"},
+		{`fn(x) { x }`, "fn(1 param)"},
+		{`let newAdder = fn(a, b) { fn(c) { a + b + c } }; newAdder(1, 2)`, "fn(1 param) with 2 free variables"},
+	}
+
+	for _, tt := range tests {
+		result := runProgram(t, tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong Inspect. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestClosuresInHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`let obj = {"double": fn(x) { x * 2 }}; obj["double"](21)`, 42},
+		{`let obj = {"greet": fn(name) { "hi " + name }}; obj["greet"]("bob")`, "hi bob"},
+		{`{"len": len}["len"]("four")`, 4},
+		{
+			`
+			let newCounter = fn(start) {
+				let step = 2;
+				{"next": fn() { start + step }, "reset": fn() { start }}
+			};
+			let counter = newCounter(10);
+			counter["next"]() + counter["reset"]()
+			`,
+			22,
+		},
+		{
+			`
+			let makeGreeter = fn(greeting) {
+				{"greet": fn(name) { greeting + ", " + name }}
+			};
+			let greeters = [makeGreeter("hello"), makeGreeter("bye")];
+			greeters[1]["greet"]("bob")
+			`,
+			"bye, bob",
+		},
+		{
+			`
+			let ops = {"add": fn(a, b) { a + b }, "mul": fn(a, b) { a * b }};
+			let apply = fn(op, a, b) { ops[op](a, b) };
+			apply("add", 2, 3) * apply("mul", 2, 3)
+			`,
+			30,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// TestMethodCalls verifies that obj.method(args) passes obj as the first argument, bound to self by convention,
+// and that obj.field reads obj["field"].
+func TestMethodCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`let rect = {"width": 3, "height": 4}; rect.width * rect.height`, 12},
+		{`let rect = {"width": 3, "area": fn(self) { self.width * self["height"] }, "height": 4}; rect.area()`, 12},
+		{
+			`
+			let counter = {
+				"count": 0,
+				"add": fn(self, n) { self.count += n; self },
+			};
+			counter.add(2).add(3).count
+			`,
+			5,
+		},
+		{
+			`
+			let newAccount = fn(balance) {
+				{
+					"balance": balance,
+					"deposit": fn(self, amount) { self.balance = self.balance + amount; self.balance },
+					"describe": fn(self) { "balance: " + str(self.deposit(0)) },
+				}
+			};
+			let account = newAccount(10);
+			account.deposit(5);
+			account.describe()
+			`,
+			"balance: 15",
+		},
+		{
+			// The receiver is evaluated once.
+			`
+			let calls = [0];
+			let obj = {"id": fn(self) { self.value }, "value": 7};
+			let get = fn() { calls[0] += 1; obj };
+			[get().id(), calls[0]]
+			`,
+			[]int{7, 1},
+		},
+		{`let obj = {"inner": {"name": fn(self) { "inner" }}}; obj.inner.name()`, "inner"},
+		{`let obj = {"missing": 1}; obj.other`, Null},
+	}
+	runVmTests(t, tests)
+}
+
 // TestRecursiveFunctions tests the VM's ability to correctly evaluate recursive function calls and returns expected outcomes.
 func TestRecursiveFunctions(t *testing.T) {
 	tests := []vmTestCase{
@@ -740,6 +1422,31 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestTailCalls tests that self-recursive tail calls reuse their frame, so that they can recurse
+// far deeper than the frame limit, while other calls in tail position behave as usual.
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(100000);
+			`,
+			expected: 0,
+		},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } sum(n - 1, acc + n) }; sum(100000, 0)`, 5000050000},
+		{`let f = fn(n, acc) { let x = n * 2; if (n == 0) { return acc; } return f(n - 1, acc + x); }; f(3, 0)`, 12},
+		{`let f = fn(n) { if (n == 0) { return "done"; } let g = fn(m) { f(m) }; g(n - 1) }; f(10)`, "done"},
+		{`let f = fn(n) { if (n == 0) { return 0 } else { n + f(n - 1) } }; f(3)`, 6},
+	}
+	runVmTests(t, tests)
+}
+
 // TestRecursiveFibonacci tests the evaluation of a recursive Fibonacci function executed in the virtual machine.
 func TestRecursiveFibonacci(t *testing.T) {
 	tests := []vmTestCase{
@@ -776,3 +1483,1087 @@ func TestComparisonOperators(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+// TestAssignments verifies that assignments update global and local variables.
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 41; x", 42},
+		{"let f = fn() { let x = 1; x = x * 10; x }; f()", 10},
+		{"let x = 1; let f = fn() { x = 5; }; f(); x", 5},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; if (true) { x = 2; }", Null},
+		{"if (false) { 10 } else { let y = 2; }", Null},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIncDecStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 1; i++; i", 2},
+		{"let i = 1; i--; i--; i", -1},
+		{"let f = fn() { let n = 10; n++; n++; n }; f()", 12},
+		{"let n = 0; let f = fn() { n--; }; f(); f(); n", -2},
+		{"let total = 0; for (let i = 0; i < 5; i++) { total += i; } total", 10},
+		{"let i = 3; let total = 0; while (i > 0) { total += i; i-- } total", 6},
+		{"let i = 1; i++; i + --2", 4},
+		{`let s = "a"; s++`, &object.Error{Message: "unsupported operation: STRING + INTEGER"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestIndexAssignments verifies assignments and compound assignments to array elements, hash values and variables.
+func TestIndexAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[0] = 10; a", []int{10, 2, 3}},
+		{"let a = [1, 2, 3]; a[-1] = 30; a", []int{1, 2, 30}},
+		{"let a = [1, 2, 3]; a[1] += 5; a[2] *= 2; a[0] -= 1; a", []int{0, 7, 6}},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 7; a", []int{7, 2, 3}},
+		{"let h = {\"a\": 1}; let g = h; g[\"a\"] = 2; h[\"a\"]", 2},
+		{"let a = [1, 2]; let b = push(a, 3); b[0] = 9; a", []int{1, 2}},
+		{"let h = {\"a\": 1}; let g = set(h, \"b\", 2); g[\"a\"] = 5; h[\"a\"]", 1},
+		{"let f = memoize(fn(n) { [n] }); let a = f(1); a[0] = 7; f(1)", []int{7}},
+		{"let grid = [[1, 2], [3, 4]]; grid[1][0] += 10; grid[1]", []int{13, 4}},
+		{"let h = {\"a\": 1}; h[\"a\"] += 1; h[\"b\"] = 5; h[\"a\"] * 10 + h[\"b\"]", 25},
+		{"let f = fn(a) { a[0] /= 2; a }; f([10])", []int{5}},
+		{"let x = 1; x += 2; x *= 5; x -= 3; x /= 4; x", 3},
+		{"let x = 17; x %= 5; x", 2},
+		{"let a = [7, 9]; a[1] %= 4; a", []int{7, 1}},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"let total = 0; for (let i = 1; i <= 4; i += 1) { total += i; } total", 10},
+	}
+	runVmTests(t, tests)
+}
+
+// TestCompoundIndexAssignmentEvaluatesOnce verifies that a compound index assignment
+// evaluates its collection and index expressions only once.
+func TestCompoundIndexAssignmentEvaluatesOnce(t *testing.T) {
+	input := `
+	let calls = [0, 0];
+	let arr = [10, 20, 30];
+	let collection = fn() { calls[0] += 1; arr };
+	let compute = fn() { calls[1] += 1; 1 };
+	collection()[compute()] += 5;
+	[arr[1], calls[0], calls[1]]
+	`
+	runVmTests(t, []vmTestCase{{input, []int{25, 1, 1}}})
+}
+
+// TestIndexAssignmentErrors verifies the runtime errors of invalid index assignments.
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[1] = 2;", "index out of range: 1"},
+		{"let a = [1]; a[-2] = 2;", "index out of range: -2"},
+		{"let a = [1]; a[\"x\"] = 2;", "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[1]] = 2;", "unusable as hash key: ARRAY"},
+		{"let s = \"abc\"; s[0] = \"x\";", "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("%q: expected VM error but resulted in none.", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestStackManipulation verifies OpDup and OpSwap on hand-assembled bytecode.
+func TestStackManipulation(t *testing.T) {
+	// Computes (2 - 1) * (1 - 2) from the constants 1 and 2.
+	instructions := slices.Concat(
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpDup, 2),
+		code.Make(code.OpSwap),
+		code.Make(code.OpSub),
+		code.Make(code.OpSwap),
+		code.Make(code.OpSwap),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpSub),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpMul),
+		code.Make(code.OpPop),
+	)
+	bytecode := &compiler.Bytecode{
+		Instructions: instructions,
+		Constants:    []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}},
+	}
+
+	vm := New(bytecode)
+	err := vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	err = testIntegerObject(-1, vm.LastPoppedStackItem())
+	if err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
+// TestGlobalsStore verifies that every two-byte global index fits the globals store,
+// and that a store smaller than GlobalsSize fails with an error before running, instead of panicking.
+func TestGlobalsStore(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: slices.Concat(
+			code.Make(code.OpTrue),
+			code.Make(code.OpSetGlobal, GlobalsSize-1),
+			code.Make(code.OpGetGlobal, GlobalsSize-1),
+			code.Make(code.OpPop),
+		),
+	}
+	globals := make([]object.Object, GlobalsSize)
+	vm := NewWithGlobalsStore(bytecode, globals)
+	err := vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	err = testBooleanObject(true, vm.LastPoppedStackItem())
+	if err != nil {
+		t.Errorf("testBooleanObject failed: %s", err)
+	}
+	if globals[GlobalsSize-1] != True {
+		t.Errorf("global not stored in the store passed to NewWithGlobalsStore. got=%v", globals[GlobalsSize-1])
+	}
+
+	vm = NewWithGlobalsStore(bytecode, make([]object.Object, 4))
+	err = vm.Run()
+	expected := "globals store holds 4 globals, want 65536"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong VM error: want=%q, got=%v", expected, err)
+	}
+	if vm.InstructionsExecuted() != 0 {
+		t.Errorf("executed %d instructions before failing", vm.InstructionsExecuted())
+	}
+}
+
+// TestInvalidBytecodeErrors verifies that hand-assembled bytecode which passes verification but calls nothing,
+// reads a missing free variable or returns from the main frame fails with an error instead of panicking.
+func TestInvalidBytecodeErrors(t *testing.T) {
+	readFree := &object.CompiledFunction{
+		Instructions: slices.Concat(code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue)),
+	}
+	tests := []struct {
+		name         string
+		instructions code.Instructions
+		expected     string
+	}{
+		{"OpCall", code.Make(code.OpCall, 0), "call with 0 arguments has no callee"},
+		{
+			"OpGetFree",
+			slices.Concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpCall, 0)),
+			"free variable 0 out of range (0 free variables)",
+		},
+		{"OpClosure", code.Make(code.OpClosure, 0, 3), "closure with 3 free variables has only 0 values on the stack"},
+		{"OpReturn", code.Make(code.OpReturn), "return outside function"},
+		{"OpReturnValue", slices.Concat(code.Make(code.OpNull), code.Make(code.OpReturnValue)), "return outside function"},
+	}
+
+	for _, tt := range tests {
+		bytecode := &compiler.Bytecode{
+			Instructions: tt.instructions,
+			Constants:    []object.Object{readFree},
+		}
+		if err := bytecode.Verify(); err != nil {
+			t.Fatalf("%s: bytecode does not pass verification: %s", tt.name, err)
+		}
+
+		err := New(bytecode).Run()
+		if err == nil {
+			t.Errorf("%s: expected VM error but resulted in none.", tt.name)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong VM error: want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// TestWhileLoops verifies while loops, including break and continue.
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { i = i + 1; } i", 10},
+		{"let i = 0; while (i <= 5000) { i = i + 1; } i", 5001},
+		{"let i = 0; while (false) { i = i + 1; } i", 0},
+		// Labeled jumps to an outer loop from a dropped body must not be patched into the code after it.
+		{
+			`let i = 0; let seen = [];
+			outer: while (i < 3) { i = i + 1; while (false) { break outer; } seen = push(seen, i); }
+			seen`,
+			[]int{1, 2, 3},
+		},
+		{
+			`let seen = [];
+			outer: for (let i = 0; i < 3; i = i + 1) { while (false) { continue outer; } seen = push(seen, i); }
+			seen`,
+			[]int{0, 1, 2},
+		},
+		{"let i = 0; while (true) { i = i + 1; if (i == 7) { break; } } i", 7},
+		{
+			`
+			let i = 0;
+			let sum = 0;
+			while (i < 10) {
+				i = i + 1;
+				if (i > 5) { continue; }
+				sum = sum + i;
+			}
+			sum
+			`,
+			15,
+		},
+		{
+			`
+			let f = fn(n) {
+				let total = 0;
+				while (n > 0) {
+					total = total + n;
+					n = n - 1;
+				}
+				total
+			};
+			f(100)
+			`,
+			5050,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// TestForLoops verifies for loops, including break and continue.
+func TestForLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			let found = [];
+			outer: for (let i = 0; i < 4; i++) {
+				for (let j = 0; j < 4; j++) {
+					if (j == 2) { continue outer; }
+					if (i == 2) { break outer; }
+					found = push(found, i * 10 + j);
+				}
+			}
+			found
+			`,
+			[]int{0, 1, 10, 11},
+		},
+		{
+			"let n = 0; loop: while (true) { while (true) { n++; if (n > 3) { break loop; } } } n",
+			4,
+		},
+		{"let sum = 0; for (let i = 1; i <= 10; i = i + 1) { sum = sum + i; } sum", 55},
+		{"let i = 0; for (; i < 3;) { i = i + 1; } i", 3},
+		{"let i = 0; for (;;) { i = i + 1; if (i == 4) { break; } } i", 4},
+		{
+			// continue must still run the post statement, or the loop never terminates.
+			`
+			let sum = 0;
+			let posts = 0;
+			for (let i = 0; i < 10; i = i + 1) {
+				posts = posts + 1;
+				if (i == 2) { continue; }
+				if (i == 4) { continue; }
+				sum = sum + i;
+			}
+			[sum, posts, i]
+			`,
+			[]int{39, 10, 10},
+		},
+		{
+			`
+			let count = 0;
+			for (let i = 0; i < 5; i = i + 1) {
+				for (let j = 0; j < 5; j = j + 1) {
+					if (j > i) { break; }
+					count = count + 1;
+				}
+			}
+			count
+			`,
+			15,
+		},
+		{
+			`
+			let evens = fn(n) {
+				let found = [];
+				for (let i = 0; i < n; i = i + 1) {
+					if (i / 2 * 2 != i) { continue; }
+					found = push(found, i);
+				}
+				found
+			};
+			evens(7)
+			`,
+			[]int{0, 2, 4, 6},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// TestSerializedBytecode verifies that serialized and deserialized bytecode runs with the same result.
+func TestSerializedBytecode(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 + 2 * 3", 7},
+		{`"mon" + "key"`, "monkey"},
+		{"let x = true; if (x) { 10 } else { 20 }", 10},
+		{
+			`
+			let fibonacci = fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2)
+			};
+			fibonacci(15);
+			`,
+			610,
+		},
+		{
+			`
+			let newAdder = fn(a) { fn(b) { a + b } };
+			let addTwo = newAdder(2);
+			[addTwo(1), addTwo(40)];
+			`,
+			[]int{3, 42},
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		data, err := comp.Bytecode().Serialize()
+		if err != nil {
+			t.Fatalf("serialize error: %s", err)
+		}
+
+		bytecode, err := compiler.Deserialize(data)
+		if err != nil {
+			t.Fatalf("deserialize error: %s", err)
+		}
+
+		vm := New(bytecode)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackItem())
+	}
+}
+
+// TestCompactedBytecode verifies that bytecode runs with the same result after compaction,
+// and that the compiler already drops the constants of code it drops, leaving none to remove.
+func TestCompactedBytecode(t *testing.T) {
+	tests := []vmTestCase{
+		{"while (false) { 99 } 1 + 2", 3},
+		{
+			`
+			let newAdder = fn(a) { while (false) { puts("never") } fn(b) { a + b + 100 } };
+			while (false) { newAdder(0)(0) }
+			let addTwo = newAdder(2);
+			[addTwo(1), addTwo(40)];
+			`,
+			[]int{103, 142},
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode, err := comp.Bytecode().CompactConstants()
+		if err != nil {
+			t.Fatalf("compaction error: %s", err)
+		}
+		if len(bytecode.Constants) != len(comp.Bytecode().Constants) {
+			t.Errorf("%q: unused constants left by the compiler. got=%d, want=%d",
+				tt.input, len(comp.Bytecode().Constants), len(bytecode.Constants))
+		}
+
+		vm := New(bytecode)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackItem())
+	}
+}
+
+// TestMemoizedFunctions tests that `@memoize` and the `memoize` builtin cache results transparently.
+func TestMemoizedFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			// Without memoization this would take billions of calls.
+			`
+			let fibonacci = @memoize fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2)
+			};
+			fibonacci(60);
+			`,
+			1548008755920,
+		},
+		{
+			`
+			let wrapper = fn() {
+				let fibonacci = @memoize fn(x) {
+					if (x < 2) { return x; }
+					fibonacci(x - 1) + fibonacci(x - 2)
+				};
+				fibonacci(60);
+			};
+			wrapper();
+			`,
+			1548008755920,
+		},
+		{
+			// Recursive calls of a local memoized function go through the cache: one call per argument.
+			`
+			let calls = 0;
+			let wrapper = fn() {
+				let fibonacci = @memoize fn(x) {
+					calls = calls + 1;
+					if (x < 2) { return x; }
+					fibonacci(x - 1) + fibonacci(x - 2)
+				};
+				[fibonacci(20), fibonacci(20), calls];
+			};
+			wrapper();
+			`,
+			[]int{6765, 6765, 21},
+		},
+		{
+			// An anonymous local annotated function has no name to bind, and is only wrapped.
+			`let f = fn() { map([2, 2, 3], @memoize fn(x) { x * 2 }) }; f()`,
+			[]int{4, 4, 6},
+		},
+		{`let double = memoize(fn(x) { x * 2 }); [double(2), double(2), double(5)]`, []int{4, 4, 10}},
+		{`let l = memoize(len); l("four") + l([1])`, 5},
+		{`memoize(fn(a, b) { a + b })("mon", "key")`, "monkey"},
+		{`memoize(fn(a) { len(a) })([1, 2])`, 2},
+		{
+			`memoize(1)`,
+			&object.Error{Message: "argument to `memoize` must be a function, got INTEGER"},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// TestHigherOrderBuiltins verifies map, filter and reduce, which call back into Monkey functions.
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x * 2 })`, []int{}},
+		{`map(["a", "bb", "ccc"], len)`, []int{1, 2, 3}},
+		{`let factor = 3; map([1, 2], fn(x) { x * factor })`, []int{3, 6}},
+		{`filter([1, 2, 3, 4, 5, 6], fn(x) { x / 2 * 2 == x })`, []int{2, 4, 6}},
+		{`filter([1, 2, 3], fn(x) { false })`, []int{}},
+		{`filter([1, 2, 3], fn(x) { if (x > 1) { x } })`, []int{2, 3}},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 0)`, 10},
+		{`reduce([], fn(acc, x) { acc + x }, 42)`, 42},
+		{`reduce(["a", "b"], fn(acc, x) { acc + x }, "")`, "ab"},
+		{
+			`
+			let sumOfSquaresOfOdds = fn(numbers) {
+				let odds = filter(numbers, fn(x) { x / 2 * 2 != x });
+				reduce(map(odds, fn(x) { x * x }), fn(acc, x) { acc + x }, 0)
+			};
+			sumOfSquaresOfOdds(range(1, 8))
+			`,
+			84,
+		},
+		{`map([[1, 2], [3]], fn(xs) { reduce(map(xs, fn(x) { x * 10 }), fn(a, b) { a + b }, 0) })`, []int{30, 30}},
+		{`map(1, fn(x) { x })`, &object.Error{Message: "first argument to `map` must be ARRAY, got INTEGER"}},
+		{`filter([1], 1)`, &object.Error{Message: "second argument to `filter` must be a function, got INTEGER"}},
+		{`reduce([1], fn(a, b) { a })`, &object.Error{Message: "wrong number of arguments. got=2, want=3"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestSortBuiltin verifies that sort orders numbers and strings, or calls a comparator,
+// and returns a new array.
+func TestSortBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([5, -1, 0, 5, -10])`, []int{-10, -1, 0, 5, 5}},
+		{`sort([])`, []int{}},
+		{`sort(["pear", "apple", "fig"])`, []string{"apple", "fig", "pear"}},
+		{`let s = sort([3, sqrt(2), 1]); [s[0], s[2]]`, []int{1, 3}},
+		{`let a = [2, 1]; sort(a); a`, []int{2, 1}},
+		{`sort([1, 3, 2], fn(a, b) { b - a })`, []int{3, 2, 1}},
+		{`sort(["ccc", "a", "bb"], fn(a, b) { len(a) - len(b) })`, []string{"a", "bb", "ccc"}},
+		// Elements that compare equal keep their order.
+		{`sort(["bb", "a", "cc", "b"], fn(a, b) { len(a) - len(b) })`, []string{"a", "b", "bb", "cc"}},
+		{`map(sort([{"n": 2}, {"n": 1}], fn(a, b) { a.n - b.n }), fn(h) { h.n })`, []int{1, 2}},
+		{`sort([1, "a"])`, &object.Error{Message: "`sort` cannot order STRING and INTEGER without a comparator"}},
+		{`sort([[1], [2]])`, &object.Error{Message: "`sort` cannot order ARRAY and ARRAY without a comparator"}},
+		{`sort([1, 2], fn(a, b) { a > b })`, &object.Error{Message: "comparator of `sort` must return INTEGER, got BOOLEAN"}},
+		{`sort("abc")`, &object.Error{Message: "argument to `sort` must be ARRAY, got STRING"}},
+		{`sort([1], 1)`, &object.Error{Message: "second argument to `sort` must be a function, got INTEGER"}},
+		{`sort()`, &object.Error{Message: "wrong number of arguments. got=0, want=1..2"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestExitBuiltin verifies that exit stops the program with an [object.Exit] carrying its status,
+// including when it is called from a function passed to a higher-order builtin.
+func TestExitBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`exit()`, 0},
+		{`exit(3); puts("unreachable")`, 3},
+		{`let f = fn(n) { if (n > 1) { exit(n) } n }; f(1); f(42); 1`, 42},
+		{`map([1, 2, 3], fn(x) { if (x == 2) { exit(255) } x })`, 255},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		var exit *object.Exit
+		if !errors.As(err, &exit) {
+			t.Errorf("%q: expected an exit, got %v", tt.input, err)
+			continue
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("%q: wrong exit status. want=%d, got=%d", tt.input, tt.expected, exit.Code)
+		}
+	}
+
+	runVmTests(t, []vmTestCase{
+		{`exit("1")`, &object.Error{Message: "argument to `exit` must be INTEGER, got STRING"}},
+		{`exit(-1)`, &object.Error{Message: "argument to `exit` must be between 0 and 255, got -1"}},
+		{`exit(256)`, &object.Error{Message: "argument to `exit` must be between 0 and 255, got 256"}},
+		{`exit(1, 2)`, &object.Error{Message: "wrong number of arguments. got=2, want=0..1"}},
+	})
+}
+
+// TestFormatBuiltin verifies that format fills the placeholders of its template with its arguments in order.
+func TestFormatBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{`format("plain")`, "plain"},
+		{`format("{} + {} = {}", 1, 2, 1 + 2)`, "1 + 2 = 3"},
+		{`let name = "Kong"; format("hello, {}!", name)`, "hello, Kong!"},
+		{`format("{}{}", [1, "a"], {"k": true})`, "[1, a]{k: true}"},
+		{`format("{}", null)`, "null"},
+		{`format("{{}} is {}", "empty")`, "{} is empty"},
+		{`format("{{{}}}", 5)`, "{5}"},
+		{`format("{} {}", 1)`, &object.Error{Message: "`format` template has 2 placeholders, got 1 arguments"}},
+		{`format("{}", 1, 2)`, &object.Error{Message: "`format` template has 1 placeholders, got 2 arguments"}},
+		{`format("{x}", 1)`, &object.Error{Message: "unmatched `{` at offset 0 of `format` template"}},
+		{`format("a } b")`, &object.Error{Message: "unmatched `}` at offset 2 of `format` template"}},
+		{`format("{")`, &object.Error{Message: "unmatched `{` at offset 0 of `format` template"}},
+		{`format(1)`, &object.Error{Message: "first argument to `format` must be STRING, got INTEGER"}},
+		{`format()`, &object.Error{Message: "wrong number of arguments. got=0, want at least 1"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestHigherOrderBuiltinErrors verifies that a failing callback aborts the program.
+func TestHigherOrderBuiltinErrors(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`map([1, 2], fn(a, b) { a + b })`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	expected := "wrong number of arguments: want=2, got=1"
+	if err.Error() != expected {
+		t.Errorf("wrong VM error: want=%q, got=%q", expected, err)
+	}
+}
+
+// TestBuiltinErrorsAbort verifies that an error returned by a builtin stops the program
+// instead of being pushed as a value, including when the builtin is called from a higher-order builtin.
+func TestBuiltinErrorsAbort(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len()`, "wrong number of arguments. got=0, want=1"},
+		{`let x = len(1); puts("unreachable"); x`, "argument to `len` not supported, got INTEGER"},
+		{`[1, first(1), 3]`, "argument to `first` not supported, got INTEGER"},
+		{`let f = fn(a) { push(a, 1) }; f(1) + 1`, "argument to `push` not supported, got INTEGER"},
+		{`map([1, 2], len)`, "argument to `len` not supported, got INTEGER"},
+		{`map(["a", 2], fn(s) { len(s) })`, "argument to `len` not supported, got INTEGER"},
+		{`filter(1, fn(x) { x })`, "first argument to `filter` must be ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Errorf("%q: expected VM error but resulted in none.", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestMaxLoopIterations verifies that the loop iteration limit stops infinite loops but not shorter ones.
+func TestMaxLoopIterations(t *testing.T) {
+	tests := []struct {
+		input    string
+		limit    int
+		expected string
+	}{
+		{"while (true) { }", 100, "loop exceeded 100 iterations"},
+		{"let i = 0; while (true) { i = i + 1; continue; }", 100, "loop exceeded 100 iterations"},
+		{"for (let i = 0; i < 10; i = i + 1) { for (let j = 0; j < 10; j = j + 1) { } }", 100, "loop exceeded 100 iterations"},
+		{"for (let i = 0; i < 10; i = i + 1) { for (let j = 0; j < 9; j = j + 1) { } }", 100, ""},
+		{"let i = 0; while (i < 1000) { i = i + 1 }", 0, ""},
+		{"let f = fn() { f() }; f()", 100, "loop exceeded 100 iterations"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), WithMaxLoopIterations(tt.limit))
+		err = vm.Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected VM error: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%q: expected VM error but resulted in none.", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunWithLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		limit    int
+		expected string
+	}{
+		{"while (true) { }", 50, "instruction limit exceeded"},
+		{"let i = 0; while (i < 10) { i = i + 1 }", 20, "instruction limit exceeded"},
+		{"map([1, 2, 3], fn(x) { while (true) { } })", 100, "instruction limit exceeded"},
+		{"let i = 0; while (i < 10) { i = i + 1 }", 1000, ""},
+		{"let i = 0; while (i < 1000) { i = i + 1 }", 0, ""},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.RunWithLimit(tt.limit)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected VM error: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%q: expected VM error but resulted in none.", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+		if vm.InstructionsExecuted() != tt.limit+1 {
+			t.Errorf("%q: wrong number of instructions executed: want=%d, got=%d",
+				tt.input, tt.limit+1, vm.InstructionsExecuted())
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let i = 0; while (true) { i = i + 1 }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	vm := New(comp.Bytecode())
+	err = vm.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong VM error: want=%v, got=%v", context.DeadlineExceeded, err)
+	}
+
+	comp = compiler.New()
+	err = comp.Compile(parse("let i = 0; while (i < 10000) { i = i + 1 } i"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm = New(comp.Bytecode())
+	err = vm.RunContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected VM error: %s", err)
+	}
+	testExpectedObject(t, 10000, vm.LastPoppedStackItem())
+}
+
+func TestTimeout(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("while (true) { }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), WithTimeout(50*time.Millisecond))
+	start := time.Now()
+	err = vm.Run()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("VM took %s to time out", elapsed)
+	}
+	if err == nil || err.Error() != "execution timed out" {
+		t.Fatalf("wrong VM error: want=%q, got=%v", "execution timed out", err)
+	}
+
+	comp = compiler.New()
+	err = comp.Compile(parse("let i = 0; while (i < 10000) { i = i + 1 } i"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm = New(comp.Bytecode(), WithTimeout(time.Minute))
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("unexpected VM error: %s", err)
+	}
+	testExpectedObject(t, 10000, vm.LastPoppedStackItem())
+}
+
+// TestTimeBuiltins verifies that now does not go backwards, that sleep waits at least as long as asked,
+// and that both check their arguments.
+func TestTimeBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = now(); let b = now(); b >= a`, true},
+		{`let start = now(); sleep(20); now() - start >= 20`, true},
+		{`now() > 1700000000000`, true},
+		{`sleep(0)`, Null},
+		{`sleep(-1)`, &object.Error{Message: "argument to `sleep` must not be negative, got -1"}},
+		{`sleep("1")`, &object.Error{Message: "argument to `sleep` must be INTEGER, got STRING"}},
+		{`sleep()`, &object.Error{Message: "wrong number of arguments. got=0, want=1"}},
+		{`now(1)`, &object.Error{Message: "wrong number of arguments. got=1, want=0"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestSleepCancellation verifies that a stopped program does not wait for a long sleep to finish.
+func TestSleepCancellation(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("sleep(60000)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong VM error: want=%v, got=%v", context.DeadlineExceeded, err)
+	}
+
+	err = New(comp.Bytecode(), WithTimeout(50*time.Millisecond)).Run()
+	if err == nil || err.Error() != "execution timed out" {
+		t.Errorf("wrong VM error: want=%q, got=%v", "execution timed out", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sleep was not interrupted, took %s", elapsed)
+	}
+}
+
+// TestStackOverflow verifies that unbounded recursion stops with an error instead of a panic,
+// whether the call stack or the value stack runs out first.
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { f() + 1 }; f()", "maximum call depth exceeded"},
+		{"let f = fn(n) { f(n - 1) + 1 }; f(0)", "stack overflow"},
+		{"map([1], fn(x) { let f = fn() { f() + 1 }; f() })", "maximum call depth exceeded"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "stack overflow"},
+		{"let f = fn(a, b, c) { let d = [a, b, c]; [f(a, b, d)] }; f(1, 2, 3)", "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Errorf("%q: expected VM error but resulted in none.", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestStackDepth verifies that the stack is empty after a program and while no function is active.
+func TestStackDepth(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let f = fn(a) { let b = a * 2; b }; f(1); [1, 2, 3]"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if vm.StackDepth() != 0 {
+		t.Errorf("wrong stack depth before running: want=0, got=%d", vm.StackDepth())
+	}
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if vm.StackDepth() != 0 {
+		t.Errorf("wrong stack depth after running: want=0, got=%d", vm.StackDepth())
+	}
+}
+
+func TestAddImmediate(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a + 2", 3},
+		{"let a = -5; a + 65535", 65530},
+		{"let f = fn(a) { a += 10; a++; a }; f(1)", 12},
+		{`let s = "a"; s + 1`, &object.Error{Message: "unsupported operation: STRING + INTEGER"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestUnsupportedOperations verifies the errors for binary operations on operands of unsupported types,
+// which name the operator and the operand types.
+func TestUnsupportedOperations(t *testing.T) {
+	tests := []vmTestCase{
+		{`"hi" - 1`, &object.Error{Message: "unsupported operation: STRING - INTEGER"}},
+		{`let s = "hi"; s * s`, &object.Error{Message: "unsupported operation: STRING * STRING"}},
+		{`let s = "hi"; s / "h"`, &object.Error{Message: "unsupported operation: STRING / STRING"}},
+		{`1 + true`, &object.Error{Message: "unsupported operation: INTEGER + BOOLEAN"}},
+		{`[1] + null`, &object.Error{Message: "unsupported operation: ARRAY + NULL"}},
+		{`let f = fn() { 1 }; f - 1`, &object.Error{Message: "unsupported operation: CLOSURE - INTEGER"}},
+		{`let b = true; b > false`, &object.Error{Message: "unsupported operation: BOOLEAN > BOOLEAN"}},
+		{`"a" > "b"`, &object.Error{Message: "unsupported operation: STRING > STRING"}},
+		{`{} > 1`, &object.Error{Message: "unsupported operation: HASH > INTEGER"}},
+		{`"a" < 1`, &object.Error{Message: "unsupported operation: STRING < INTEGER"}},
+		{`"hi" < 1`, &object.Error{Message: "unsupported operation: STRING < INTEGER"}},
+		{`let a = "a"; a <= 1`, &object.Error{Message: "unsupported operation: STRING <= INTEGER"}},
+		{`[1] >= 1`, &object.Error{Message: "unsupported operation: ARRAY >= INTEGER"}},
+		{`1 >= [1]`, &object.Error{Message: "unsupported operation: INTEGER >= ARRAY"}},
+		{`let b = true; 1 <= b`, &object.Error{Message: "unsupported operation: INTEGER <= BOOLEAN"}},
+		{`1 in {}.x`, &object.Error{Message: "unsupported operation: INTEGER in NULL"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestArrayConcatenation verifies that adding two arrays returns a new array with the elements of both.
+func TestArrayConcatenation(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2] + [3, 4]", []int{1, 2, 3, 4}},
+		{"[] + []", []int{}},
+		{"[1] + [] + [2]", []int{1, 2}},
+		{"let a = [1]; a += [2, 3]; a", []int{1, 2, 3}},
+		{"let a = [1, 2]; let b = a + [3]; b[0] = 10; a", []int{1, 2}},
+		{"let a = [1, 2]; let b = [3] + a; b[1] = 10; a", []int{1, 2}},
+		{`let f = fn(n) { if (n == 0) { [] } else { f(n - 1) + [n] } }; f(3)`, []int{1, 2, 3}},
+		{"[1] + 2", &object.Error{Message: "unsupported operation: ARRAY + INTEGER"}},
+		{"2 + [1]", &object.Error{Message: "unsupported operation: INTEGER + ARRAY"}},
+		{"[1] - [1]", &object.Error{Message: "unsupported operation: ARRAY - ARRAY"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestFloatOperations verifies arithmetic, comparison and negation of floats, and of integers mixed with floats.
+func TestFloatOperations(t *testing.T) {
+	tests := []vmTestCase{
+		{`str(float(1) + 1)`, "2.0"},
+		{`str(1 + float("0.5"))`, "1.5"},
+		{`str(float(1) + float(2))`, "3.0"},
+		{`str(float("2.5") - 3)`, "-0.5"},
+		{`str(float("1.5") * 4)`, "6.0"},
+		{`str(7 / float(2))`, "3.5"},
+		{`str(float("7.5") % 2)`, "1.5"},
+		{`str(-float(2))`, "-2.0"},
+		{`str(-sqrt(16))`, "-4.0"},
+		{`let x = float(1); x += 1; x *= 3; str(x)`, "6.0"},
+		{`floor(float("2.7") * 10)`, 27},
+		{`let r = floor(rand() * 10); r >= 0 ? r < 10 : false`, true},
+		{`float(1) < 2`, true},
+		{`2 <= float("1.5")`, false},
+		{`float("2.5") > float(2)`, true},
+		{`float(2) >= 2`, true},
+		{`float(1) == 1`, true},
+		{`1 == float(1)`, true},
+		{`float("1.5") != 1`, true},
+		{`[1, float(2)] == [float(1), 2]`, true},
+		{`float(1) in [1, 2]`, true},
+		{`float("NaN") == float("NaN")`, false},
+		{`float(1) == "1"`, false},
+		{`float(1) + "a"`, &object.Error{Message: "unsupported operation: FLOAT + STRING"}},
+		{`float(1) < true`, &object.Error{Message: "unsupported operation: FLOAT < BOOLEAN"}},
+		{`float(1) / 0`, &object.Error{Message: "division by zero"}},
+		{`1 % float(0)`, &object.Error{Message: "modulo by zero"}},
+		{`-"a"`, &object.Error{Message: "unsupported type for negation: STRING"}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestDivisionByZero verifies that dividing by zero is a runtime error rather than a panic.
+func TestDivisionByZero(t *testing.T) {
+	tests := []vmTestCase{
+		{"5 / 0", &object.Error{Message: "division by zero"}},
+		{"5 % 0", &object.Error{Message: "modulo by zero"}},
+		{"let zero = 0; 1 / zero", &object.Error{Message: "division by zero"}},
+		{"let f = fn(a, b) { a % b }; f(10, 0)", &object.Error{Message: "modulo by zero"}},
+		{"let x = 10; x /= 0; x", &object.Error{Message: "division by zero"}},
+		{"let x = 10; x %= 0; x", &object.Error{Message: "modulo by zero"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestTernaryExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true ? 10 : 20", 10},
+		{"false ? 10 : 20", 20},
+		{"1 < 2 ? 10 : 20", 10},
+		{"let x = 0; x ? 10 : 20", 10},
+		{"let n = -3; n < 0 ? -n : n", 3},
+		{"let grade = fn(s) { s >= 90 ? \"A\" : s >= 80 ? \"B\" : \"C\" }; [grade(95), grade(85), grade(10)]",
+			[]string{"A", "B", "C"}},
+		{"let a = 1; let b = 2; (a > b ? a : b) * 10", 20},
+		{"if (true ? false : true) { 1 } else { 2 }", 2},
+	}
+	runVmTests(t, tests)
+}
+
+// runVMBenchmark compiles input once and measures running the bytecode in a new VM on every iteration.
+func runVMBenchmark(b *testing.B, input string) {
+	b.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		vm := New(bytecode)
+		err := vm.Run()
+		if err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+// BenchmarkEquality measures a loop that compares integers, strings and booleans with == and != on every iteration.
+func BenchmarkEquality(b *testing.B) {
+	input := `
+let i = 0;
+let hits = 0;
+while (i < 1000) {
+	if (i == 500) { hits += 1 }
+	if ("a" + "b" == "ab") { hits += 1 }
+	if ((i > 10) != false) { hits += 1 }
+	i += 1
+}
+hits`
+	runVMBenchmark(b, input)
+}
+
+// BenchmarkIncrementLoop measures a tight counting loop, whose increment compiles to OpAddImmediate.
+func BenchmarkIncrementLoop(b *testing.B) {
+	input := `
+let i = 0;
+while (i < 1000000) { i = i + 1 }
+i`
+	runVMBenchmark(b, input)
+}
+
+// BenchmarkSmallIntegers measures arithmetic whose results are all small integers, which share preallocated objects.
+func BenchmarkSmallIntegers(b *testing.B) {
+	input := `
+let sum = 0;
+for (let i = 0; i < 100; i++) {
+	for (let j = 0; j < 100; j++) {
+		sum = j - i;
+	}
+}
+sum`
+	runVMBenchmark(b, input)
+}
+
+// BenchmarkGlobals measures a loop that reads and writes several globals on every iteration.
+func BenchmarkGlobals(b *testing.B) {
+	input := `
+let a = 1;
+let b = 2;
+let c = 0;
+let i = 0;
+while (i < 100000) {
+	c = a;
+	a = b;
+	b = c;
+	i += 1;
+}
+a`
+	runVMBenchmark(b, input)
+}